@@ -2,16 +2,29 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/Azure/azure-api-mcp/internal/approval"
+	"github.com/Azure/azure-api-mcp/internal/audit"
+	"github.com/Azure/azure-api-mcp/internal/authn"
 	"github.com/Azure/azure-api-mcp/internal/config"
 	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+	"github.com/Azure/azure-api-mcp/internal/output"
+	"github.com/Azure/azure-api-mcp/internal/ratelimit"
 	mcpserver "github.com/Azure/azure-api-mcp/internal/server"
+	"github.com/Azure/azure-api-mcp/internal/shutdown"
 	"github.com/Azure/azure-api-mcp/internal/version"
 	"github.com/Azure/azure-api-mcp/pkg/azcli"
+	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
@@ -28,49 +41,65 @@ func main() {
 	}
 	logger.Debugf("Log level set to: %s", cfg.LogLevel)
 
-	authTimeout := 30 * time.Second
-	authCtx, authCancel := context.WithTimeout(context.Background(), authTimeout)
-	defer authCancel()
+	clouds, err := newCloudDefinitions(cfg)
+	if err != nil {
+		logger.Errorf("Failed to load clouds: %v", err)
+		os.Exit(1)
+	}
 
-	authConfig := azcli.AuthConfig{
-		SkipSetup:           cfg.SkipAuthSetup,
-		AuthMethod:          cfg.AuthMethod,
-		TenantID:            cfg.TenantID,
-		ClientID:            cfg.ClientID,
-		FederatedTokenFile:  cfg.FederatedTokenFile,
-		ClientSecret:        cfg.ClientSecret,
-		DefaultSubscription: cfg.DefaultSubscription,
+	identities, err := newIdentityProfiles(cfg, clouds)
+	if err != nil {
+		logger.Errorf("Failed to load identities: %v", err)
+		os.Exit(1)
 	}
 
-	var authSetup azcli.AuthSetup
-	if !cfg.SkipAuthSetup {
-		authSetup = azcli.NewDefaultAuthSetup(authConfig)
-		if err := authSetup.Setup(authCtx); err != nil {
-			if authCtx.Err() == context.DeadlineExceeded {
-				logger.Errorf("Authentication setup timed out after %v. This may indicate az CLI is waiting for interactive input or is not responding.", authTimeout)
-				os.Exit(1)
-			}
-			logger.Errorf("Authentication setup failed: %v", err)
-			os.Exit(1)
-		}
-		logger.Info("Authentication setup completed successfully")
+	configDirs, err := newConfigDirManager(cfg, identities.DefaultIdentity)
+	if err != nil {
+		logger.Errorf("Failed to set up the az config directory: %v", err)
+		os.Exit(1)
 	}
+	defer func() { _ = configDirs.Close() }()
 
-	authValidator := &azcli.DefaultAuthValidator{}
-	if err := authValidator.ValidateAuth(authCtx); err != nil {
-		if authCtx.Err() == context.DeadlineExceeded {
-			logger.Errorf("Authentication validation timed out after %v. This may indicate az CLI is not configured or is waiting for interactive input.", authTimeout)
-			os.Exit(1)
-		}
-		if cfg.SkipAuthSetup {
-			logger.Errorf("Authentication validation failed: %v\nPlease run 'az login' manually first or set AZ_API_MCP_SKIP_AUTH_SETUP=false", err)
-			os.Exit(1)
-		} else {
-			logger.Errorf("Authentication validation failed: %v", err)
+	auditLogger, err := newAuditLogger(cfg)
+	if err != nil {
+		logger.Errorf("Failed to set up audit log: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = auditLogger.Close() }()
+
+	azureIdentities := make(map[string]*azureIdentity)
+	for i, profile := range identities.Identities {
+		identity, err := setUpIdentity(profile, configDirs, auditLogger != nil || cfg.CacheEnabled())
+		if err != nil {
+			logger.Errorf("Identity %s: %v", profile.Name, err)
 			os.Exit(1)
 		}
+		azureIdentities[profile.Name] = identity
+		// The tool description names the cloud az is actually logged in to.
+		identities.Identities[i].Cloud = identity.cloud
 	}
-	logger.Info("Authentication validated successfully")
+	defaultIdentity := azureIdentities[identities.DefaultIdentity]
+
+	cacheConfig, err := newCacheConfig(cfg, defaultIdentity.subscription)
+	if err != nil {
+		logger.Errorf("Invalid cache configuration: %v", err)
+		os.Exit(1)
+	}
+	cacheConfig.Subscriptions = make(map[string]string)
+	for name, identity := range azureIdentities {
+		cacheConfig.Subscriptions[name] = identity.subscription
+	}
+
+	credentialsCtx, stopCredentials := context.WithCancel(context.Background())
+	defer stopCredentials()
+	identityCredentials := make(map[string]*azcli.CredentialManager)
+	accounts := make(map[string]string)
+	for name, identity := range azureIdentities {
+		identity.credentials.Start(credentialsCtx)
+		identityCredentials[name] = identity.credentials
+		accounts[name] = identity.account
+	}
+	configDirs.Start(credentialsCtx)
 
 	client, err := azcli.NewClient(azcli.ClientConfig{
 		ReadOnlyMode:         cfg.ReadOnlyMode,
@@ -79,50 +108,492 @@ func main() {
 		WorkingDir:           "",
 		SecurityPolicyFile:   cfg.SecurityPolicyFile,
 		ReadOnlyPatternsFile: cfg.ReadOnlyPatternsFile,
-		AuthSetup:            authSetup,
+		PolicyBindingsFile:   cfg.PolicyBindingsFile,
+		AuthSetup:            defaultIdentity.authSetup,
+		Credentials:          defaultIdentity.credentials,
+		Identities:           identityCredentials,
+		DefaultIdentity:      identities.DefaultIdentity,
+		AllowedIdentities:    cfg.AllowedIdentities,
+		ConfigDirs:           configDirs,
+		MaxConcurrent:        cfg.MaxConcurrent,
+		MaxQueued:            cfg.MaxQueued,
+		QueueTimeout:         cfg.QueueTimeoutDuration(),
+		MaxOutputSize:        cfg.ExecutorMaxOutputSize(),
+		AllowedOutputFormats: cfg.AllowedOutputFormats,
+		Retry:                azcli.RetryConfig{MaxRetries: cfg.MaxRetries},
+		Cache:                cacheConfig,
 	})
 	if err != nil {
 		logger.Errorf("Failed to create Azure CLI client: %v", err)
 		os.Exit(1)
 	}
 
+	var serverOptions []server.ServerOption
+	if cfg.ApprovalMode == "elicitation" {
+		serverOptions = append(serverOptions, server.WithElicitation())
+	}
+	if configDirs.PerSession() {
+		hooks := &server.Hooks{}
+		hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+			configDirs.Release(session.SessionID())
+		})
+		serverOptions = append(serverOptions, server.WithHooks(hooks))
+	}
+
 	mcpServer := server.NewMCPServer(
 		"Azure API MCP",
 		version.GetVersion(),
+		serverOptions...,
 	)
 
-	callAzTool := azcli.RegisterCallAzTool(cfg.ReadOnlyMode, cfg.DefaultSubscription)
-	callAzHandler := mcpserver.CallAzHandler(client)
+	outputs, err := output.NewManager(output.Config{
+		Mode:  output.Mode(cfg.OutputOverflow),
+		Limit: cfg.MaxOutputSize,
+	})
+	if err != nil {
+		logger.Errorf("Failed to set up output handling: %v", err)
+		os.Exit(1)
+	}
+	defer func() { _ = outputs.Close() }()
+
+	routes := make(map[string]http.Handler)
+	handlerConfig := mcpserver.HandlerConfig{
+		Approvals:       newApprovalManager(cfg, mcpServer, routes),
+		Audit:           auditLogger,
+		Identity:        defaultIdentity.account,
+		DefaultIdentity: identities.DefaultIdentity,
+		Identities:      accounts,
+		DryRun:          cfg.DryRun,
+		Output:          outputs,
+		RateLimits:      ratelimit.New(newRateLimitConfig(cfg)),
+		Shutdown:        shutdown.New(),
+	}
+
+	callAzTool := azcli.RegisterCallAzTool(cfg.ReadOnlyMode, identities.Default().DefaultSubscription, cfg.DryRun, identities)
+	callAzHandler := mcpserver.CallAzHandler(client, handlerConfig)
 	mcpServer.AddTool(callAzTool, callAzHandler)
 
+	switch outputs.Mode() {
+	case output.ModePage:
+		mcpServer.AddTool(azcli.RegisterFetchPageTool(), mcpserver.FetchPageHandler(outputs))
+	case output.ModeSpill:
+		mcpServer.AddResourceTemplate(
+			mcp.NewResourceTemplate(output.ResourceURIPrefix+"{id}", "call_az output",
+				mcp.WithTemplateDescription("Complete output of a call_az command that was too large for a single response"),
+			),
+			mcpserver.OutputResourceHandler(outputs),
+		)
+	}
+
+	if cfg.MaxConcurrent > 0 {
+		logger.Infof("Executing at most %d commands at once (queue: %d, queue timeout: %v)", cfg.MaxConcurrent, cfg.MaxQueued, cfg.QueueTimeoutDuration())
+	}
+
+	if cfg.CacheEnabled() {
+		logger.Infof("Caching read-only results (default TTL: %ds, rules: %d)", cfg.CacheTTL, len(cfg.CacheRules))
+	}
+
+	if handlerConfig.RateLimits != nil {
+		logger.Infof("Rate limits per minute (read/write): session %d/%d, client %d/%d, global %d/%d (0 is unlimited)",
+			cfg.RateLimitSessionRead, cfg.RateLimitSessionWrite, cfg.RateLimitClientRead, cfg.RateLimitClientWrite, cfg.RateLimitGlobalRead, cfg.RateLimitGlobalWrite)
+	}
+
+	if cfg.MaxRetries > 0 {
+		logger.Infof("Retrying throttled and transient failures of read-only commands up to %d times", cfg.MaxRetries)
+	}
+
+	if cfg.IdentitiesFile != "" {
+		logger.Infof("Commands can run as %d identities from %s (default: %s)", len(identities.Identities), cfg.IdentitiesFile, identities.DefaultIdentity)
+	}
+
+	if cfg.AzureConfigDir != "" {
+		logger.Infof("Running az with an AZURE_CONFIG_DIR per identity below %s", cfg.AzureConfigDir)
+		if configDirs.PerSession() {
+			logger.Info("Each MCP session gets its own AZURE_CONFIG_DIR cloned from the login of the identity")
+		}
+	}
+
+	if cfg.PolicyBindingsFile != "" {
+		logger.Infof("Selecting security policies per caller from %s", cfg.PolicyBindingsFile)
+	}
+
+	if cfg.DryRun {
+		logger.Info("Dry-run mode enabled: commands are validated but not executed")
+	}
+
+	authenticator, err := newAuthenticator(cfg)
+	if err != nil {
+		logger.Errorf("Failed to set up inbound authentication: %v", err)
+		os.Exit(1)
+	}
+	if authenticator != nil {
+		routes[authn.MetadataPath] = authenticator.MetadataHandler()
+		routes[authn.MetadataPath+"/"] = authenticator.MetadataHandler()
+	} else if cfg.Transport != "stdio" {
+		logger.Warn("Inbound authentication is disabled; anyone who can reach the server can run az commands as its Azure identity")
+	}
+
+	tlsConfig, err := newTLSConfig(cfg)
+	if err != nil {
+		logger.Errorf("Failed to set up TLS: %v", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
 	logger.Infof("Starting Azure API MCP server (version %s)", version.GetVersion())
-	if err := runServer(mcpServer, cfg); err != nil {
+	health := healthHandler(handlerConfig.Shutdown, defaultIdentity.credentials, identityCredentials)
+	if err := runServer(ctx, mcpServer, cfg, routes, authenticator, tlsConfig, handlerConfig.Shutdown, health); err != nil {
 		logger.Errorf("Server error: %v", err)
 		os.Exit(1)
 	}
 }
 
-func runServer(mcpServer *server.MCPServer, cfg *config.Config) error {
+// newAuditLogger builds an audit logger writing to every configured sink. It
+// returns nil when auditing is not configured.
+func newAuditLogger(cfg *config.Config) (*audit.Logger, error) {
+	if !cfg.AuditEnabled() {
+		return nil, nil
+	}
+
+	var sinks []audit.AuditSink
+	if cfg.AuditLogFile != "" {
+		fileSink, err := audit.NewFileSink(cfg.AuditLogFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, fileSink)
+		logger.Infof("Audit log file: %s", cfg.AuditLogFile)
+	}
+	if cfg.AuditSyslog {
+		syslogSink, err := audit.NewSyslogSink("azure-api-mcp")
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		sinks = append(sinks, syslogSink)
+		logger.Info("Audit entries are written to syslog")
+	}
+	if cfg.AuditWebhookURL != "" {
+		sinks = append(sinks, audit.NewWebhookSink(cfg.AuditWebhookURL, nil))
+		logger.Infof("Audit entries are posted to %s", cfg.AuditWebhookURL)
+	}
+
+	return audit.NewLogger(sinks...)
+}
+
+// newConfigDirManager builds the AZURE_CONFIG_DIR management selected by
+// --azure-config-dir. It returns nil when az uses its default directory.
+func newConfigDirManager(cfg *config.Config, defaultIdentity string) (*azcli.ConfigDirManager, error) {
+	if cfg.AzureConfigDir == "" {
+		return nil, nil
+	}
+	return azcli.NewConfigDirManager(azcli.ConfigDirConfig{
+		Root:            cfg.AzureConfigDir,
+		PerSession:      cfg.ConfigDirPerSession,
+		DefaultIdentity: defaultIdentity,
+	})
+}
+
+// newCloudDefinitions loads the custom clouds of --clouds-file. It returns
+// nil when only the clouds built into az are available.
+func newCloudDefinitions(cfg *config.Config) (*azcli.CloudDefinitions, error) {
+	if cfg.CloudsFile == "" {
+		return nil, nil
+	}
+	return azcli.LoadCloudDefinitions(cfg.CloudsFile)
+}
+
+// newIdentityProfiles returns the identities of --identities-file, or else
+// the single identity configured by the auth flags and environment
+// variables. Identities of the file inherit the cloud and tenant, and with
+// workload identity the federated token file, of the environment.
+func newIdentityProfiles(cfg *config.Config, clouds *azcli.CloudDefinitions) (*azcli.IdentityProfiles, error) {
+	profiles := &azcli.IdentityProfiles{
+		DefaultIdentity: azcli.DefaultIdentity,
+		Identities: []azcli.AuthConfig{{
+			Name:                azcli.DefaultIdentity,
+			SkipSetup:           cfg.SkipAuthSetup,
+			AuthMethod:          cfg.AuthMethod,
+			TenantID:            cfg.TenantID,
+			ClientID:            cfg.ClientID,
+			FederatedTokenFile:  cfg.FederatedTokenFile,
+			ClientSecret:        cfg.ClientSecret,
+			DefaultSubscription: cfg.DefaultSubscription,
+			Cloud:               cfg.Cloud,
+		}},
+	}
+	if cfg.IdentitiesFile != "" {
+		var err error
+		if profiles, err = azcli.LoadIdentityProfiles(cfg.IdentitiesFile); err != nil {
+			return nil, err
+		}
+		for i := range profiles.Identities {
+			profile := &profiles.Identities[i]
+			profile.SkipSetup = profile.SkipSetup || cfg.SkipAuthSetup
+			if profile.TenantID == "" {
+				profile.TenantID = cfg.TenantID
+			}
+			if profile.FederatedTokenFile == "" && profile.AuthMethod == "workload-identity" {
+				profile.FederatedTokenFile = cfg.FederatedTokenFile
+			}
+			if profile.Cloud == "" {
+				profile.Cloud = cfg.Cloud
+			}
+		}
+	}
+
+	for i := range profiles.Identities {
+		profile := &profiles.Identities[i]
+		customCloud, err := clouds.Resolve(profile.Cloud)
+		if err != nil {
+			return nil, fmt.Errorf("identity %s: %w", profile.Name, err)
+		}
+		profile.CustomCloud = customCloud
+	}
+	return profiles, nil
+}
+
+// azureIdentity is a named Azure identity the server runs commands as.
+type azureIdentity struct {
+	authSetup   azcli.AuthSetup
+	credentials *azcli.CredentialManager
+	// account and subscription identify the logged-in account in audit
+	// entries and cache keys.
+	account      string
+	subscription string
+	// cloud is the cloud az is logged in to.
+	cloud string
+}
+
+// setUpIdentity logs in as profile in its config directory and checks the
+// login. With lookUpAccount, the account is looked up for the audit log and
+// the result cache.
+func setUpIdentity(profile azcli.AuthConfig, configDirs *azcli.ConfigDirManager, lookUpAccount bool) (*azureIdentity, error) {
+	authTimeout := 30 * time.Second
+	authCtx, authCancel := context.WithTimeout(context.Background(), authTimeout)
+	defer authCancel()
+
+	configDir, err := configDirs.IdentityDir(profile.Name)
+	if err != nil {
+		return nil, err
+	}
+	profile.ConfigDir = configDir
+	identity := &azureIdentity{}
+
+	if !profile.SkipSetup {
+		identity.authSetup = azcli.NewDefaultAuthSetup(profile)
+		if err := identity.authSetup.Setup(authCtx); err != nil {
+			if authCtx.Err() == context.DeadlineExceeded {
+				return nil, fmt.Errorf("authentication setup timed out after %v. This may indicate az CLI is waiting for interactive input or is not responding", authTimeout)
+			}
+			return nil, fmt.Errorf("authentication setup failed: %w", err)
+		}
+		logger.Infof("Authentication setup of identity %s completed successfully", profile.Name)
+	}
+
+	authValidator := &azcli.DefaultAuthValidator{ConfigDir: configDir}
+	if err := authValidator.ValidateAuth(authCtx); err != nil {
+		switch {
+		case authCtx.Err() == context.DeadlineExceeded:
+			return nil, fmt.Errorf("authentication validation timed out after %v. This may indicate az CLI is not configured or is waiting for interactive input", authTimeout)
+		case profile.SkipSetup && configDir != "":
+			return nil, fmt.Errorf("authentication validation failed: %w\nPlease run 'AZURE_CONFIG_DIR=%s az login' manually first or set AZ_API_MCP_SKIP_AUTH_SETUP=false", err, configDir)
+		case profile.SkipSetup:
+			return nil, fmt.Errorf("authentication validation failed: %w\nPlease run 'az login' manually first or set AZ_API_MCP_SKIP_AUTH_SETUP=false", err)
+		default:
+			return nil, fmt.Errorf("authentication validation failed: %w", err)
+		}
+	}
+	logger.Infof("Authentication of identity %s validated successfully", profile.Name)
+
+	if cloud, err := authValidator.ActiveCloud(authCtx); err != nil {
+		logger.Warnf("Could not determine the Azure cloud of %s: %v", profile.Name, err)
+		identity.cloud = profile.Cloud
+	} else {
+		// With SkipSetup, az was set to a cloud outside the server.
+		if profile.Cloud != "" && cloud != profile.Cloud {
+			setCloud := "az cloud set --name " + profile.Cloud
+			if configDir != "" {
+				setCloud = "AZURE_CONFIG_DIR=" + configDir + " " + setCloud
+			}
+			return nil, fmt.Errorf("az is set to cloud %s, not %s\nPlease run '%s' and log in again", cloud, profile.Cloud, setCloud)
+		}
+		identity.cloud = cloud
+		logger.Infof("Identity %s uses the Azure cloud %s", profile.Name, cloud)
+	}
+
+	if lookUpAccount {
+		if account, err := authValidator.CurrentAccount(authCtx); err != nil {
+			logger.Warnf("Could not determine Azure identity of %s for audit log and cache: %v", profile.Name, err)
+		} else {
+			identity.account = account.Identity()
+			identity.subscription = account.SubscriptionID
+		}
+	}
+
+	identity.credentials = azcli.NewCredentialManager(azcli.CredentialConfig{
+		Identity:           profile.Name,
+		AuthSetup:          identity.authSetup,
+		FederatedTokenFile: profile.FederatedTokenFile,
+		ConfigDir:          configDir,
+		Cloud:              identity.cloud,
+	})
+	return identity, nil
+}
+
+// newCacheConfig builds the result cache settings. subscription is the
+// active subscription of az.
+func newCacheConfig(cfg *config.Config, subscription string) (azcli.CacheConfig, error) {
+	cacheConfig := azcli.CacheConfig{
+		TTL:          time.Duration(cfg.CacheTTL) * time.Second,
+		MaxEntries:   cfg.CacheMaxEntries,
+		Dir:          cfg.CacheDir,
+		Subscription: subscription,
+	}
+	for _, value := range cfg.CacheRules {
+		rule, err := azcli.ParseCacheRule(value)
+		if err != nil {
+			return azcli.CacheConfig{}, err
+		}
+		cacheConfig.Rules = append(cacheConfig.Rules, rule)
+	}
+	return cacheConfig, nil
+}
+
+// newRateLimitConfig builds the rate limits of call_az from commands per
+// minute.
+func newRateLimitConfig(cfg *config.Config) ratelimit.Config {
+	budget := func(read, write int) ratelimit.Budget {
+		return ratelimit.Budget{
+			Read:  ratelimit.Limit{PerMinute: float64(read)},
+			Write: ratelimit.Limit{PerMinute: float64(write)},
+		}
+	}
+	return ratelimit.Config{
+		Session: budget(cfg.RateLimitSessionRead, cfg.RateLimitSessionWrite),
+		Client:  budget(cfg.RateLimitClientRead, cfg.RateLimitClientWrite),
+		Global:  budget(cfg.RateLimitGlobalRead, cfg.RateLimitGlobalWrite),
+	}
+}
+
+// newAuthenticator builds the inbound authentication of the HTTP transports.
+// It returns nil when no API keys or JWT issuer are configured.
+func newAuthenticator(cfg *config.Config) (*authn.Authenticator, error) {
+	if !cfg.InboundAuthEnabled() {
+		return nil, nil
+	}
+
+	authConfig := authn.Config{
+		ResourceURL:          cfg.ResourceURL,
+		ResourcePath:         "/mcp",
+		AuthorizationServers: cfg.AuthorizationServers,
+	}
+	if cfg.Transport == "sse" {
+		authConfig.ResourcePath = "/sse"
+	}
+	if cfg.APIKeysFile != "" {
+		keys, err := authn.LoadAPIKeys(cfg.APIKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		authConfig.APIKeys = keys
+		logger.Infof("Accepting %d API keys from %s", len(keys), cfg.APIKeysFile)
+	}
+	if cfg.JWTEnabled() {
+		authConfig.JWT = &authn.JWTConfig{
+			Issuer:   cfg.JWTIssuer,
+			Audience: cfg.JWTAudience,
+			JWKSFile: cfg.JWKSFile,
+			JWKSURL:  cfg.JWKSURL,
+		}
+		logger.Infof("Accepting JWT bearer tokens (issuer: %s)", cfg.JWTIssuer)
+	}
+	if cfg.TLSClientCA != "" {
+		authConfig.ClientCertificates = true
+		logger.Infof("Accepting client certificates signed by the CAs in %s", cfg.TLSClientCA)
+	}
+	return authn.New(authConfig)
+}
+
+// newTLSConfig builds the TLS configuration of the HTTP transports. It
+// returns nil when TLS is not configured.
+func newTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if !cfg.TLSEnabled() {
+		return nil, nil
+	}
+	return authn.NewTLSConfig(authn.TLSConfig{
+		CertFile:     cfg.TLSCert,
+		KeyFile:      cfg.TLSKey,
+		ClientCAFile: cfg.TLSClientCA,
+	})
+}
+
+// newApprovalManager builds the approval workflow selected by
+// --approval-mode. HTTP endpoints it needs are added to routes.
+func newApprovalManager(cfg *config.Config, mcpServer *server.MCPServer, routes map[string]http.Handler) *approval.Manager {
+	var approver approval.Approver
+	switch cfg.ApprovalMode {
+	case "elicitation":
+		approver = approval.NewElicitationApprover(mcpServer)
+	case "http":
+		httpApprover := approval.NewHTTPApprover(cfg.ApprovalToken)
+		routes["/approvals"] = httpApprover.Handler()
+		routes["/approvals/"] = httpApprover.Handler()
+		approver = httpApprover
+	case "webhook":
+		approver = approval.NewWebhookApprover(cfg.ApprovalWebhookURL, nil)
+	default:
+		return nil
+	}
+
+	logger.Infof("Approval workflow enabled (mode: %s, default timeout: %v)", cfg.ApprovalMode, cfg.ApprovalTimeoutDuration())
+	return approval.NewManager(approver, cfg.ApprovalTimeoutDuration())
+}
+
+// runServer serves mcpServer on the configured transport until ctx ends,
+// and then drains in-flight tool calls before it stops the transport.
+func runServer(ctx context.Context, mcpServer *server.MCPServer, cfg *config.Config, routes map[string]http.Handler, authenticator *authn.Authenticator, tlsConfig *tls.Config, drainer *shutdown.Drainer, health http.Handler) error {
+	protect := func(handler http.Handler) http.Handler {
+		if authenticator == nil {
+			return handler
+		}
+		return authenticator.Middleware(handler)
+	}
+
+	scheme := "http"
+	if tlsConfig != nil {
+		scheme = "https"
+	}
+
 	switch cfg.Transport {
 	case "stdio":
 		logger.Info("Listening for requests on STDIO...")
-		return server.ServeStdio(mcpServer)
+		// Tool calls inherit the context of Listen, so it is only cancelled
+		// after the calls were drained.
+		listenCtx, cancelListen := context.WithCancel(context.Background())
+		defer cancelListen()
+		stdioServer := server.NewStdioServer(mcpServer)
+		return serveUntilDone(ctx, cfg, drainer,
+			func() error { return stdioServer.Listen(listenCtx, os.Stdin, os.Stdout) },
+			func(context.Context) error { cancelListen(); return nil })
 
 	case "sse":
 		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
-		baseURL := fmt.Sprintf("http://%s", addr)
+		baseURL := fmt.Sprintf("%s://%s", scheme, addr)
 
 		mux := http.NewServeMux()
-		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte(`{"status":"healthy"}`))
-		})
+		mux.Handle("/health", health)
+		mux.Handle("/metrics", metrics.Handler())
+		for pattern, handler := range routes {
+			mux.Handle(pattern, handler)
+		}
 
 		customServer := &http.Server{
 			Addr:              addr,
 			Handler:           mux,
 			ReadHeaderTimeout: 10 * time.Second,
+			TLSConfig:         tlsConfig,
 		}
 
 		sseServer := server.NewSSEServer(
@@ -131,29 +602,45 @@ func runServer(mcpServer *server.MCPServer, cfg *config.Config) error {
 			server.WithHTTPServer(customServer),
 		)
 
+		mux.Handle("/sse", protect(sseServer.SSEHandler()))
+		mux.Handle("/message", protect(sseServer.MessageHandler()))
+
 		logger.Infof("SSE server listening on %s", addr)
 		logger.Infof("Base URL: %s", baseURL)
-		logger.Infof("SSE endpoint available at: http://%s/sse", addr)
-		logger.Infof("Message endpoint available at: http://%s/message", addr)
-		logger.Infof("Health check available at: http://%s/health", addr)
+		logger.Infof("SSE endpoint available at: %s://%s/sse", scheme, addr)
+		logger.Infof("Message endpoint available at: %s://%s/message", scheme, addr)
+		logger.Infof("Health check available at: %s://%s/health", scheme, addr)
+		logger.Infof("Metrics available at: %s://%s/metrics", scheme, addr)
+		if _, ok := routes["/approvals"]; ok {
+			logger.Infof("Approval endpoint available at: %s://%s/approvals", scheme, addr)
+		}
+		if authenticator != nil {
+			logger.Infof("Protected resource metadata available at: %s://%s%s", scheme, addr, authn.MetadataPath)
+		}
 		logger.Info("Connect to /sse for real-time events, send JSON-RPC to /message")
 
-		return sseServer.Start(addr)
+		return serveUntilDone(ctx, cfg, drainer, func() error {
+			if tlsConfig != nil {
+				return customServer.ListenAndServeTLS("", "")
+			}
+			return sseServer.Start(addr)
+		}, sseServer.Shutdown)
 
 	case "streamable-http":
 		addr := fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)
 
 		mux := http.NewServeMux()
-		mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
-			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusOK)
-			_, _ = w.Write([]byte(`{"status":"healthy"}`))
-		})
+		mux.Handle("/health", health)
+		mux.Handle("/metrics", metrics.Handler())
+		for pattern, handler := range routes {
+			mux.Handle(pattern, handler)
+		}
 
 		customServer := &http.Server{
 			Addr:              addr,
 			Handler:           mux,
 			ReadHeaderTimeout: 10 * time.Second,
+			TLSConfig:         tlsConfig,
 		}
 
 		streamableServer := server.NewStreamableHTTPServer(
@@ -161,16 +648,101 @@ func runServer(mcpServer *server.MCPServer, cfg *config.Config) error {
 			server.WithStreamableHTTPServer(customServer),
 		)
 
-		mux.Handle("/mcp", streamableServer)
+		mux.Handle("/mcp", protect(streamableServer))
 
 		logger.Infof("Streamable HTTP server listening on %s", addr)
-		logger.Infof("MCP endpoint available at: http://%s/mcp", addr)
-		logger.Infof("Health check available at: http://%s/health", addr)
+		logger.Infof("MCP endpoint available at: %s://%s/mcp", scheme, addr)
+		logger.Infof("Health check available at: %s://%s/health", scheme, addr)
+		logger.Infof("Metrics available at: %s://%s/metrics", scheme, addr)
+		if _, ok := routes["/approvals"]; ok {
+			logger.Infof("Approval endpoint available at: %s://%s/approvals", scheme, addr)
+		}
+		if authenticator != nil {
+			logger.Infof("Protected resource metadata available at: %s://%s%s", scheme, addr, authn.MetadataPath)
+		}
 		logger.Info("Send POST requests to /mcp to initialize session and obtain Mcp-Session-Id")
 
-		return customServer.ListenAndServe()
+		return serveUntilDone(ctx, cfg, drainer, func() error {
+			if tlsConfig != nil {
+				return customServer.ListenAndServeTLS("", "")
+			}
+			return customServer.ListenAndServe()
+		}, streamableServer.Shutdown)
 
 	default:
 		return fmt.Errorf("invalid transport type: %s (must be 'stdio', 'sse', or 'streamable-http')", cfg.Transport)
 	}
 }
+
+// healthHandler reports the server as healthy until shutdown begins, and as
+// not ready afterwards so that load balancers stop sending new calls. The
+// state of the Azure credentials is included, per identity when there are
+// several; expired or failing credentials report the server as degraded
+// without failing the check.
+func healthHandler(drainer *shutdown.Drainer, credentials *azcli.CredentialManager, identities map[string]*azcli.CredentialManager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		health := struct {
+			Status      string                           `json:"status"`
+			Credentials azcli.CredentialState            `json:"credentials"`
+			Identities  map[string]azcli.CredentialState `json:"identities,omitempty"`
+		}{Status: "healthy", Credentials: credentials.State()}
+
+		degraded := failing(health.Credentials)
+		if len(identities) > 1 {
+			health.Identities = make(map[string]azcli.CredentialState, len(identities))
+			for name, identityCredentials := range identities {
+				state := identityCredentials.State()
+				health.Identities[name] = state
+				degraded = degraded || failing(state)
+			}
+		}
+
+		status := http.StatusOK
+		switch {
+		case !drainer.Ready():
+			health.Status = "shutting_down"
+			status = http.StatusServiceUnavailable
+		case degraded:
+			health.Status = "degraded"
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(health)
+	})
+}
+
+func failing(state azcli.CredentialState) bool {
+	return state.Status == azcli.CredentialExpired || state.Status == azcli.CredentialError
+}
+
+// serveUntilDone runs serve until it fails or ctx ends. When ctx ends, new
+// tool calls are rejected, in-flight calls get the shutdown grace period to
+// finish, and the transport is stopped with stop.
+func serveUntilDone(ctx context.Context, cfg *config.Config, drainer *shutdown.Drainer, serve func() error, stop func(context.Context) error) error {
+	errCh := make(chan error, 1)
+	go func() { errCh <- serve() }()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	grace := cfg.ShutdownGracePeriodDuration()
+	logger.Infof("Shutting down: waiting up to %v for %d in-flight tool calls", grace, drainer.InFlight())
+	if cancelled := drainer.Drain(grace); cancelled > 0 {
+		logger.Warnf("Cancelled %d tool calls at shutdown", cancelled)
+	}
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := stop(stopCtx); err != nil {
+		logger.Warnf("Failed to stop the server cleanly: %v", err)
+	}
+	if err := <-errCh; err != nil && !errors.Is(err, http.ErrServerClosed) && !errors.Is(err, context.Canceled) {
+		return err
+	}
+	logger.Info("Server stopped")
+	return nil
+}
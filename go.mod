@@ -5,6 +5,7 @@ go 1.24.0
 toolchain go1.24.2
 
 require (
+	github.com/jmespath/go-jmespath v0.4.0
 	github.com/mark3labs/mcp-go v0.42.0
 	github.com/sirupsen/logrus v1.9.3
 	github.com/spf13/pflag v1.0.10
@@ -0,0 +1,103 @@
+package approval
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+)
+
+// ErrTimeout is returned when no decision is made before the approval
+// timeout expires.
+var ErrTimeout = errors.New("approval timed out")
+
+// Request describes a command waiting for approval.
+type Request struct {
+	ID        string    `json:"id"`
+	Command   string    `json:"command"`
+	Rule      string    `json:"rule,omitempty"`
+	SessionID string    `json:"sessionId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// Decision is the outcome of an approval request.
+type Decision struct {
+	Approved bool   `json:"approved"`
+	Approver string `json:"approver,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// Approver obtains a decision for a request. Implementations block until a
+// decision is made or ctx is done.
+type Approver interface {
+	RequestApproval(ctx context.Context, req *Request) (*Decision, error)
+}
+
+// Manager assigns an ID to each command that needs approval, hands it to the
+// configured Approver and applies the approval timeout.
+type Manager struct {
+	approver       Approver
+	defaultTimeout time.Duration
+}
+
+func NewManager(approver Approver, defaultTimeout time.Duration) *Manager {
+	if defaultTimeout <= 0 {
+		defaultTimeout = 5 * time.Minute
+	}
+	return &Manager{
+		approver:       approver,
+		defaultTimeout: defaultTimeout,
+	}
+}
+
+// Request blocks until the command is approved, denied or the timeout (or
+// the default timeout, when zero) expires.
+func (m *Manager) Request(ctx context.Context, command, rule, sessionID string, timeout time.Duration) (*Decision, error) {
+	if timeout <= 0 {
+		timeout = m.defaultTimeout
+	}
+
+	now := time.Now()
+	req := &Request{
+		ID:        newRequestID(),
+		Command:   command,
+		Rule:      rule,
+		SessionID: sessionID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(timeout),
+	}
+
+	logger.Infof("Command pending approval (id: %s, timeout: %v): %s", req.ID, timeout, command)
+
+	approvalCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	decision, err := m.approver.RequestApproval(approvalCtx, req)
+	if err != nil {
+		if errors.Is(approvalCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			logger.Warnf("Approval request %s timed out after %v", req.ID, timeout)
+			return nil, ErrTimeout
+		}
+		return nil, err
+	}
+
+	if decision.Approved {
+		logger.Infof("Approval request %s approved by %q", req.ID, decision.Approver)
+	} else {
+		logger.Infof("Approval request %s denied by %q: %s", req.ID, decision.Approver, decision.Reason)
+	}
+	return decision, nil
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
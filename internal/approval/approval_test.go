@@ -0,0 +1,189 @@
+package approval
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+type approverFunc func(ctx context.Context, req *Request) (*Decision, error)
+
+func (f approverFunc) RequestApproval(ctx context.Context, req *Request) (*Decision, error) {
+	return f(ctx, req)
+}
+
+func TestManager_Request(t *testing.T) {
+	var received *Request
+	manager := NewManager(approverFunc(func(ctx context.Context, req *Request) (*Decision, error) {
+		received = req
+		return &Decision{Approved: true, Approver: "tester"}, nil
+	}), time.Minute)
+
+	decision, err := manager.Request(context.Background(), "az group delete --name rg", "approve-deletes", "session-1", 0)
+	if err != nil {
+		t.Fatalf("Request() error = %v", err)
+	}
+	if !decision.Approved {
+		t.Error("expected approved decision")
+	}
+	if received.ID == "" || received.Rule != "approve-deletes" || received.SessionID != "session-1" {
+		t.Errorf("unexpected request passed to approver: %+v", received)
+	}
+	if got := received.ExpiresAt.Sub(received.CreatedAt); got != time.Minute {
+		t.Errorf("expected default timeout of 1m, got %v", got)
+	}
+}
+
+func TestManager_RequestTimeout(t *testing.T) {
+	manager := NewManager(approverFunc(func(ctx context.Context, req *Request) (*Decision, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}), time.Minute)
+
+	_, err := manager.Request(context.Background(), "az group delete --name rg", "", "", 20*time.Millisecond)
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Request() error = %v, want ErrTimeout", err)
+	}
+}
+
+func TestHTTPApprover(t *testing.T) {
+	approver := NewHTTPApprover("secret")
+	server := httptest.NewServer(approver.Handler())
+	defer server.Close()
+
+	done := make(chan *Decision, 1)
+	go func() {
+		decision, _ := approver.RequestApproval(context.Background(), &Request{ID: "req-1", Command: "az vm delete --name vm1", CreatedAt: time.Now()})
+		done <- decision
+	}()
+
+	var listed struct {
+		Pending []Request `json:"pending"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(listed.Pending) == 0 && time.Now().Before(deadline) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL+"/approvals", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&listed)
+		_ = resp.Body.Close()
+	}
+	if len(listed.Pending) != 1 || listed.Pending[0].ID != "req-1" {
+		t.Fatalf("expected one pending request, got %+v", listed.Pending)
+	}
+
+	unauthorized, err := http.Post(server.URL+"/approvals/req-1/approve", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = unauthorized.Body.Close()
+	if unauthorized.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected 401 without token, got %d", unauthorized.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/approvals/req-1/deny", strings.NewReader(`{"approver":"alice","reason":"not today"}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200, got %d", resp.StatusCode)
+	}
+
+	select {
+	case decision := <-done:
+		if decision.Approved || decision.Approver != "alice" || decision.Reason != "not today" {
+			t.Errorf("unexpected decision: %+v", decision)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("approval request did not complete")
+	}
+}
+
+func TestWebhookApprover(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req Request
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		approved := strings.HasPrefix(req.Command, "az group create")
+		_ = json.NewEncoder(w).Encode(Decision{Approved: approved, Approver: "webhook"})
+	}))
+	defer server.Close()
+
+	approver := NewWebhookApprover(server.URL, nil)
+
+	decision, err := approver.RequestApproval(context.Background(), &Request{ID: "1", Command: "az group create --name rg"})
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if !decision.Approved || decision.Approver != "webhook" {
+		t.Errorf("unexpected decision: %+v", decision)
+	}
+
+	decision, err = approver.RequestApproval(context.Background(), &Request{ID: "2", Command: "az group delete --name rg"})
+	if err != nil {
+		t.Fatalf("RequestApproval() error = %v", err)
+	}
+	if decision.Approved {
+		t.Error("expected denied decision")
+	}
+}
+
+type fakeElicitor struct {
+	result *mcp.ElicitationResult
+}
+
+func (f *fakeElicitor) RequestElicitation(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	return f.result, nil
+}
+
+func TestElicitationApprover(t *testing.T) {
+	tests := []struct {
+		name     string
+		response mcp.ElicitationResponse
+		want     bool
+	}{
+		{
+			name:     "accepted and approved",
+			response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionAccept, Content: map[string]any{"approve": true}},
+			want:     true,
+		},
+		{
+			name:     "accepted but not approved",
+			response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionAccept, Content: map[string]any{"approve": false}},
+			want:     false,
+		},
+		{
+			name:     "declined",
+			response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionDecline},
+			want:     false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			approver := NewElicitationApprover(&fakeElicitor{result: &mcp.ElicitationResult{ElicitationResponse: tt.response}})
+			decision, err := approver.RequestApproval(context.Background(), &Request{Command: "az vm delete --name vm1"})
+			if err != nil {
+				t.Fatalf("RequestApproval() error = %v", err)
+			}
+			if decision.Approved != tt.want {
+				t.Errorf("Approved = %v, want %v", decision.Approved, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package approval
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Elicitor sends an elicitation request to the MCP client of the current
+// session. *server.MCPServer satisfies it.
+type Elicitor interface {
+	RequestElicitation(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error)
+}
+
+// ElicitationApprover asks the MCP client that issued the tool call to
+// confirm the command through an elicitation round-trip.
+type ElicitationApprover struct {
+	elicitor Elicitor
+}
+
+func NewElicitationApprover(elicitor Elicitor) *ElicitationApprover {
+	return &ElicitationApprover{elicitor: elicitor}
+}
+
+func (a *ElicitationApprover) RequestApproval(ctx context.Context, req *Request) (*Decision, error) {
+	message := fmt.Sprintf("Approve execution of the following Azure CLI command?\n\n%s", req.Command)
+	if req.Rule != "" {
+		message += fmt.Sprintf("\n\nApproval is required by security policy rule: %s", req.Rule)
+	}
+
+	result, err := a.elicitor.RequestElicitation(ctx, mcp.ElicitationRequest{
+		Params: mcp.ElicitationParams{
+			Message: message,
+			RequestedSchema: map[string]any{
+				"type": "object",
+				"properties": map[string]any{
+					"approve": map[string]any{
+						"type":        "boolean",
+						"description": "Set to true to run the command",
+					},
+					"reason": map[string]any{
+						"type":        "string",
+						"description": "Optional reason for the decision",
+					},
+				},
+				"required": []string{"approve"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("elicitation request failed: %w", err)
+	}
+
+	decision := &Decision{Approver: "mcp-client"}
+	if result.Action != mcp.ElicitationResponseActionAccept {
+		decision.Reason = fmt.Sprintf("user responded with %s", result.Action)
+		return decision, nil
+	}
+
+	content, _ := result.Content.(map[string]any)
+	if approve, ok := content["approve"].(bool); ok {
+		decision.Approved = approve
+	}
+	if reason, ok := content["reason"].(string); ok {
+		decision.Reason = reason
+	}
+	return decision, nil
+}
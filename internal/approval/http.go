@@ -0,0 +1,146 @@
+package approval
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type pendingHTTPRequest struct {
+	request  *Request
+	decision chan *Decision
+}
+
+// HTTPApprover parks requests until an operator approves or denies them
+// through the HTTP endpoints served by Handler:
+//
+//	GET  /approvals               list pending requests
+//	POST /approvals/{id}/approve  approve a request
+//	POST /approvals/{id}/deny     deny a request
+//
+// The POST body may carry {"approver": "...", "reason": "..."}. When a token
+// is configured every call must send "Authorization: Bearer <token>".
+type HTTPApprover struct {
+	token string
+
+	mu      sync.Mutex
+	pending map[string]*pendingHTTPRequest
+}
+
+func NewHTTPApprover(token string) *HTTPApprover {
+	return &HTTPApprover{
+		token:   token,
+		pending: make(map[string]*pendingHTTPRequest),
+	}
+}
+
+func (a *HTTPApprover) RequestApproval(ctx context.Context, req *Request) (*Decision, error) {
+	entry := &pendingHTTPRequest{
+		request:  req,
+		decision: make(chan *Decision, 1),
+	}
+
+	a.mu.Lock()
+	a.pending[req.ID] = entry
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.pending, req.ID)
+		a.mu.Unlock()
+	}()
+
+	select {
+	case decision := <-entry.decision:
+		return decision, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Handler returns the HTTP handler for the approval endpoints.
+func (a *HTTPApprover) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /approvals", a.handleList)
+	mux.HandleFunc("POST /approvals/{id}/{action}", a.handleDecision)
+	return a.requireToken(mux)
+}
+
+func (a *HTTPApprover) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.token != "" {
+			provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(provided), []byte(a.token)) != 1 {
+				writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *HTTPApprover) handleList(w http.ResponseWriter, r *http.Request) {
+	a.mu.Lock()
+	requests := make([]Request, 0, len(a.pending))
+	for _, entry := range a.pending {
+		requests = append(requests, *entry.request)
+	}
+	a.mu.Unlock()
+
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].CreatedAt.Before(requests[j].CreatedAt)
+	})
+	writeJSON(w, http.StatusOK, map[string]any{"pending": requests})
+}
+
+func (a *HTTPApprover) handleDecision(w http.ResponseWriter, r *http.Request) {
+	var approved bool
+	switch r.PathValue("action") {
+	case "approve":
+		approved = true
+	case "deny":
+		approved = false
+	default:
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "unknown action"})
+		return
+	}
+
+	var body struct {
+		Approver string `json:"approver"`
+		Reason   string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&body); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid request body"})
+			return
+		}
+	}
+	if body.Approver == "" {
+		body.Approver = "http:" + r.RemoteAddr
+	}
+
+	id := r.PathValue("id")
+	a.mu.Lock()
+	entry, ok := a.pending[id]
+	if ok {
+		delete(a.pending, id)
+	}
+	a.mu.Unlock()
+
+	if !ok {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "approval request not found"})
+		return
+	}
+
+	entry.decision <- &Decision{Approved: approved, Approver: body.Approver, Reason: body.Reason}
+	writeJSON(w, http.StatusOK, map[string]any{"id": id, "approved": approved})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,59 @@
+package approval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// WebhookApprover posts each request as JSON to a URL and expects the
+// response body to be a Decision. The call blocks until the webhook responds,
+// so the receiving service decides when to answer.
+type WebhookApprover struct {
+	url    string
+	client *http.Client
+}
+
+func NewWebhookApprover(url string, client *http.Client) *WebhookApprover {
+	if client == nil {
+		client = &http.Client{}
+	}
+	return &WebhookApprover{url: url, client: client}
+}
+
+func (a *WebhookApprover) RequestApproval(ctx context.Context, req *Request) (*Decision, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode approval request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create approval webhook request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("approval webhook request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read approval webhook response: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("approval webhook returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var decision Decision
+	if err := json.Unmarshal(respBody, &decision); err != nil {
+		return nil, fmt.Errorf("failed to parse approval webhook response: %w", err)
+	}
+	return &decision, nil
+}
@@ -0,0 +1,199 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+)
+
+// Validation outcomes recorded in Entry.Outcome.
+const (
+	OutcomeAllowed        = "allowed"
+	OutcomeDenied         = "denied"
+	OutcomeApprovalDenied = "approval_denied"
+	OutcomeFailed         = "failed"
+	// OutcomeRateLimited marks a command rejected by a rate limit.
+	OutcomeRateLimited = "rate_limited"
+	// OutcomeCancelled marks a call cancelled because it was still running
+	// when the shutdown grace period ended.
+	OutcomeCancelled = "cancelled"
+	// OutcomeDryRun marks a dry run; the command itself was not executed.
+	OutcomeDryRun = "dry_run"
+)
+
+// Entry is a single audit record for a call_az invocation. Entries are
+// hash-chained: Hash covers every other field including PrevHash, so editing
+// or removing a record breaks the chain for every record after it.
+type Entry struct {
+	Sequence     uint64    `json:"seq"`
+	Timestamp    time.Time `json:"timestamp"`
+	SessionID    string    `json:"sessionId,omitempty"`
+	ClientName   string    `json:"clientName,omitempty"`
+	ClientVer    string    `json:"clientVersion,omitempty"`
+	Principal    string    `json:"principal,omitempty"`
+	Identity     string    `json:"identity,omitempty"`
+	IdentityName string    `json:"identityName,omitempty"`
+	Command      string    `json:"command"`
+	Outcome      string    `json:"outcome"`
+	Policy       string    `json:"policy,omitempty"`
+	Rule         string    `json:"rule,omitempty"`
+	ErrorType    string    `json:"errorType,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	ExitCode     *int      `json:"exitCode,omitempty"`
+	Retries      int       `json:"retries,omitempty"`
+	Cached       bool      `json:"cached,omitempty"`
+	DurationMs   int64     `json:"durationMs"`
+	// PreviewDurationMs is how long the what-if preview of a dry run ran;
+	// ExitCode and OutputBytes are those of the preview.
+	PreviewDurationMs int64  `json:"previewDurationMs,omitempty"`
+	OutputBytes       int    `json:"outputBytes"`
+	PrevHash          string `json:"prevHash"`
+	Hash              string `json:"hash,omitempty"`
+}
+
+// AuditSink persists audit entries. Write must not modify the entry.
+type AuditSink interface {
+	Write(entry *Entry) error
+	Close() error
+}
+
+// chainResumer is implemented by sinks that can report the last entry they
+// hold, so a restarted server continues the existing hash chain.
+type chainResumer interface {
+	LastEntry() (*Entry, error)
+}
+
+// sinkQueueSize bounds the entries waiting to be written to each sink. Record
+// blocks when a sink falls this far behind, rather than losing entries.
+const sinkQueueSize = 256
+
+// Logger redacts, sequences and hash-chains entries before handing them to
+// every configured sink. Each sink is written in the background, in order,
+// so that a slow sink such as a webhook does not hold up tool calls.
+type Logger struct {
+	writers []*sinkWriter
+
+	mu       sync.Mutex
+	sequence uint64
+	lastHash string
+	closed   bool
+}
+
+// sinkWriter writes the queued entries of one sink.
+type sinkWriter struct {
+	sink  AuditSink
+	queue chan *Entry
+	done  chan struct{}
+}
+
+func (w *sinkWriter) run() {
+	defer close(w.done)
+	for entry := range w.queue {
+		if err := w.sink.Write(entry); err != nil {
+			logger.Errorf("Failed to write audit entry %d: %v", entry.Sequence, err)
+		}
+	}
+}
+
+// NewLogger creates a Logger writing to sinks. The hash chain continues from
+// the first sink that can report its last entry.
+func NewLogger(sinks ...AuditSink) (*Logger, error) {
+	l := &Logger{}
+	for _, sink := range sinks {
+		resumer, ok := sink.(chainResumer)
+		if !ok {
+			continue
+		}
+		last, err := resumer.LastEntry()
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			l.sequence = last.Sequence
+			l.lastHash = last.Hash
+		}
+		break
+	}
+	for _, sink := range sinks {
+		w := &sinkWriter{sink: sink, queue: make(chan *Entry, sinkQueueSize), done: make(chan struct{})}
+		go w.run()
+		l.writers = append(l.writers, w)
+	}
+	return l, nil
+}
+
+// Record completes entry (sequence, timestamp, redaction and hashes) and
+// queues it for every sink. Sink failures are logged and do not stop the
+// remaining sinks.
+func (l *Logger) Record(entry Entry) {
+	if l == nil {
+		return
+	}
+
+	entry.Command = Redact(entry.Command)
+	entry.Error = Redact(entry.Error)
+	if entry.Timestamp.IsZero() {
+		entry.Timestamp = time.Now().UTC()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		logger.Errorf("Audit entry recorded after the audit log was closed: %s", entry.Command)
+		return
+	}
+
+	l.sequence++
+	entry.Sequence = l.sequence
+	entry.PrevHash = l.lastHash
+	entry.Hash = ""
+	entry.Hash = computeHash(&entry)
+	l.lastHash = entry.Hash
+
+	// Entries are queued under the lock so that every sink receives them in
+	// the order of the chain.
+	for _, w := range l.writers {
+		w.queue <- &entry
+	}
+}
+
+// Close writes the queued entries and closes every sink.
+func (l *Logger) Close() error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	for _, w := range l.writers {
+		close(w.queue)
+	}
+	l.mu.Unlock()
+
+	var firstErr error
+	for _, w := range l.writers {
+		<-w.done
+		if err := w.sink.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func computeHash(entry *Entry) string {
+	unhashed := *entry
+	unhashed.Hash = ""
+	data, err := json.Marshal(&unhashed)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
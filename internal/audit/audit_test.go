@@ -0,0 +1,262 @@
+package audit
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogger_FileSinkHashChain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger, err := NewLogger(sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger.Record(Entry{Command: "az vm list", Outcome: OutcomeAllowed})
+	auditLogger.Record(Entry{Command: "az vm delete --name vm1", Outcome: OutcomeDenied, Rule: "deny-vm-delete"})
+	if err := auditLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A restarted logger continues the existing chain.
+	sink, err = NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger, err = NewLogger(sink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger.Record(Entry{Command: "az group list", Outcome: OutcomeAllowed})
+	if err := auditLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(lines))
+	}
+
+	var last Entry
+	if err := json.Unmarshal([]byte(lines[2]), &last); err != nil {
+		t.Fatal(err)
+	}
+	if last.Sequence != 3 {
+		t.Errorf("expected sequence 3 after restart, got %d", last.Sequence)
+	}
+
+	if err := Verify(strings.NewReader(string(data))); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestVerify_DetectsTampering(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	sink, err := NewFileSink(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger, _ := NewLogger(sink)
+	auditLogger.Record(Entry{Command: "az vm list", Outcome: OutcomeAllowed})
+	auditLogger.Record(Entry{Command: "az vm delete --name vm1", Outcome: OutcomeDenied})
+	auditLogger.Record(Entry{Command: "az group list", Outcome: OutcomeAllowed})
+	_ = auditLogger.Close()
+
+	data, _ := os.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	edited := strings.Replace(string(data), `"outcome":"denied"`, `"outcome":"allowed"`, 1)
+	if err := Verify(strings.NewReader(edited)); err == nil {
+		t.Error("Verify() should detect an edited entry")
+	}
+
+	removed := lines[0] + "\n" + lines[2] + "\n"
+	if err := Verify(strings.NewReader(removed)); err == nil {
+		t.Error("Verify() should detect a removed entry")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		secret  string
+		keepStr string
+	}{
+		{
+			name:    "password flag",
+			input:   "az vm create --name vm1 --admin-password S3cret!",
+			secret:  "S3cret!",
+			keepStr: "--admin-password",
+		},
+		{
+			name:    "quoted client secret",
+			input:   `az ad sp credential reset --id x --client-secret "a b c"`,
+			secret:  "a b c",
+			keepStr: "--client-secret",
+		},
+		{
+			name:    "flag with equals",
+			input:   "az storage blob list --account-key=abc123==",
+			secret:  "abc123==",
+			keepStr: "--account-key=",
+		},
+		{
+			name:    "connection string",
+			input:   "az storage blob list --connection-string DefaultEndpointsProtocol=https;AccountName=sa;AccountKey=xyz==",
+			secret:  "xyz==",
+			keepStr: "--connection-string",
+		},
+		{
+			name:    "sas signature",
+			input:   "az storage blob download --blob-url https://sa.blob.core.windows.net/c/b?sv=2020&sig=abcDEF%2B",
+			secret:  "abcDEF%2B",
+			keepStr: "sv=2020",
+		},
+		{
+			name:    "keyvault secret value",
+			input:   "az keyvault secret set --vault-name kv --name s --value hunter2",
+			secret:  "hunter2",
+			keepStr: "--vault-name kv",
+		},
+		{
+			name:    "certificate password",
+			input:   "az webapp config ssl upload -n app -g rg --certificate-file c.pfx --certificate-password pfxpass",
+			secret:  "pfxpass",
+			keepStr: "--certificate-file c.pfx",
+		},
+		{
+			name:    "storage account key",
+			input:   "az functionapp create -n fn --storage-account sa --storage-account-key=sakey123",
+			secret:  "sakey123",
+			keepStr: "--storage-account sa",
+		},
+		{
+			name:    "sas flag",
+			input:   "az storage blob upload --account-name sa --sas sv=2022&sp=rw --file f",
+			secret:  "sv=2022&sp=rw",
+			keepStr: "--file f",
+		},
+		{
+			name:    "key value",
+			input:   "az iot hub device-identity create --key-value 'a1b2c3' --device-id d1",
+			secret:  "a1b2c3",
+			keepStr: "--device-id d1",
+		},
+		{
+			name:    "client certificate password",
+			input:   "az network application-gateway ssl-cert create --client-certificate-password certpass --name c",
+			secret:  "certpass",
+			keepStr: "--name c",
+		},
+		{
+			name:    "key vault name kept",
+			input:   "az cosmosdb create --name db --key-uri https://kv.vault.azure.net/keys/k",
+			secret:  "no-secret-in-this-command",
+			keepStr: "--key-uri https://kv.vault.azure.net/keys/k",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Redact(tt.input)
+			if strings.Contains(got, tt.secret) {
+				t.Errorf("Redact() = %q, still contains secret", got)
+			}
+			if !strings.Contains(got, tt.keepStr) {
+				t.Errorf("Redact() = %q, want it to keep %q", got, tt.keepStr)
+			}
+		})
+	}
+}
+
+func TestLogger_RedactsBeforeWriting(t *testing.T) {
+	var received []Entry
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var entry Entry
+		_ = json.NewDecoder(r.Body).Decode(&entry)
+		received = append(received, entry)
+	}))
+	defer server.Close()
+
+	auditLogger, err := NewLogger(NewWebhookSink(server.URL, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditLogger.Record(Entry{Command: "az login --service-principal -u app -p topsecret", Outcome: OutcomeDenied})
+	if err := auditLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(received) != 1 {
+		t.Fatalf("expected 1 webhook entry, got %d", len(received))
+	}
+	if strings.Contains(received[0].Command, "topsecret") {
+		t.Errorf("webhook received unredacted command: %s", received[0].Command)
+	}
+	if received[0].Hash == "" {
+		t.Error("webhook entry should be hashed")
+	}
+}
+
+// blockingSink holds every write until release is closed.
+type blockingSink struct {
+	release chan struct{}
+	entries []Entry
+}
+
+func (s *blockingSink) Write(entry *Entry) error {
+	<-s.release
+	s.entries = append(s.entries, *entry)
+	return nil
+}
+
+func (s *blockingSink) Close() error { return nil }
+
+func TestLogger_SlowSinkDoesNotBlockRecord(t *testing.T) {
+	slow := &blockingSink{release: make(chan struct{})}
+	auditLogger, err := NewLogger(slow)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorded := make(chan struct{})
+	go func() {
+		for range 3 {
+			auditLogger.Record(Entry{Command: "az vm list", Outcome: OutcomeAllowed})
+		}
+		close(recorded)
+	}()
+	select {
+	case <-recorded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Record() blocked on a slow sink")
+	}
+
+	close(slow.release)
+	if err := auditLogger.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(slow.entries) != 3 {
+		t.Fatalf("sink received %d entries, want 3", len(slow.entries))
+	}
+	for i, entry := range slow.entries {
+		if entry.Sequence != uint64(i+1) {
+			t.Errorf("entry %d has sequence %d, want entries in order", i, entry.Sequence)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSink appends entries as JSON lines to a file.
+type FileSink struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	// #nosec G304 - This is the intended behavior: audit log path is configured by the operator
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log file: %w", err)
+	}
+	return &FileSink{file: file}, nil
+}
+
+func (s *FileSink) Write(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return s.file.Sync()
+}
+
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// LastEntry returns the last entry in the file, or nil for an empty file.
+func (s *FileSink) LastEntry() (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var last []byte
+	scanner := bufio.NewScanner(s.file)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		if line := bytes.TrimSpace(scanner.Bytes()); len(line) > 0 {
+			last = append(last[:0], line...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit log file: %w", err)
+	}
+
+	if last == nil {
+		return nil, nil
+	}
+	var entry Entry
+	if err := json.Unmarshal(last, &entry); err != nil {
+		return nil, fmt.Errorf("failed to parse last audit entry: %w", err)
+	}
+	return &entry, nil
+}
+
+// Verify reads JSON-lines audit entries from r and checks the hash chain. It
+// returns an error identifying the first entry that was altered, removed or
+// reordered.
+func Verify(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 10*1024*1024)
+
+	var prev *Entry
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return fmt.Errorf("line %d: invalid entry: %w", line, err)
+		}
+		if computeHash(&entry) != entry.Hash {
+			return fmt.Errorf("line %d (seq %d): hash mismatch", line, entry.Sequence)
+		}
+		if prev != nil {
+			if entry.PrevHash != prev.Hash {
+				return fmt.Errorf("line %d (seq %d): chain broken, previous hash does not match", line, entry.Sequence)
+			}
+			if entry.Sequence != prev.Sequence+1 {
+				return fmt.Errorf("line %d (seq %d): sequence gap after %d", line, entry.Sequence, prev.Sequence)
+			}
+		}
+		prev = &entry
+	}
+	return scanner.Err()
+}
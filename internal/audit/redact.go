@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"regexp"
+)
+
+const redacted = "***REDACTED***"
+
+// sensitiveFlagPattern matches the value of Azure CLI flags that carry
+// secrets, e.g. "--password s3cret", "-p 's3cret'" or "--account-key=abc".
+// Flags are matched by name, so that every "*password*", "*secret*",
+// "*token*", "*-key", "--key-value" and "--sas*" flag is covered.
+var sensitiveFlagPattern = regexp.MustCompile(
+	`(?i)((?:^|\s)(?:-p|--value|--connection-string|--[a-z0-9-]*(?:password|secret|token)[a-z0-9-]*|` +
+		`--(?:[a-z0-9-]+-)?key(?:-value)?|--sas[a-z0-9-]*)(?:\s+|=))` +
+		`("[^"]*"|'[^']*'|\S+)`)
+
+// inlineSecretPatterns match secrets embedded in values, such as storage
+// connection strings, SAS signatures and bearer tokens.
+var inlineSecretPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)((?:AccountKey|SharedAccessKey|Password|Pwd)=)[^;"'\s]+`),
+	regexp.MustCompile(`(?i)([?&]sig=)[^&"'\s]+`),
+	regexp.MustCompile(`(?i)(Bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+}
+
+// Redact masks secrets in a command line or error message before it is
+// written to the audit log.
+func Redact(s string) string {
+	if s == "" {
+		return s
+	}
+	s = sensitiveFlagPattern.ReplaceAllString(s, "${1}"+redacted)
+	for _, pattern := range inlineSecretPatterns {
+		s = pattern.ReplaceAllString(s, "${1}"+redacted)
+	}
+	return s
+}
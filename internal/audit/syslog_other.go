@@ -0,0 +1,22 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"fmt"
+)
+
+// SyslogSink is not available on this platform.
+type SyslogSink struct{}
+
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	return nil, fmt.Errorf("syslog audit sink is not supported on this platform")
+}
+
+func (s *SyslogSink) Write(entry *Entry) error {
+	return fmt.Errorf("syslog audit sink is not supported on this platform")
+}
+
+func (s *SyslogSink) Close() error {
+	return nil
+}
@@ -0,0 +1,33 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"encoding/json"
+	"log/syslog"
+)
+
+// SyslogSink writes each entry as a JSON message to the local syslog daemon.
+type SyslogSink struct {
+	writer *syslog.Writer
+}
+
+func NewSyslogSink(tag string) (*SyslogSink, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogSink{writer: writer}, nil
+}
+
+func (s *SyslogSink) Write(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return s.writer.Info(string(data))
+}
+
+func (s *SyslogSink) Close() error {
+	return s.writer.Close()
+}
@@ -0,0 +1,301 @@
+// Package authn authenticates callers of the HTTP transports with static API
+// keys, JWT bearer tokens or TLS client certificates, and serves the OAuth protected resource metadata
+// (RFC 9728) that MCP clients use to discover how to obtain a token.
+package authn
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+	"gopkg.in/yaml.v3"
+)
+
+// MetadataPath is where the protected resource metadata is served.
+const MetadataPath = "/.well-known/oauth-protected-resource"
+
+// Authentication methods recorded in Principal.Method.
+const (
+	MethodAPIKey     = "api-key"
+	MethodJWT        = "jwt"
+	MethodClientCert = "client-cert"
+)
+
+var (
+	errMissingToken = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid API key or token")
+)
+
+// Principal is an authenticated caller.
+type Principal struct {
+	// Method is MethodAPIKey, MethodJWT or MethodClientCert.
+	Method string
+	// Subject is the name of the API key, the "sub" claim of the token, or
+	// the subject of the client certificate (e.g. "CN=ci,O=Contoso").
+	Subject string
+	// Issuer is the "iss" claim of the token or the issuer of the client
+	// certificate.
+	Issuer string
+	// Claims are the claims of the token; nil for API keys and client
+	// certificates.
+	Claims map[string]any
+}
+
+// String returns a display form such as "api-key:ci" or "jwt:<sub>".
+func (p *Principal) String() string {
+	if p == nil {
+		return ""
+	}
+	return p.Method + ":" + p.Subject
+}
+
+type contextKey struct{}
+
+// WithPrincipal returns a context carrying the authenticated caller.
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal set by WithPrincipal, or nil.
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(contextKey{}).(*Principal)
+	return principal
+}
+
+// APIKey is a static key that authenticates a caller as Name.
+type APIKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+// LoadAPIKeys reads API keys from a YAML file of the form
+//
+//	apiKeys:
+//	  - name: ci
+//	    key: "<secret>"
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read API keys file: %w", err)
+	}
+	var file struct {
+		APIKeys []APIKey `yaml:"apiKeys"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+	}
+	return file.APIKeys, nil
+}
+
+type Config struct {
+	APIKeys []APIKey
+	// JWT enables bearer tokens issued by an authorization server. When nil,
+	// only API keys are accepted.
+	JWT *JWTConfig
+	// ClientCertificates accepts verified TLS client certificates from
+	// requests without a bearer token. The certificates are verified during
+	// the TLS handshake (see NewTLSConfig).
+	ClientCertificates bool
+	// ResourceURL is the canonical URL of the MCP endpoint. When empty, it is
+	// derived from the Host header of each request and ResourcePath.
+	ResourceURL  string
+	ResourcePath string
+	// AuthorizationServers are advertised in the protected resource
+	// metadata (default: the JWT issuer).
+	AuthorizationServers []string
+}
+
+type hashedAPIKey struct {
+	name string
+	hash [sha256.Size]byte
+}
+
+// Authenticator checks the credentials of HTTP requests.
+type Authenticator struct {
+	apiKeys              []hashedAPIKey
+	jwt                  *jwtVerifier
+	clientCertificates   bool
+	resourceURL          string
+	resourcePath         string
+	authorizationServers []string
+}
+
+func New(config Config) (*Authenticator, error) {
+	a := &Authenticator{
+		resourceURL:          strings.TrimSuffix(config.ResourceURL, "/"),
+		resourcePath:         config.ResourcePath,
+		authorizationServers: config.AuthorizationServers,
+		clientCertificates:   config.ClientCertificates,
+	}
+
+	names := make(map[string]bool)
+	for _, key := range config.APIKeys {
+		if key.Name == "" || key.Key == "" {
+			return nil, fmt.Errorf("API keys need a name and a key")
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("duplicate API key name: %s", key.Name)
+		}
+		names[key.Name] = true
+		a.apiKeys = append(a.apiKeys, hashedAPIKey{name: key.Name, hash: sha256.Sum256([]byte(key.Key))})
+	}
+
+	if config.JWT != nil {
+		jwtConfig := *config.JWT
+		if jwtConfig.Audience == "" {
+			jwtConfig.Audience = a.resourceURL
+		}
+		verifier, err := newJWTVerifier(jwtConfig)
+		if err != nil {
+			return nil, err
+		}
+		a.jwt = verifier
+		if len(a.authorizationServers) == 0 && jwtConfig.Issuer != "" {
+			a.authorizationServers = []string{jwtConfig.Issuer}
+		}
+	}
+
+	if len(a.apiKeys) == 0 && a.jwt == nil && !a.clientCertificates {
+		return nil, fmt.Errorf("inbound authentication needs API keys, a JWT issuer or client certificates")
+	}
+	return a, nil
+}
+
+// Authenticate returns the caller of r. The credential is taken from the
+// "Authorization: Bearer" header, or from "X-API-Key". Requests without one
+// are authenticated by their verified client certificate, when accepted.
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := r.Header.Get("X-API-Key")
+	if scheme, credential, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		token = strings.TrimSpace(credential)
+	}
+	if token == "" {
+		if principal := a.clientCertificate(r); principal != nil {
+			return principal, nil
+		}
+		return nil, errMissingToken
+	}
+
+	if principal := a.apiKey(token); principal != nil {
+		return principal, nil
+	}
+	if a.jwt != nil && strings.Count(token, ".") == 2 {
+		return a.jwt.verify(r.Context(), token)
+	}
+	return nil, errInvalidToken
+}
+
+// apiKey compares token with every key in constant time.
+func (a *Authenticator) apiKey(token string) *Principal {
+	hash := sha256.Sum256([]byte(token))
+	var match *hashedAPIKey
+	for i := range a.apiKeys {
+		if subtle.ConstantTimeCompare(hash[:], a.apiKeys[i].hash[:]) == 1 {
+			match = &a.apiKeys[i]
+		}
+	}
+	if match == nil {
+		return nil
+	}
+	return &Principal{Method: MethodAPIKey, Subject: match.name}
+}
+
+// clientCertificate returns the subject of the client certificate verified
+// during the TLS handshake of r.
+func (a *Authenticator) clientCertificate(r *http.Request) *Principal {
+	if !a.clientCertificates || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	certificate := r.TLS.VerifiedChains[0][0]
+	return &Principal{
+		Method:  MethodClientCert,
+		Subject: certificate.Subject.String(),
+		Issuer:  certificate.Issuer.String(),
+	}
+}
+
+// Middleware rejects unauthenticated requests with 401 and a
+// WWW-Authenticate header pointing at the protected resource metadata, and
+// passes the principal of the others on in the request context.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			metrics.InboundAuth.Inc("failure")
+			challenge := fmt.Sprintf("Bearer resource_metadata=%q", a.metadataURL(r))
+			if !errors.Is(err, errMissingToken) {
+				logger.Warnf("Rejected request from %s: %v", r.RemoteAddr, err)
+				challenge += fmt.Sprintf(", error=\"invalid_token\", error_description=%q", err.Error())
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": err.Error()})
+			return
+		}
+		metrics.InboundAuth.Inc("success")
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// ProtectedResourceMetadata is the OAuth 2.0 protected resource metadata
+// document defined by RFC 9728.
+type ProtectedResourceMetadata struct {
+	Resource               string   `json:"resource"`
+	AuthorizationServers   []string `json:"authorization_servers,omitempty"`
+	BearerMethodsSupported []string `json:"bearer_methods_supported"`
+	ResourceName           string   `json:"resource_name,omitempty"`
+}
+
+// MetadataHandler serves the protected resource metadata at MetadataPath.
+func (a *Authenticator) MetadataHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, ProtectedResourceMetadata{
+			Resource:               a.resource(r),
+			AuthorizationServers:   a.authorizationServers,
+			BearerMethodsSupported: []string{"header"},
+			ResourceName:           "Azure API MCP",
+		})
+	})
+}
+
+func (a *Authenticator) resource(r *http.Request) string {
+	if a.resourceURL != "" {
+		return a.resourceURL
+	}
+	return baseURL(r) + a.resourcePath
+}
+
+func (a *Authenticator) metadataURL(r *http.Request) string {
+	if a.resourceURL != "" {
+		if scheme, rest, ok := strings.Cut(a.resourceURL, "://"); ok {
+			host, _, _ := strings.Cut(rest, "/")
+			return scheme + "://" + host + MetadataPath
+		}
+	}
+	return baseURL(r) + MetadataPath
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
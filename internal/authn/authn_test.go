@@ -0,0 +1,160 @@
+package authn
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadAPIKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.yaml")
+	if err := os.WriteFile(path, []byte("apiKeys:\n  - name: ci\n    key: secret-1\n  - name: ops\n    key: secret-2\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != (APIKey{Name: "ci", Key: "secret-1"}) || keys[1].Name != "ops" {
+		t.Errorf("LoadAPIKeys() = %+v", keys)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+	}{
+		{name: "nothing configured", config: Config{}},
+		{name: "key without name", config: Config{APIKeys: []APIKey{{Key: "k"}}}},
+		{name: "duplicate names", config: Config{APIKeys: []APIKey{{Name: "a", Key: "k1"}, {Name: "a", Key: "k2"}}}},
+		{name: "JWT without audience", config: Config{JWT: &JWTConfig{JWKSFile: "jwks.json"}}},
+	}
+	for _, tt := range tests {
+		if _, err := New(tt.config); err == nil {
+			t.Errorf("%s: New() error = nil", tt.name)
+		}
+	}
+}
+
+func TestAuthenticator_APIKey(t *testing.T) {
+	a, err := New(Config{APIKeys: []APIKey{{Name: "ci", Key: "secret-1"}, {Name: "ops", Key: "secret-2"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		subject string
+	}{
+		{name: "bearer", header: "Authorization", value: "Bearer secret-2", subject: "ops"},
+		{name: "lower-case scheme", header: "Authorization", value: "bearer secret-1", subject: "ci"},
+		{name: "X-API-Key", header: "X-API-Key", value: "secret-1", subject: "ci"},
+		{name: "wrong key", header: "Authorization", value: "Bearer secret-3"},
+		{name: "basic auth", header: "Authorization", value: "Basic secret-1"},
+		{name: "missing"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		if tt.header != "" {
+			r.Header.Set(tt.header, tt.value)
+		}
+		principal, err := a.Authenticate(r)
+		if tt.subject == "" {
+			if err == nil {
+				t.Errorf("%s: Authenticate() = %v, want error", tt.name, principal)
+			}
+			continue
+		}
+		if err != nil || principal.Method != MethodAPIKey || principal.Subject != tt.subject {
+			t.Errorf("%s: Authenticate() = %+v, %v", tt.name, principal, err)
+		}
+	}
+}
+
+func TestAuthenticator_Middleware(t *testing.T) {
+	a, err := New(Config{APIKeys: []APIKey{{Name: "ci", Key: "secret"}}, ResourcePath: "/mcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got *Principal
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFromContext(r.Context())
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "http://mcp.example.com/mcp", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("status without credentials = %d, want 401", w.Code)
+	}
+	if challenge := w.Header().Get("WWW-Authenticate"); challenge != `Bearer resource_metadata="http://mcp.example.com/.well-known/oauth-protected-resource"` {
+		t.Errorf("WWW-Authenticate = %q", challenge)
+	}
+
+	w = httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "http://mcp.example.com/mcp", nil)
+	r.Header.Set("Authorization", "Bearer wrong")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Header().Get("WWW-Authenticate"), `error="invalid_token"`) {
+		t.Errorf("invalid key: status = %d, WWW-Authenticate = %q", w.Code, w.Header().Get("WWW-Authenticate"))
+	}
+	if got != nil {
+		t.Error("rejected requests must not reach the handler")
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest(http.MethodPost, "http://mcp.example.com/mcp", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || got.String() != "api-key:ci" {
+		t.Errorf("valid key: status = %d, principal = %v", w.Code, got)
+	}
+}
+
+func TestAuthenticator_MetadataHandler(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       Config
+		wantResource string
+		wantServers  []string
+	}{
+		{
+			name:         "derived from request",
+			config:       Config{APIKeys: []APIKey{{Name: "ci", Key: "secret"}}, ResourcePath: "/mcp"},
+			wantResource: "http://mcp.example.com/mcp",
+		},
+		{
+			name:         "configured",
+			config:       Config{APIKeys: []APIKey{{Name: "ci", Key: "secret"}}, ResourceURL: "https://mcp.contoso.com/mcp/", AuthorizationServers: []string{"https://login.example.com"}},
+			wantResource: "https://mcp.contoso.com/mcp",
+			wantServers:  []string{"https://login.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		a, err := New(tt.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		a.MetadataHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://mcp.example.com"+MetadataPath, nil))
+
+		var metadata ProtectedResourceMetadata
+		if err := json.Unmarshal(w.Body.Bytes(), &metadata); err != nil {
+			t.Fatal(err)
+		}
+		if metadata.Resource != tt.wantResource || strings.Join(metadata.AuthorizationServers, ",") != strings.Join(tt.wantServers, ",") {
+			t.Errorf("%s: metadata = %+v", tt.name, metadata)
+		}
+		if len(metadata.BearerMethodsSupported) != 1 || metadata.BearerMethodsSupported[0] != "header" {
+			t.Errorf("%s: bearer_methods_supported = %v", tt.name, metadata.BearerMethodsSupported)
+		}
+	}
+}
@@ -0,0 +1,419 @@
+package authn
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+)
+
+const (
+	defaultJWTLeeway = time.Minute
+	// jwksMaxAge is how long fetched keys are used before they are fetched
+	// again. Key files are checked for changes at the same interval.
+	jwksMaxAge = time.Hour
+	// jwksMinRefresh bounds how often an unknown key ID triggers a refresh.
+	jwksMinRefresh = 30 * time.Second
+	maxJWKSSize    = 1024 * 1024
+)
+
+// JWTConfig validates bearer tokens signed with RS256 or ES256.
+type JWTConfig struct {
+	// Issuer is the required "iss" claim. Unless JWKSFile or JWKSURL is set,
+	// the signing keys are discovered from the issuer's OpenID configuration.
+	Issuer string
+	// Audience is the required "aud" claim (default: the resource URL).
+	Audience string
+	JWKSFile string
+	JWKSURL  string
+	// Leeway is the allowed clock skew for "exp" and "nbf" (default 1m).
+	Leeway     time.Duration
+	HTTPClient *http.Client
+}
+
+type jwtVerifier struct {
+	config JWTConfig
+	keys   *keySet
+	now    func() time.Time
+}
+
+func newJWTVerifier(config JWTConfig) (*jwtVerifier, error) {
+	if config.Audience == "" {
+		return nil, fmt.Errorf("JWT validation needs an audience or a resource URL")
+	}
+	if config.JWKSFile == "" && config.JWKSURL == "" && config.Issuer == "" {
+		return nil, fmt.Errorf("JWT validation needs a JWKS file, a JWKS URL or an issuer")
+	}
+	if config.Leeway <= 0 {
+		config.Leeway = defaultJWTLeeway
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	keys := &keySet{file: config.JWKSFile, url: config.JWKSURL, issuer: config.Issuer, client: config.HTTPClient}
+	if err := keys.refresh(context.Background()); err != nil {
+		// A key file must be valid at startup; an authorization server that
+		// is not reachable yet is retried on the first token.
+		if config.JWKSFile != "" {
+			return nil, err
+		}
+		logger.Warnf("Failed to fetch JWT signing keys, retrying on first use: %v", err)
+	}
+	return &jwtVerifier{config: config, keys: keys, now: time.Now}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// verify checks the signature and the registered claims of token.
+func (v *jwtVerifier) verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	if header.Alg != "RS256" && header.Alg != "ES256" {
+		return nil, fmt.Errorf("unsupported token algorithm: %q", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding")
+	}
+	key, err := v.keys.key(ctx, header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(key, header.Alg, digest[:], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+	issuer, _ := claims["iss"].(string)
+	return &Principal{Method: MethodJWT, Subject: subject, Issuer: issuer, Claims: claims}, nil
+}
+
+func (v *jwtVerifier) checkClaims(claims map[string]any) error {
+	now := v.now()
+
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return fmt.Errorf("token has no expiry")
+	}
+	if now.After(time.Unix(int64(exp), 0).Add(v.config.Leeway)) {
+		return fmt.Errorf("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(v.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return fmt.Errorf("token not valid yet")
+	}
+
+	if v.config.Issuer != "" {
+		if issuer, _ := claims["iss"].(string); issuer != v.config.Issuer {
+			return fmt.Errorf("token issuer %q is not trusted", issuer)
+		}
+	}
+
+	if !hasAudience(claims["aud"], v.config.Audience) {
+		return fmt.Errorf("token audience does not include %s", v.config.Audience)
+	}
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return fmt.Errorf("token has no subject")
+	}
+	return nil
+}
+
+// hasAudience reports whether the "aud" claim, a string or an array of
+// strings, contains audience.
+func hasAudience(claim any, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, value := range aud {
+			if value == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func verifySignature(key crypto.PublicKey, alg string, digest, signature []byte) error {
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("token key type does not match algorithm %s", alg)
+		}
+		if rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature) != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return fmt.Errorf("token key type does not match algorithm %s", alg)
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+	}
+	return nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// keySet holds the signing keys of a JWKS file or URL.
+type keySet struct {
+	file   string
+	url    string
+	issuer string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]crypto.PublicKey
+	unnamed   []crypto.PublicKey
+	fetchedAt time.Time
+	modTime   time.Time
+}
+
+// key returns the key with ID kid, refreshing the set when the key is
+// unknown or the set is stale. Tokens without a key ID may use any key of
+// the matching type.
+func (s *keySet) key(ctx context.Context, kid, alg string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := s.lookup(kid, alg)
+	stale := time.Since(s.fetchedAt) > jwksMaxAge
+	if (key == nil && time.Since(s.fetchedAt) > jwksMinRefresh) || stale {
+		if err := s.refreshLocked(ctx); err != nil {
+			logger.Warnf("Failed to refresh JWT signing keys: %v", err)
+		} else {
+			key = s.lookup(kid, alg)
+		}
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown token signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (s *keySet) lookup(kid, alg string) crypto.PublicKey {
+	if kid != "" {
+		return s.keys[kid]
+	}
+	for _, key := range s.unnamed {
+		if _, isRSA := key.(*rsa.PublicKey); isRSA == (alg == "RS256") {
+			return key
+		}
+	}
+	return nil
+}
+
+func (s *keySet) refresh(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refreshLocked(ctx)
+}
+
+// refreshLocked reloads the keys. A key file is only parsed again when it
+// changed. The caller must hold s.mu.
+func (s *keySet) refreshLocked(ctx context.Context) error {
+	s.fetchedAt = time.Now()
+
+	var data []byte
+	if s.file != "" {
+		info, err := os.Stat(s.file)
+		if err != nil {
+			return fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		if s.keys != nil && info.ModTime().Equal(s.modTime) {
+			return nil
+		}
+		if data, err = os.ReadFile(s.file); err != nil {
+			return fmt.Errorf("failed to read JWKS file: %w", err)
+		}
+		s.modTime = info.ModTime()
+	} else {
+		if s.url == "" {
+			jwksURL, err := s.discover(ctx)
+			if err != nil {
+				return err
+			}
+			s.url = jwksURL
+		}
+		var err error
+		if data, err = s.get(ctx, s.url); err != nil {
+			return fmt.Errorf("failed to fetch JWKS: %w", err)
+		}
+	}
+
+	keys, unnamed, err := parseJWKS(data)
+	if err != nil {
+		return err
+	}
+	s.keys, s.unnamed = keys, unnamed
+	logger.Debugf("Loaded %d JWT signing keys", len(keys)+len(unnamed))
+	return nil
+}
+
+// discover looks up the jwks_uri in the issuer's OpenID Connect discovery
+// document, or else in its OAuth authorization server metadata.
+func (s *keySet) discover(ctx context.Context) (string, error) {
+	issuer := strings.TrimSuffix(s.issuer, "/")
+	var lastErr error
+	for _, path := range []string{"/.well-known/openid-configuration", "/.well-known/oauth-authorization-server"} {
+		data, err := s.get(ctx, issuer+path)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		var metadata struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := json.Unmarshal(data, &metadata); err != nil || metadata.JWKSURI == "" {
+			lastErr = fmt.Errorf("%s%s has no jwks_uri", issuer, path)
+			continue
+		}
+		return metadata.JWKSURI, nil
+	}
+	return "", fmt.Errorf("failed to discover JWKS of issuer %s: %w", s.issuer, lastErr)
+}
+
+func (s *keySet) get(ctx context.Context, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned %s", url, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the RSA and P-256 signing keys of a JSON Web Key Set by
+// key ID, and those without an ID. Other keys are skipped.
+func parseJWKS(data []byte) (map[string]crypto.PublicKey, []crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	var unnamed []crypto.PublicKey
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			logger.Warnf("Skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		if key == nil {
+			continue
+		}
+		if k.Kid == "" {
+			unnamed = append(unnamed, key)
+		} else {
+			keys[k.Kid] = key
+		}
+	}
+	if len(keys) == 0 && len(unnamed) == 0 {
+		return nil, nil, errors.New("JWKS contains no usable RS256 or ES256 keys")
+	}
+	return keys, unnamed, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus")
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid exponent")
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, fmt.Errorf("RSA keys must have at least 2048 bits")
+		}
+		return key, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, errX := base64.RawURLEncoding.DecodeString(k.X)
+		y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+		if errX != nil || errY != nil || len(x) != 32 || len(y) != 32 {
+			return nil, fmt.Errorf("invalid P-256 coordinates")
+		}
+		// crypto/ecdh rejects points that are not on the curve.
+		if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+			return nil, fmt.Errorf("invalid P-256 point: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, nil
+	}
+}
@@ -0,0 +1,258 @@
+package authn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://login.example.com/tenant"
+	testAudience = "https://mcp.example.com/mcp"
+)
+
+type testKeys struct {
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) *testKeys {
+	t.Helper()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testKeys{rsa: rsaKey, ec: ecKey}
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func (k *testKeys) jwks() []byte {
+	ecX, ecY := make([]byte, 32), make([]byte, 32)
+	k.ec.X.FillBytes(ecX)
+	k.ec.Y.FillBytes(ecY)
+	data, _ := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(k.rsa.N.Bytes()), "e": b64(big.NewInt(int64(k.rsa.E)).Bytes())},
+		{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecX), "y": b64(ecY)},
+		{"kty": "oct", "kid": "hmac", "k": "c2VjcmV0"},
+	}})
+	return data
+}
+
+func (k *testKeys) sign(t *testing.T, alg, kid string, claims map[string]any) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	input := b64(header) + "." + b64(payload)
+	digest := sha256.Sum256([]byte(input))
+
+	var signature []byte
+	switch alg {
+	case "RS256":
+		var err error
+		if signature, err = rsa.SignPKCS1v15(rand.Reader, k.rsa, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case "ES256":
+		r, s, err := ecdsa.Sign(rand.Reader, k.ec, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	default:
+		signature = []byte("unsigned")
+	}
+	return input + "." + b64(signature)
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss": testIssuer,
+		"aud": []string{"other", testAudience},
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"nbf": time.Now().Add(-time.Minute).Unix(),
+	}
+}
+
+func writeJWKS(t *testing.T, keys *testKeys) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, keys.jwks(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func bearer(a *Authenticator, token string) (*Principal, error) {
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return a.Authenticate(r)
+}
+
+func TestAuthenticator_JWT(t *testing.T) {
+	keys := newTestKeys(t)
+	a, err := New(Config{
+		ResourceURL: testAudience,
+		JWT:         &JWTConfig{Issuer: testIssuer, JWKSFile: writeJWKS(t, keys)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	with := func(key string, value any) map[string]any {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, key)
+		} else {
+			claims[key] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr string
+	}{
+		{name: "RS256", token: keys.sign(t, "RS256", "rsa1", validClaims())},
+		{name: "ES256", token: keys.sign(t, "ES256", "ec1", validClaims())},
+		{name: "audience string", token: keys.sign(t, "RS256", "rsa1", with("aud", testAudience))},
+		{name: "expired", token: keys.sign(t, "RS256", "rsa1", with("exp", time.Now().Add(-time.Hour).Unix())), wantErr: "expired"},
+		{name: "no expiry", token: keys.sign(t, "RS256", "rsa1", with("exp", nil)), wantErr: "no expiry"},
+		{name: "not yet valid", token: keys.sign(t, "RS256", "rsa1", with("nbf", time.Now().Add(time.Hour).Unix())), wantErr: "not valid yet"},
+		{name: "wrong issuer", token: keys.sign(t, "RS256", "rsa1", with("iss", "https://evil.example.com")), wantErr: "not trusted"},
+		{name: "wrong audience", token: keys.sign(t, "RS256", "rsa1", with("aud", "other")), wantErr: "audience"},
+		{name: "no subject", token: keys.sign(t, "RS256", "rsa1", with("sub", nil)), wantErr: "subject"},
+		{name: "unknown key", token: keys.sign(t, "RS256", "rsa2", validClaims()), wantErr: "unknown token signing key"},
+		{name: "key of other type", token: keys.sign(t, "ES256", "rsa1", validClaims()), wantErr: "does not match"},
+		{name: "alg none", token: keys.sign(t, "none", "rsa1", validClaims()), wantErr: "unsupported"},
+		{name: "HS256", token: keys.sign(t, "HS256", "hmac", validClaims()), wantErr: "unsupported"},
+	}
+
+	for _, tt := range tests {
+		principal, err := bearer(a, tt.token)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if principal.Method != MethodJWT || principal.Subject != "user-1" || principal.Issuer != testIssuer || principal.Claims["sub"] != "user-1" {
+			t.Errorf("%s: principal = %+v", tt.name, principal)
+		}
+	}
+
+	// A token signed by another key with a known ID fails verification.
+	other := newTestKeys(t)
+	if _, err := bearer(a, other.sign(t, "RS256", "rsa1", validClaims())); err == nil || !strings.Contains(err.Error(), "invalid token signature") {
+		t.Errorf("forged token: error = %v", err)
+	}
+
+	// Tampering with the claims breaks the signature.
+	token := keys.sign(t, "RS256", "rsa1", validClaims())
+	parts := strings.Split(token, ".")
+	claims := validClaims()
+	claims["sub"] = "admin"
+	payload, _ := json.Marshal(claims)
+	if _, err := bearer(a, parts[0]+"."+b64(payload)+"."+parts[2]); err == nil {
+		t.Error("tampered token was accepted")
+	}
+}
+
+func TestAuthenticator_JWTDiscovery(t *testing.T) {
+	keys := newTestKeys(t)
+	var jwksRequests int
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{"issuer": srv.URL, "jwks_uri": srv.URL + "/keys"})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		jwksRequests++
+		_, _ = w.Write(keys.jwks())
+	})
+
+	a, err := New(Config{JWT: &JWTConfig{Issuer: srv.URL, Audience: testAudience}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := validClaims()
+	claims["iss"] = srv.URL
+	principal, err := bearer(a, keys.sign(t, "ES256", "ec1", claims))
+	if err != nil || principal.Subject != "user-1" {
+		t.Fatalf("Authenticate() = %+v, %v", principal, err)
+	}
+
+	// Unknown key IDs refresh the keys at most every jwksMinRefresh.
+	for i := 0; i < 3; i++ {
+		_, _ = bearer(a, keys.sign(t, "ES256", "rotated", claims))
+	}
+	if jwksRequests != 1 {
+		t.Errorf("JWKS requests = %d, want 1", jwksRequests)
+	}
+}
+
+func TestKeySet_ReloadsChangedFile(t *testing.T) {
+	keys := newTestKeys(t)
+	path := writeJWKS(t, keys)
+	a, err := New(Config{JWT: &JWTConfig{JWKSFile: path, Audience: testAudience}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestKeys(t)
+	if err := os.WriteFile(path, rotated.jwks(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	// Known key IDs keep using the loaded keys until they are stale.
+	if _, err := bearer(a, rotated.sign(t, "RS256", "rsa1", validClaims())); err == nil {
+		t.Error("token signed with the rotated key was accepted before the keys were reloaded")
+	}
+	a.jwt.keys.fetchedAt = time.Now().Add(-jwksMaxAge - time.Second)
+	if _, err := bearer(a, rotated.sign(t, "RS256", "rsa1", validClaims())); err != nil {
+		t.Errorf("token signed with the rotated key after refresh: %v", err)
+	}
+}
+
+func TestNew_InvalidJWKSFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, []byte(`{"keys":[{"kty":"oct","k":"c2VjcmV0"}]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := New(Config{JWT: &JWTConfig{JWKSFile: path, Audience: testAudience}}); err == nil {
+		t.Error("New() with a JWKS without usable keys should fail")
+	}
+}
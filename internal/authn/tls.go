@@ -0,0 +1,149 @@
+package authn
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+)
+
+// tlsReloadInterval is how often the certificate files are checked for
+// changes.
+const tlsReloadInterval = 10 * time.Second
+
+// TLSConfig configures TLS termination of the HTTP transports.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile holds the PEM certificates of the CAs that sign client
+	// certificates. When set, clients are asked for a certificate, and
+	// certificates that do not chain to these CAs fail the handshake.
+	ClientCAFile string
+}
+
+// NewTLSConfig returns a server TLS configuration that serves the
+// certificate in config and reloads it, and the client CAs, when their files
+// are replaced.
+func NewTLSConfig(config TLSConfig) (*tls.Config, error) {
+	if config.CertFile == "" || config.KeyFile == "" {
+		return nil, fmt.Errorf("TLS needs a certificate and a key file")
+	}
+	r := &certReloader{config: config}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		NextProtos:         []string{"h2", "http/1.1"},
+		GetConfigForClient: r.getConfigForClient,
+	}, nil
+}
+
+// certReloader keeps the TLS configuration of the files in config current.
+type certReloader struct {
+	config TLSConfig
+
+	mu        sync.Mutex
+	current   *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.config.CertFile, r.config.KeyFile}
+	if r.config.ClientCAFile != "" {
+		files = append(files, r.config.ClientCAFile)
+	}
+	return files
+}
+
+// load reads the certificate, key and client CAs into a new configuration.
+func (r *certReloader) load() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	certificate, err := tls.LoadX509KeyPair(r.config.CertFile, r.config.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		NextProtos:   []string{"h2", "http/1.1"},
+		Certificates: []tls.Certificate{certificate},
+	}
+	if r.config.ClientCAFile != "" {
+		// #nosec G304 - This is the intended behavior: load client CAs from user-specified path
+		data, err := os.ReadFile(r.config.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.config.ClientCAFile)
+		}
+		config.ClientCAs = pool
+		// Requests without a certificate still reach /health and /metrics;
+		// the authentication middleware rejects them on the MCP endpoints.
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	r.mu.Lock()
+	r.current = config
+	r.modTimes = modTimes
+	r.checkedAt = time.Now()
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *certReloader) stat() ([]time.Time, error) {
+	var modTimes []time.Time
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read TLS file: %w", err)
+		}
+		modTimes = append(modTimes, info.ModTime())
+	}
+	return modTimes, nil
+}
+
+// getConfigForClient returns the current configuration, reloading it first
+// when a file changed since the last check. Reload errors keep the previous
+// certificate in use.
+func (r *certReloader) getConfigForClient(*tls.ClientHelloInfo) (*tls.Config, error) {
+	r.mu.Lock()
+	current, modTimes := r.current, r.modTimes
+	stale := time.Since(r.checkedAt) >= tlsReloadInterval
+	if stale {
+		r.checkedAt = time.Now()
+	}
+	r.mu.Unlock()
+	if !stale {
+		return current, nil
+	}
+
+	changed, err := r.stat()
+	if err != nil {
+		logger.Warnf("Keeping the current TLS certificate: %v", err)
+		return current, nil
+	}
+	for i := range changed {
+		if !changed[i].Equal(modTimes[i]) {
+			if err := r.load(); err != nil {
+				logger.Warnf("Keeping the current TLS certificate: %v", err)
+				return current, nil
+			}
+			logger.Infof("Reloaded TLS certificate from %s", r.config.CertFile)
+			r.mu.Lock()
+			current = r.current
+			r.mu.Unlock()
+			break
+		}
+	}
+	return current, nil
+}
@@ -0,0 +1,204 @@
+package authn
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type testCert struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+// newTestCert issues a certificate for commonName, signed by parent or
+// self-signed when parent is nil.
+func newTestCert(t *testing.T, commonName string, parent *testCert, usage x509.ExtKeyUsage) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, _ := rand.Int(rand.Reader, big.NewInt(1<<62))
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"Contoso"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign
+	} else {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCert{cert: cert, key: key}
+}
+
+func (c *testCert) certPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+func (c *testCert) keyPEM(t *testing.T) []byte {
+	der, err := x509.MarshalECPrivateKey(c.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func (c *testCert) tlsCertificate() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{c.cert.Raw}, PrivateKey: c.key}
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTLS_ClientCertificates(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, "Test CA", nil, 0)
+	serverCert := newTestCert(t, "localhost", ca, x509.ExtKeyUsageServerAuth)
+	writeFile(t, filepath.Join(dir, "ca.pem"), ca.certPEM())
+	writeFile(t, filepath.Join(dir, "tls.crt"), serverCert.certPEM())
+	writeFile(t, filepath.Join(dir, "tls.key"), serverCert.keyPEM(t))
+
+	tlsConfig, err := NewTLSConfig(TLSConfig{
+		CertFile:     filepath.Join(dir, "tls.crt"),
+		KeyFile:      filepath.Join(dir, "tls.key"),
+		ClientCAFile: filepath.Join(dir, "ca.pem"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(Config{ClientCertificates: true, ResourcePath: "/mcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got *Principal
+	srv := httptest.NewUnstartedServer(a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = PrincipalFromContext(r.Context())
+	})))
+	srv.TLS = tlsConfig
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(certificates ...tls.Certificate) (int, error) {
+		clientConfig := &tls.Config{RootCAs: roots}
+		if len(certificates) > 0 {
+			// Send the certificate even when the server does not list its CA.
+			clientConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &certificates[0], nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+		resp, err := client.Get(srv.URL + "/mcp")
+		if err != nil {
+			return 0, err
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode, nil
+	}
+
+	clientCert := newTestCert(t, "ci", ca, x509.ExtKeyUsageClientAuth)
+	if status, err := get(clientCert.tlsCertificate()); err != nil || status != http.StatusOK {
+		t.Fatalf("trusted client certificate: status = %d, error = %v", status, err)
+	}
+	if got.String() != "client-cert:CN=ci,O=Contoso" || got.Issuer != "CN=Test CA,O=Contoso" {
+		t.Errorf("principal = %+v", got)
+	}
+
+	if status, err := get(); err != nil || status != http.StatusUnauthorized {
+		t.Errorf("no client certificate: status = %d, error = %v, want 401", status, err)
+	}
+
+	other := newTestCert(t, "Other CA", nil, 0)
+	if _, err := get(newTestCert(t, "ci", other, x509.ExtKeyUsageClientAuth).tlsCertificate()); err == nil {
+		t.Error("certificate of an untrusted CA passed the handshake")
+	}
+}
+
+func TestCertReloader_ReloadsChangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	ca := newTestCert(t, "Test CA", nil, 0)
+	first := newTestCert(t, "first", ca, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, first.certPEM())
+	writeFile(t, keyFile, first.keyPEM(t))
+
+	r := &certReloader{config: TLSConfig{CertFile: certFile, KeyFile: keyFile}}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	servedCommonName := func() string {
+		config, err := r.getConfigForClient(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, err := x509.ParseCertificate(config.Certificates[0].Certificate[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Subject.CommonName
+	}
+
+	second := newTestCert(t, "second", ca, x509.ExtKeyUsageServerAuth)
+	writeFile(t, certFile, second.certPEM())
+	writeFile(t, keyFile, second.keyPEM(t))
+	future := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, future, future); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Files are only checked every tlsReloadInterval.
+	if name := servedCommonName(); name != "first" {
+		t.Errorf("before the reload interval: serving %q, want first", name)
+	}
+	r.checkedAt = time.Now().Add(-tlsReloadInterval)
+	if name := servedCommonName(); name != "second" {
+		t.Errorf("after the reload interval: serving %q, want second", name)
+	}
+
+	// A broken replacement keeps the previous certificate in use.
+	writeFile(t, keyFile, []byte("not a key"))
+	later := future.Add(time.Minute)
+	if err := os.Chtimes(keyFile, later, later); err != nil {
+		t.Fatal(err)
+	}
+	r.checkedAt = time.Now().Add(-tlsReloadInterval)
+	if name := servedCommonName(); name != "second" {
+		t.Errorf("after a broken reload: serving %q, want second", name)
+	}
+}
@@ -9,17 +9,85 @@ import (
 	flag "github.com/spf13/pflag"
 )
 
+// maxRetainedOutputSize bounds the output kept in memory for a single command
+// when oversized output is truncated, paged or spilled.
+const maxRetainedOutputSize = 256 * 1024 * 1024
+
 type Config struct {
 	ReadOnlyMode         bool
 	EnableSecurityPolicy bool
+	DryRun               bool
 	Timeout              int
 	SecurityPolicyFile   string
 	ReadOnlyPatternsFile string
+	PolicyBindingsFile   string
 	Transport            string
 	Host                 string
 	Port                 int
 	LogLevel             string
 
+	TLSCert     string
+	TLSKey      string
+	TLSClientCA string
+
+	// ShutdownGracePeriod is how long in-flight tool calls may run after
+	// SIGTERM or SIGINT, in seconds.
+	ShutdownGracePeriod int
+
+	MaxConcurrent int
+	MaxQueued     int
+	QueueTimeout  int
+	MaxRetries    int
+
+	MaxOutputSize        int
+	OutputOverflow       string
+	AllowedOutputFormats []string
+
+	CacheTTL        int
+	CacheRules      []string
+	CacheDir        string
+	CacheMaxEntries int
+
+	// Rate limits in commands per minute; 0 is unlimited.
+	RateLimitSessionRead  int
+	RateLimitSessionWrite int
+	RateLimitClientRead   int
+	RateLimitClientWrite  int
+	RateLimitGlobalRead   int
+	RateLimitGlobalWrite  int
+
+	ApprovalMode       string
+	ApprovalTimeout    int
+	ApprovalWebhookURL string
+	ApprovalToken      string
+
+	APIKeysFile          string
+	JWTIssuer            string
+	JWTAudience          string
+	JWKSFile             string
+	JWKSURL              string
+	ResourceURL          string
+	AuthorizationServers []string
+
+	AuditLogFile    string
+	AuditSyslog     bool
+	AuditWebhookURL string
+
+	// AzureConfigDir is the root of the AZURE_CONFIG_DIR directories managed
+	// by the server; "" leaves az on its default directory.
+	AzureConfigDir      string
+	ConfigDirPerSession bool
+	// IdentitiesFile lists named identities that replace the identity
+	// configured by the auth flags and environment variables.
+	IdentitiesFile string
+	// AllowedIdentities are the identities, besides the default identity,
+	// that callers without a policy binding may select.
+	AllowedIdentities []string
+	// Cloud is the az cloud to log in to; "" keeps the cloud az is set to.
+	// CloudsFile defines custom clouds, such as Azure Stack Hub.
+	Cloud      string
+	CloudsFile string
+
 	SkipAuthSetup       bool
 	AuthMethod          string
 	TenantID            string
@@ -41,6 +109,21 @@ func NewConfig() *Config {
 		Port:                 8000,
 		LogLevel:             "info",
 
+		ShutdownGracePeriod: 25,
+
+		MaxConcurrent: 0,
+		MaxQueued:     32,
+		QueueTimeout:  60,
+		MaxRetries:    3,
+
+		MaxOutputSize:  10 * 1024 * 1024,
+		OutputOverflow: "truncate",
+
+		CacheMaxEntries: 1000,
+
+		ApprovalMode:    "none",
+		ApprovalTimeout: 300,
+
 		SkipAuthSetup: false,
 		AuthMethod:    "auto",
 	}
@@ -48,14 +131,56 @@ func NewConfig() *Config {
 
 func (c *Config) ParseFlags() error {
 	flag.BoolVar(&c.ReadOnlyMode, "readonly", c.ReadOnlyMode, "Enable read-only mode (only read operations allowed)")
-	flag.BoolVar(&c.EnableSecurityPolicy, "enable-security-policy", c.EnableSecurityPolicy, "Enable security policy enforcement (deny list)")
+	flag.BoolVar(&c.EnableSecurityPolicy, "enable-security-policy", c.EnableSecurityPolicy, "Enable security policy enforcement (rules that allow, deny or require approval for commands)")
+	flag.BoolVar(&c.DryRun, "dry-run", c.DryRun, "Validate call_az commands and return a dry-run report instead of executing them")
 	flag.IntVar(&c.Timeout, "timeout", c.Timeout, "Timeout for command execution in seconds")
 	flag.StringVar(&c.SecurityPolicyFile, "security-policy-file", c.SecurityPolicyFile, "Path to security policy YAML file")
 	flag.StringVar(&c.ReadOnlyPatternsFile, "readonly-patterns-file", c.ReadOnlyPatternsFile, "Path to read-only patterns YAML file")
+	flag.StringVar(&c.PolicyBindingsFile, "policy-bindings-file", c.PolicyBindingsFile, "Path to a YAML file mapping callers to named security policies")
 	flag.StringVar(&c.Transport, "transport", c.Transport, "Transport mechanism (stdio, sse, streamable-http)")
 	flag.StringVar(&c.Host, "host", c.Host, "Host to listen on (for non-stdio transport)")
 	flag.IntVar(&c.Port, "port", c.Port, "Port to listen on (for non-stdio transport)")
 	flag.StringVar(&c.LogLevel, "log-level", c.LogLevel, "Log level (debug, info, warn, error)")
+	flag.IntVar(&c.MaxConcurrent, "max-concurrent", c.MaxConcurrent, "Maximum number of az commands executing at once (0 for unlimited)")
+	flag.IntVar(&c.MaxQueued, "max-queued", c.MaxQueued, "Maximum number of commands waiting for an execution slot when max-concurrent is reached")
+	flag.IntVar(&c.QueueTimeout, "queue-timeout", c.QueueTimeout, "Maximum time a command waits for an execution slot in seconds")
+	flag.IntVar(&c.MaxRetries, "max-retries", c.MaxRetries, "Maximum automatic retries of read-only commands after throttled or transient failures (0 to disable)")
+	flag.IntVar(&c.MaxOutputSize, "max-output-size", c.MaxOutputSize, "Maximum size in bytes of command output returned in a single response")
+	flag.StringVar(&c.OutputOverflow, "output-overflow", c.OutputOverflow, "What to do with output larger than max-output-size (error, truncate, page, spill)")
+	flag.StringSliceVar(&c.AllowedOutputFormats, "allowed-output-formats", c.AllowedOutputFormats, "az --output values commands may use instead of json (jsonc, table, tsv, yaml, yamlc)")
+	flag.IntVar(&c.CacheTTL, "cache-ttl", c.CacheTTL, "Time in seconds to cache results of read-only commands (0 disables the cache unless a cache rule applies)")
+	flag.StringSliceVar(&c.CacheRules, "cache-rules", c.CacheRules, "Per-command cache TTLs as <command>=<ttl> (e.g. \"account show=5m\"); the first matching rule wins")
+	flag.StringVar(&c.CacheDir, "cache-dir", c.CacheDir, "Directory to persist cached results in (default: memory only)")
+	flag.IntVar(&c.CacheMaxEntries, "cache-max-entries", c.CacheMaxEntries, "Maximum number of cached results")
+	flag.IntVar(&c.RateLimitSessionRead, "rate-limit-session-read", c.RateLimitSessionRead, "Maximum read-only commands per minute per MCP session (0 for unlimited)")
+	flag.IntVar(&c.RateLimitSessionWrite, "rate-limit-session-write", c.RateLimitSessionWrite, "Maximum write commands per minute per MCP session (0 for unlimited)")
+	flag.IntVar(&c.RateLimitClientRead, "rate-limit-client-read", c.RateLimitClientRead, "Maximum read-only commands per minute per client (0 for unlimited)")
+	flag.IntVar(&c.RateLimitClientWrite, "rate-limit-client-write", c.RateLimitClientWrite, "Maximum write commands per minute per client (0 for unlimited)")
+	flag.IntVar(&c.RateLimitGlobalRead, "rate-limit-global-read", c.RateLimitGlobalRead, "Maximum read-only commands per minute for the whole server (0 for unlimited)")
+	flag.IntVar(&c.RateLimitGlobalWrite, "rate-limit-global-write", c.RateLimitGlobalWrite, "Maximum write commands per minute for the whole server (0 for unlimited)")
+	flag.StringVar(&c.ApprovalMode, "approval-mode", c.ApprovalMode, "Approval workflow for commands matched by require-approval policy rules (none, elicitation, http, webhook)")
+	flag.IntVar(&c.ApprovalTimeout, "approval-timeout", c.ApprovalTimeout, "Default time to wait for an approval decision in seconds")
+	flag.StringVar(&c.ApprovalWebhookURL, "approval-webhook-url", c.ApprovalWebhookURL, "URL to POST approval requests to (for approval-mode webhook)")
+	flag.IntVar(&c.ShutdownGracePeriod, "shutdown-grace-period", c.ShutdownGracePeriod, "Time in seconds that in-flight tool calls may run after SIGTERM or SIGINT before they are cancelled")
+	flag.StringVar(&c.TLSCert, "tls-cert", c.TLSCert, "Path to the PEM certificate served by the HTTP transports; enables TLS")
+	flag.StringVar(&c.TLSKey, "tls-key", c.TLSKey, "Path to the PEM private key of tls-cert")
+	flag.StringVar(&c.TLSClientCA, "tls-client-ca", c.TLSClientCA, "Path to PEM CA certificates that sign client certificates; enables mutual TLS and authenticates callers by certificate subject")
+	flag.StringVar(&c.APIKeysFile, "api-keys-file", c.APIKeysFile, "Path to a YAML file of API keys accepted by the HTTP transports")
+	flag.StringVar(&c.JWTIssuer, "jwt-issuer", c.JWTIssuer, "Issuer of JWT bearer tokens accepted by the HTTP transports; its signing keys are discovered unless jwks-file or jwks-url is set")
+	flag.StringVar(&c.JWTAudience, "jwt-audience", c.JWTAudience, "Required audience of JWT bearer tokens (default: resource-url)")
+	flag.StringVar(&c.JWKSFile, "jwks-file", c.JWKSFile, "Path to a JWKS file with the keys that sign JWT bearer tokens")
+	flag.StringVar(&c.JWKSURL, "jwks-url", c.JWKSURL, "URL of the JWKS with the keys that sign JWT bearer tokens")
+	flag.StringVar(&c.ResourceURL, "resource-url", c.ResourceURL, "Canonical URL of the MCP endpoint, advertised in the protected resource metadata (default: derived from each request)")
+	flag.StringSliceVar(&c.AuthorizationServers, "authorization-servers", c.AuthorizationServers, "Authorization servers advertised in the protected resource metadata (default: jwt-issuer)")
+	flag.StringVar(&c.AuditLogFile, "audit-log-file", c.AuditLogFile, "Path to an append-only JSON-lines audit log of every call_az invocation")
+	flag.BoolVar(&c.AuditSyslog, "audit-syslog", c.AuditSyslog, "Write audit entries to the local syslog daemon")
+	flag.StringVar(&c.AuditWebhookURL, "audit-webhook-url", c.AuditWebhookURL, "URL to POST audit entries to")
+	flag.StringVar(&c.AzureConfigDir, "azure-config-dir", c.AzureConfigDir, "Directory for the az configuration managed by the server; each identity logs in to its own AZURE_CONFIG_DIR below it (default: the default directory of az)")
+	flag.BoolVar(&c.ConfigDirPerSession, "config-dir-per-session", c.ConfigDirPerSession, "Give each MCP session its own AZURE_CONFIG_DIR cloned from the identity's login, removed when the session ends (requires azure-config-dir)")
+	flag.StringVar(&c.IdentitiesFile, "identities-file", c.IdentitiesFile, "Path to a YAML file of named Azure identities that call_az can run commands as (requires azure-config-dir)")
+	flag.StringSliceVar(&c.AllowedIdentities, "allowed-identities", c.AllowedIdentities, "Glob patterns of the identities from identities-file that callers of the server-wide policy may select besides the default identity (default: none)")
+	flag.StringVar(&c.Cloud, "cloud", c.Cloud, "Azure cloud to log in to (AzureCloud, AzureUSGovernment, AzureChinaCloud or a cloud from clouds-file); identities may override it (default: the cloud az is set to)")
+	flag.StringVar(&c.CloudsFile, "clouds-file", c.CloudsFile, "Path to a YAML file of custom cloud endpoints, such as Azure Stack Hub, registered with az before login")
 	flag.StringVar(&c.AuthMethod, "auth-method", c.AuthMethod, "Authentication method (auto, workload-identity, managed-identity, service-principal)")
 
 	showHelp := flag.BoolP("help", "h", false, "Show help message")
@@ -82,6 +207,10 @@ func (c *Config) ParseFlags() error {
 
 	c.loadAuthFromEnv()
 
+	if token := os.Getenv("AZ_API_MCP_APPROVAL_TOKEN"); token != "" {
+		c.ApprovalToken = token
+	}
+
 	return c.Validate()
 }
 
@@ -96,6 +225,12 @@ func (c *Config) loadAuthFromEnv() {
 		}
 	}
 
+	if c.Cloud == "" {
+		if cloud := os.Getenv("AZ_CLOUD"); cloud != "" {
+			c.Cloud = cloud
+		}
+	}
+
 	if tenantID := os.Getenv("AZURE_TENANT_ID"); tenantID != "" {
 		c.TenantID = tenantID
 	}
@@ -132,9 +267,175 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid transport: %s (must be stdio, sse, or streamable-http)", c.Transport)
 	}
 
+	if c.MaxConcurrent < 0 {
+		return fmt.Errorf("max-concurrent must not be negative")
+	}
+
+	if c.MaxQueued < 0 {
+		return fmt.Errorf("max-queued must not be negative")
+	}
+
+	if c.QueueTimeout <= 0 {
+		return fmt.Errorf("queue timeout must be greater than 0")
+	}
+
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max-retries must not be negative")
+	}
+
+	if c.ShutdownGracePeriod < 0 {
+		return fmt.Errorf("shutdown-grace-period must not be negative")
+	}
+
+	if c.MaxOutputSize <= 0 {
+		return fmt.Errorf("max-output-size must be greater than 0")
+	}
+
+	switch c.OutputOverflow {
+	case "error", "truncate", "page", "spill":
+	default:
+		return fmt.Errorf("invalid output overflow mode: %s (must be error, truncate, page, or spill)", c.OutputOverflow)
+	}
+
+	for _, format := range c.AllowedOutputFormats {
+		switch format {
+		case "json", "jsonc", "none", "table", "tsv", "yaml", "yamlc":
+		default:
+			return fmt.Errorf("invalid allowed output format: %s (must be jsonc, table, tsv, yaml, or yamlc)", format)
+		}
+	}
+
+	if c.CacheTTL < 0 {
+		return fmt.Errorf("cache-ttl must not be negative")
+	}
+
+	if c.CacheMaxEntries <= 0 {
+		return fmt.Errorf("cache-max-entries must be greater than 0")
+	}
+
+	for name, limit := range map[string]int{
+		"rate-limit-session-read":  c.RateLimitSessionRead,
+		"rate-limit-session-write": c.RateLimitSessionWrite,
+		"rate-limit-client-read":   c.RateLimitClientRead,
+		"rate-limit-client-write":  c.RateLimitClientWrite,
+		"rate-limit-global-read":   c.RateLimitGlobalRead,
+		"rate-limit-global-write":  c.RateLimitGlobalWrite,
+	} {
+		if limit < 0 {
+			return fmt.Errorf("%s must not be negative", name)
+		}
+	}
+
+	if c.ConfigDirPerSession && c.AzureConfigDir == "" {
+		return fmt.Errorf("config-dir-per-session requires azure-config-dir")
+	}
+
+	if c.IdentitiesFile != "" && c.AzureConfigDir == "" {
+		return fmt.Errorf("identities-file requires azure-config-dir, so that each identity logs in to its own directory")
+	}
+
+	if len(c.AllowedIdentities) > 0 && c.IdentitiesFile == "" {
+		return fmt.Errorf("allowed-identities requires identities-file")
+	}
+
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		return fmt.Errorf("tls-cert and tls-key must be set together")
+	}
+
+	if c.TLSClientCA != "" && !c.TLSEnabled() {
+		return fmt.Errorf("tls-client-ca requires tls-cert and tls-key")
+	}
+
+	if c.TLSEnabled() && c.Transport == "stdio" {
+		return fmt.Errorf("TLS requires the sse or streamable-http transport")
+	}
+
+	if c.InboundAuthEnabled() && c.Transport == "stdio" {
+		return fmt.Errorf("api-keys-file and JWT validation require the sse or streamable-http transport")
+	}
+
+	if c.JWTEnabled() && c.JWTAudience == "" && c.ResourceURL == "" {
+		return fmt.Errorf("jwt-audience or resource-url is required for JWT validation")
+	}
+
+	switch c.ApprovalMode {
+	case "none":
+	case "elicitation":
+		if c.Transport == "sse" {
+			return fmt.Errorf("approval-mode elicitation is not supported with the sse transport")
+		}
+	case "http":
+		if c.Transport == "stdio" {
+			return fmt.Errorf("approval-mode http requires the sse or streamable-http transport")
+		}
+		// Without a token, the MCP client whose command waits for approval
+		// could approve it itself.
+		if c.ApprovalToken == "" {
+			return fmt.Errorf("approval-mode http requires AZ_API_MCP_APPROVAL_TOKEN")
+		}
+	case "webhook":
+		if c.ApprovalWebhookURL == "" {
+			return fmt.Errorf("approval-webhook-url is required for approval-mode webhook")
+		}
+	default:
+		return fmt.Errorf("invalid approval mode: %s (must be none, elicitation, http, or webhook)", c.ApprovalMode)
+	}
+
+	if c.ApprovalTimeout <= 0 {
+		return fmt.Errorf("approval timeout must be greater than 0")
+	}
+
 	return nil
 }
 
+// JWTEnabled reports whether JWT bearer tokens are accepted.
+func (c *Config) JWTEnabled() bool {
+	return c.JWTIssuer != "" || c.JWKSFile != "" || c.JWKSURL != ""
+}
+
+// InboundAuthEnabled reports whether callers of the HTTP transports must
+// authenticate.
+func (c *Config) InboundAuthEnabled() bool {
+	return c.APIKeysFile != "" || c.JWTEnabled() || c.TLSClientCA != ""
+}
+
+// TLSEnabled reports whether the HTTP transports serve TLS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCert != ""
+}
+
+// AuditEnabled reports whether at least one audit sink is configured.
+func (c *Config) AuditEnabled() bool {
+	return c.AuditLogFile != "" || c.AuditSyslog || c.AuditWebhookURL != ""
+}
+
+func (c *Config) ApprovalTimeoutDuration() time.Duration {
+	return time.Duration(c.ApprovalTimeout) * time.Second
+}
+
+// ExecutorMaxOutputSize returns the output size at which execution fails.
+// Unless oversized output is an error, the executor accepts output up to
+// maxRetainedOutputSize so that it can be truncated, paged or spilled.
+func (c *Config) ExecutorMaxOutputSize() int64 {
+	if c.OutputOverflow == "error" {
+		return int64(c.MaxOutputSize)
+	}
+	return max(int64(c.MaxOutputSize), maxRetainedOutputSize)
+}
+
+func (c *Config) QueueTimeoutDuration() time.Duration {
+	return time.Duration(c.QueueTimeout) * time.Second
+}
+
+func (c *Config) ShutdownGracePeriodDuration() time.Duration {
+	return time.Duration(c.ShutdownGracePeriod) * time.Second
+}
+
 func (c *Config) TimeoutDuration() time.Duration {
 	return time.Duration(c.Timeout) * time.Second
 }
+
+// CacheEnabled reports whether read-only results may be cached.
+func (c *Config) CacheEnabled() bool {
+	return c.CacheTTL > 0 || len(c.CacheRules) > 0
+}
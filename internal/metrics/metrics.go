@@ -0,0 +1,135 @@
+// Package metrics exposes server metrics in the Prometheus text format
+// without depending on a Prometheus client library.
+package metrics
+
+import (
+	"net/http"
+)
+
+var defaultRegistry = NewRegistry()
+
+var (
+	// Invocations counts call_az invocations by top-level command group
+	// (e.g. "vm") and audit outcome.
+	Invocations = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_call_az_invocations_total",
+		"call_az invocations by command group and outcome.",
+		"group", "outcome")
+
+	// ValidationDenials counts commands rejected before execution, by error
+	// type and reason (the matching policy rule or the validation layer).
+	ValidationDenials = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_validation_denials_total",
+		"Commands rejected before execution by error type and reason.",
+		"error_type", "reason")
+
+	// ExitCodes counts completed az processes by exit code.
+	ExitCodes = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_command_exit_codes_total",
+		"Completed az commands by command group and exit code.",
+		"group", "code")
+
+	// ExecutionErrors counts executions that failed without an exit code,
+	// such as timeouts or authentication errors.
+	ExecutionErrors = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_command_errors_total",
+		"az executions that failed without an exit code by error type.",
+		"group", "error_type")
+
+	// Duration observes the wall-clock time of az executions.
+	Duration = defaultRegistry.NewHistogramVec(
+		"azure_api_mcp_command_duration_seconds",
+		"Execution time of az commands in seconds.",
+		[]float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+		"group")
+
+	// OutputBytes observes the size of az stdout.
+	OutputBytes = defaultRegistry.NewHistogramVec(
+		"azure_api_mcp_command_output_bytes",
+		"Size of az command output in bytes.",
+		[]float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304, 16777216},
+		"group")
+
+	// AuthRelogins counts re-authentication attempts after auth errors, by
+	// result ("success" or "failure").
+	AuthRelogins = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_auth_relogin_attempts_total",
+		"Re-authentication attempts after az reported an authentication error.",
+		"result")
+
+	// CredentialRefreshes counts refreshes of the Azure credentials by reason
+	// ("expiry", "token_file" or "auth_error") and result.
+	CredentialRefreshes = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_credential_refreshes_total",
+		"Refreshes of the Azure credentials of az by reason and result.",
+		"reason", "result")
+
+	// Retries counts automatic retries by command group and the error type
+	// that caused them.
+	Retries = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_command_retries_total",
+		"Automatic retries of az commands by command group and error type.",
+		"group", "error_type")
+
+	// CacheLookups counts result cache lookups by result ("hit" or "miss").
+	CacheLookups = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_cache_lookups_total",
+		"Result cache lookups of read-only commands by result.",
+		"result")
+
+	// Coalesced counts read-only commands that joined an identical command
+	// already in flight instead of starting their own az process.
+	Coalesced = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_coalesced_commands_total",
+		"Read-only commands served by an identical command already in flight.",
+		"group")
+
+	// RateLimited counts commands rejected by a rate limit, by the scope of
+	// the exhausted budget and the kind of command ("read" or "write").
+	RateLimited = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_rate_limited_total",
+		"Commands rejected by a rate limit by scope and kind.",
+		"scope", "kind")
+
+	// InboundAuth counts authentication attempts on the HTTP transports by
+	// result ("success" or "failure").
+	InboundAuth = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_inbound_auth_total",
+		"Authentication attempts of HTTP clients by result.",
+		"result")
+
+	// InFlight is the number of az commands currently executing.
+	InFlight = defaultRegistry.NewGauge(
+		"azure_api_mcp_commands_in_flight",
+		"Number of az commands currently executing.")
+
+	// CredentialExpiry is when the current Azure access token of each
+	// identity expires.
+	CredentialExpiry = defaultRegistry.NewGaugeVec(
+		"azure_api_mcp_credential_expiry_timestamp_seconds",
+		"Unix time at which the current Azure access token of az expires by identity.",
+		"identity")
+
+	// QueueDepth is the number of commands waiting for an execution slot.
+	QueueDepth = defaultRegistry.NewGauge(
+		"azure_api_mcp_execution_queue_depth",
+		"Number of commands waiting for an execution slot.")
+
+	// QueueWait observes how long queued commands waited for a slot.
+	QueueWait = defaultRegistry.NewHistogramVec(
+		"azure_api_mcp_execution_queue_wait_seconds",
+		"Time queued commands waited for an execution slot in seconds.",
+		[]float64{0.1, 0.5, 1, 5, 10, 30, 60, 120})
+
+	// QueueRejections counts commands that never got an execution slot, by
+	// reason ("full", "timeout" or "cancelled").
+	QueueRejections = defaultRegistry.NewCounterVec(
+		"azure_api_mcp_execution_queue_rejections_total",
+		"Commands that did not get an execution slot by reason.",
+		"reason")
+)
+
+// Handler serves the default registry.
+func Handler() http.Handler {
+	return defaultRegistry.Handler()
+}
@@ -0,0 +1,125 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func scrape(t *testing.T, registry *Registry) string {
+	t.Helper()
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+
+	resp, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRegistry_Exposition(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("test_requests_total", "Requests.", "group", "outcome")
+	gauge := registry.NewGauge("test_in_flight", "In flight.")
+	gaugeVec := registry.NewGaugeVec("test_expiry_seconds", "Expiry.", "identity")
+	histogram := registry.NewHistogramVec("test_duration_seconds", "Duration.", []float64{1, 0.5}, "group")
+
+	counter.Inc("vm", "allowed")
+	counter.Inc("vm", "allowed")
+	counter.Add(3, "aks", `de"nied`)
+	gauge.Inc()
+	gauge.Inc()
+	gauge.Dec()
+	gaugeVec.Set(20, "reader")
+	gaugeVec.Set(10, "deployer")
+	gaugeVec.Set(30, "reader")
+	histogram.Observe(0.2, "vm")
+	histogram.Observe(0.7, "vm")
+	histogram.Observe(4, "vm")
+
+	body := scrape(t, registry)
+	want := []string{
+		"# HELP test_requests_total Requests.",
+		"# TYPE test_requests_total counter",
+		`test_requests_total{group="aks",outcome="de\"nied"} 3`,
+		`test_requests_total{group="vm",outcome="allowed"} 2`,
+		"# TYPE test_in_flight gauge",
+		"test_in_flight 1",
+		"# TYPE test_expiry_seconds gauge",
+		`test_expiry_seconds{identity="deployer"} 10`,
+		`test_expiry_seconds{identity="reader"} 30`,
+		"# TYPE test_duration_seconds histogram",
+		`test_duration_seconds_bucket{group="vm",le="0.5"} 1`,
+		`test_duration_seconds_bucket{group="vm",le="1"} 2`,
+		`test_duration_seconds_bucket{group="vm",le="+Inf"} 3`,
+		`test_duration_seconds_sum{group="vm"} 4.9`,
+		`test_duration_seconds_count{group="vm"} 3`,
+	}
+	for _, line := range want {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("exposition missing %q:\n%s", line, body)
+		}
+	}
+
+	if strings.Index(body, `group="aks"`) > strings.Index(body, `group="vm"`) {
+		t.Error("series should be sorted by label values")
+	}
+}
+
+func TestCounterVec_BoundsSeries(t *testing.T) {
+	registry := NewRegistry()
+	counter := registry.NewCounterVec("test_total", "Test.", "group")
+
+	for i := 0; i < maxSeries+10; i++ {
+		counter.Inc(fmt.Sprintf("group-%d", i))
+	}
+
+	if got := counter.Value(overflowLabel); got != 10 {
+		t.Errorf("overflow series = %v, want 10", got)
+	}
+	if got := strings.Count(scrape(t, registry), "test_total{"); got != maxSeries+1 {
+		t.Errorf("exposed %d series, want %d", got, maxSeries+1)
+	}
+}
+
+func TestCounterVec_WrongLabelCountPanics(t *testing.T) {
+	counter := NewRegistry().NewCounterVec("test_total", "Test.", "group", "outcome")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with the wrong number of labels should panic")
+		}
+	}()
+	counter.Inc("vm")
+}
+
+func TestDefaultHandler(t *testing.T) {
+	InFlight.Inc()
+	defer InFlight.Dec()
+
+	body := scrape(t, defaultRegistry)
+	for _, name := range []string{
+		"azure_api_mcp_call_az_invocations_total",
+		"azure_api_mcp_validation_denials_total",
+		"azure_api_mcp_command_exit_codes_total",
+		"azure_api_mcp_command_duration_seconds",
+		"azure_api_mcp_command_output_bytes",
+		"azure_api_mcp_auth_relogin_attempts_total",
+		"azure_api_mcp_commands_in_flight 1",
+	} {
+		if !strings.Contains(body, name) {
+			t.Errorf("default registry missing %s", name)
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxSeries bounds the number of label combinations a single metric keeps.
+// Further combinations are folded into one series whose labels are all
+// overflowLabel, so label values taken from requests cannot grow memory
+// without bound.
+const maxSeries = 500
+
+const overflowLabel = "_overflow_"
+
+// Registry holds metrics and renders them in the Prometheus text exposition
+// format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []collector
+}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, c)
+}
+
+// WritePrometheus writes every registered metric in registration order.
+func (r *Registry) WritePrometheus(w io.Writer) {
+	r.mu.Lock()
+	metrics := append([]collector(nil), r.metrics...)
+	r.mu.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Handler serves the registry for Prometheus scrapes.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WritePrometheus(w)
+	})
+}
+
+// series maps label values to per-series state, keeping at most maxSeries
+// entries.
+type series[T any] struct {
+	labels []string
+	values map[string]*T
+	keys   map[string][]string
+}
+
+func newSeries[T any](labels []string) series[T] {
+	return series[T]{labels: labels, values: make(map[string]*T), keys: make(map[string][]string)}
+}
+
+// get returns the state for labelValues, creating it with create. The caller
+// must hold the metric's lock.
+func (s *series[T]) get(labelValues []string, create func() *T) *T {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(s.labels), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+	if value, ok := s.values[key]; ok {
+		return value
+	}
+
+	if len(s.values) >= maxSeries {
+		overflow := make([]string, len(s.labels))
+		for i := range overflow {
+			overflow[i] = overflowLabel
+		}
+		labelValues = overflow
+		key = strings.Join(labelValues, "\xff")
+		if value, ok := s.values[key]; ok {
+			return value
+		}
+	}
+
+	value := create()
+	s.values[key] = value
+	s.keys[key] = append([]string(nil), labelValues...)
+	return value
+}
+
+// sorted calls fn for every series ordered by label values.
+func (s *series[T]) sorted(fn func(labelValues []string, value *T)) {
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fn(s.keys[key], s.values[key])
+	}
+}
+
+// CounterVec is a set of counters partitioned by labels.
+type CounterVec struct {
+	name   string
+	help   string
+	mu     sync.Mutex
+	series series[float64]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, series: newSeries[float64](labels)}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add increases the counter by v, which must not be negative.
+func (c *CounterVec) Add(v float64, labelValues ...string) {
+	if v < 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	*c.series.get(labelValues, func() *float64 { return new(float64) }) += v
+}
+
+// Value returns the current value of one counter.
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if value, ok := c.series.values[strings.Join(labelValues, "\xff")]; ok {
+		return *value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.name, c.help, "counter")
+	c.series.sorted(func(labelValues []string, value *float64) {
+		writeSample(w, c.name, c.series.labels, labelValues, "", "", *value)
+	})
+}
+
+// Gauge is a single value that can go up and down.
+type Gauge struct {
+	name  string
+	help  string
+	mu    sync.Mutex
+	value float64
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	g := &Gauge{name: name, help: help}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Add(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value += v
+}
+
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.value = v
+}
+
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.value
+}
+
+func (g *Gauge) write(w io.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	writeSample(w, g.name, nil, nil, "", "", g.Value())
+}
+
+// GaugeVec is a set of gauges partitioned by labels.
+type GaugeVec struct {
+	name   string
+	help   string
+	mu     sync.Mutex
+	series series[float64]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, series: newSeries[float64](labels)}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(v float64, labelValues ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	*g.series.get(labelValues, func() *float64 { return new(float64) }) = v
+}
+
+// Value returns the current value of one gauge.
+func (g *GaugeVec) Value(labelValues ...string) float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if value, ok := g.series.values[strings.Join(labelValues, "\xff")]; ok {
+		return *value
+	}
+	return 0
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.name, g.help, "gauge")
+	g.series.sorted(func(labelValues []string, value *float64) {
+		writeSample(w, g.name, g.series.labels, labelValues, "", "", *value)
+	})
+}
+
+// HistogramVec is a set of histograms with the same buckets, partitioned by
+// labels.
+type HistogramVec struct {
+	name    string
+	help    string
+	buckets []float64
+	mu      sync.Mutex
+	series  series[histogram]
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogramVec creates a histogram with the given upper bucket bounds. An
+// implicit +Inf bucket is always added.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{name: name, help: help, buckets: buckets, series: newSeries[histogram](labels)}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(v float64, labelValues ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	hist := h.series.get(labelValues, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	})
+	for i, bound := range h.buckets {
+		if v <= bound {
+			hist.counts[i]++
+		}
+	}
+	hist.count++
+	hist.sum += v
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.name, h.help, "histogram")
+	h.series.sorted(func(labelValues []string, hist *histogram) {
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.series.labels, labelValues, "le", formatFloat(bound), float64(hist.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.series.labels, labelValues, "le", "+Inf", float64(hist.count))
+		writeSample(w, h.name+"_sum", h.series.labels, labelValues, "", "", hist.sum)
+		writeSample(w, h.name+"_count", h.series.labels, labelValues, "", "", float64(hist.count))
+	})
+}
+
+func writeHeader(w io.Writer, name, help, metricType string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n", name, strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help))
+	_, _ = fmt.Fprintf(w, "# TYPE %s %s\n", name, metricType)
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, value float64) {
+	var pairs []string
+	for i, label := range labels {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, label, escapeLabelValue(labelValues[i])))
+	}
+	if extraLabel != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraLabel, escapeLabelValue(extraValue)))
+	}
+
+	if len(pairs) == 0 {
+		_, _ = fmt.Fprintf(w, "%s %s\n", name, formatFloat(value))
+		return
+	}
+	_, _ = fmt.Fprintf(w, "%s{%s} %s\n", name, strings.Join(pairs, ","), formatFloat(value))
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
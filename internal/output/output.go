@@ -0,0 +1,391 @@
+// Package output handles az output that is larger than the configured limit
+// for a single tool response.
+package output
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/pkg/azcli"
+)
+
+// Mode selects what happens to output larger than the limit.
+type Mode string
+
+const (
+	// ModeError fails the call, discarding the output.
+	ModeError Mode = "error"
+	// ModeTruncate returns the first Limit bytes followed by a marker.
+	ModeTruncate Mode = "truncate"
+	// ModePage returns the first page and keeps the rest server-side under a
+	// handle that can be read page by page.
+	ModePage Mode = "page"
+	// ModeSpill returns the first Limit bytes and writes the complete output
+	// to a temporary file exposed as an MCP resource.
+	ModeSpill Mode = "spill"
+)
+
+// ResourceURIPrefix is the URI prefix of spilled outputs exposed as MCP
+// resources.
+const ResourceURIPrefix = "azure-api-mcp://output/"
+
+// maxStoredOutputs bounds the number of paged or spilled outputs kept at once.
+// The oldest entry is evicted when a new one is stored.
+const maxStoredOutputs = 64
+
+var (
+	// ErrNotFound is returned for unknown, expired or foreign handles.
+	ErrNotFound = errors.New("output not found or expired")
+	// ErrPageOutOfRange is returned for page numbers beyond the last page.
+	ErrPageOutOfRange = errors.New("page out of range")
+)
+
+type Config struct {
+	Mode  Mode
+	Limit int
+	// TTL is how long paged and spilled outputs are kept (default 15m).
+	TTL time.Duration
+}
+
+// Overflow describes how an oversized output was returned.
+type Overflow struct {
+	// Text is the part of the output to return, including a marker
+	// explaining where the rest is.
+	Text          string `json:"-"`
+	TotalBytes    int    `json:"totalBytes"`
+	ReturnedBytes int    `json:"returnedBytes"`
+	Mode          Mode   `json:"mode"`
+	Handle        string `json:"handle,omitempty"`
+	Page          int    `json:"page,omitempty"`
+	Pages         int    `json:"pages,omitempty"`
+	ResourceURI   string `json:"resourceUri,omitempty"`
+	MIMEType      string `json:"mimeType,omitempty"`
+}
+
+// Truncation returns the overflow as reported in the structured result of
+// call_az.
+func (o *Overflow) Truncation() *azcli.OutputTruncation {
+	return &azcli.OutputTruncation{
+		TotalBytes:    o.TotalBytes,
+		ReturnedBytes: o.ReturnedBytes,
+		Mode:          string(o.Mode),
+		Handle:        o.Handle,
+		Page:          o.Page,
+		Pages:         o.Pages,
+		ResourceURI:   o.ResourceURI,
+		MIMEType:      o.MIMEType,
+	}
+}
+
+type storedOutput struct {
+	sessionID string
+	expiresAt time.Time
+	pages     []string
+	path      string
+	mimeType  string
+}
+
+// Manager applies the configured Mode to oversized outputs and keeps paged
+// and spilled outputs until they expire.
+type Manager struct {
+	mode  Mode
+	limit int
+	ttl   time.Duration
+	dir   string
+
+	mu      sync.Mutex
+	entries map[string]*storedOutput
+	order   []string
+}
+
+func NewManager(cfg Config) (*Manager, error) {
+	if cfg.Limit <= 0 {
+		return nil, fmt.Errorf("output limit must be greater than 0")
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = 15 * time.Minute
+	}
+
+	m := &Manager{
+		mode:    cfg.Mode,
+		limit:   cfg.Limit,
+		ttl:     cfg.TTL,
+		entries: make(map[string]*storedOutput),
+	}
+
+	switch cfg.Mode {
+	case ModeError, ModeTruncate, ModePage:
+	case ModeSpill:
+		dir, err := os.MkdirTemp("", "azure-api-mcp-output-")
+		if err != nil {
+			return nil, fmt.Errorf("failed to create output spill directory: %w", err)
+		}
+		m.dir = dir
+	default:
+		return nil, fmt.Errorf("invalid output overflow mode: %s", cfg.Mode)
+	}
+
+	return m, nil
+}
+
+func (m *Manager) Mode() Mode {
+	return m.mode
+}
+
+func (m *Manager) Limit() int {
+	return m.limit
+}
+
+// Exceeds reports whether data is larger than the limit.
+func (m *Manager) Exceeds(data []byte) bool {
+	return len(data) > m.limit
+}
+
+// Handle applies the configured mode to an oversized output. Paged and
+// spilled outputs can only be read back by the session that produced them.
+func (m *Manager) Handle(data []byte, sessionID string) (*Overflow, error) {
+	total := len(data)
+
+	switch m.mode {
+	case ModeTruncate:
+		head := cut(data, m.limit)
+		return &Overflow{
+			Text:          head + fmt.Sprintf("\n\n[output truncated: returned the first %d of %d bytes. Narrow the command with --query or filters to see the rest.]", len(head), total),
+			TotalBytes:    total,
+			ReturnedBytes: len(head),
+			Mode:          ModeTruncate,
+		}, nil
+
+	case ModePage:
+		pages := paginate(data, m.limit)
+		handle, err := m.store(&storedOutput{sessionID: sessionID, pages: pages})
+		if err != nil {
+			return nil, err
+		}
+		overflow := &Overflow{
+			TotalBytes:    total,
+			ReturnedBytes: len(pages[0]),
+			Mode:          ModePage,
+			Handle:        handle,
+			Page:          1,
+			Pages:         len(pages),
+		}
+		overflow.Text = pages[0] + m.pageMarker(overflow)
+		return overflow, nil
+
+	case ModeSpill:
+		mimeType := mimeTypeOf(data)
+		id, err := newID()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(m.dir, id)
+		if err := os.WriteFile(path, data, 0600); err != nil {
+			return nil, fmt.Errorf("failed to spill output: %w", err)
+		}
+		if _, err := m.storeWithID(id, &storedOutput{sessionID: sessionID, path: path, mimeType: mimeType}); err != nil {
+			return nil, err
+		}
+
+		head := cut(data, m.limit)
+		uri := ResourceURIPrefix + id
+		return &Overflow{
+			Text:          head + fmt.Sprintf("\n\n[output truncated: returned the first %d of %d bytes. The complete output is available as the MCP resource %s for %v.]", len(head), total, uri, m.ttl),
+			TotalBytes:    total,
+			ReturnedBytes: len(head),
+			Mode:          ModeSpill,
+			ResourceURI:   uri,
+			MIMEType:      mimeType,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("output size %d exceeds limit %d", total, m.limit)
+}
+
+// Page returns page number page (starting at 1) of a paged output.
+func (m *Manager) Page(handle string, page int, sessionID string) (*Overflow, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, err := m.lookup(handle, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if entry.pages == nil {
+		return nil, ErrNotFound
+	}
+	if page < 1 || page > len(entry.pages) {
+		return nil, fmt.Errorf("%w: page %d of %d", ErrPageOutOfRange, page, len(entry.pages))
+	}
+
+	total := 0
+	for _, p := range entry.pages {
+		total += len(p)
+	}
+	overflow := &Overflow{
+		TotalBytes:    total,
+		ReturnedBytes: len(entry.pages[page-1]),
+		Mode:          ModePage,
+		Handle:        handle,
+		Page:          page,
+		Pages:         len(entry.pages),
+	}
+	overflow.Text = entry.pages[page-1] + m.pageMarker(overflow)
+	return overflow, nil
+}
+
+// ReadResource returns the complete spilled output for a resource URI.
+func (m *Manager) ReadResource(uri string, sessionID string) ([]byte, string, error) {
+	id, ok := strings.CutPrefix(uri, ResourceURIPrefix)
+	if !ok {
+		return nil, "", ErrNotFound
+	}
+
+	m.mu.Lock()
+	entry, err := m.lookup(id, sessionID)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, "", err
+	}
+	if entry.path == "" {
+		return nil, "", ErrNotFound
+	}
+
+	data, err := os.ReadFile(entry.path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read spilled output: %w", err)
+	}
+	return data, entry.mimeType, nil
+}
+
+// Close removes every stored output.
+func (m *Manager) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.entries = make(map[string]*storedOutput)
+	m.order = nil
+	if m.dir == "" {
+		return nil
+	}
+	return os.RemoveAll(m.dir)
+}
+
+func (m *Manager) pageMarker(overflow *Overflow) string {
+	if overflow.Page >= overflow.Pages {
+		return fmt.Sprintf("\n\n[page %d of %d, %d bytes in total. This is the last page.]", overflow.Page, overflow.Pages, overflow.TotalBytes)
+	}
+	return fmt.Sprintf("\n\n[page %d of %d, %d bytes in total. Call call_az_fetch_page with handle=%q and page=%d for the next page. Pages expire after %v.]",
+		overflow.Page, overflow.Pages, overflow.TotalBytes, overflow.Handle, overflow.Page+1, m.ttl)
+}
+
+func (m *Manager) store(entry *storedOutput) (string, error) {
+	id, err := newID()
+	if err != nil {
+		return "", err
+	}
+	return m.storeWithID(id, entry)
+}
+
+func (m *Manager) storeWithID(id string, entry *storedOutput) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.expire()
+	for len(m.order) >= maxStoredOutputs {
+		m.remove(m.order[0])
+	}
+
+	entry.expiresAt = time.Now().Add(m.ttl)
+	m.entries[id] = entry
+	m.order = append(m.order, id)
+	return id, nil
+}
+
+// lookup returns a live entry owned by sessionID. The caller must hold m.mu.
+func (m *Manager) lookup(id string, sessionID string) (*storedOutput, error) {
+	m.expire()
+	entry, ok := m.entries[id]
+	if !ok || entry.sessionID != sessionID {
+		return nil, ErrNotFound
+	}
+	return entry, nil
+}
+
+// expire removes entries past their TTL. The caller must hold m.mu.
+func (m *Manager) expire() {
+	now := time.Now()
+	for len(m.order) > 0 {
+		entry := m.entries[m.order[0]]
+		if entry != nil && now.Before(entry.expiresAt) {
+			return
+		}
+		m.remove(m.order[0])
+	}
+}
+
+// remove drops an entry and its spill file. The caller must hold m.mu.
+func (m *Manager) remove(id string) {
+	if entry, ok := m.entries[id]; ok && entry.path != "" {
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("Failed to remove spilled output %s: %v", entry.path, err)
+		}
+	}
+	delete(m.entries, id)
+	for i, orderedID := range m.order {
+		if orderedID == id {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// cut returns at most limit bytes of data without splitting a UTF-8
+// character.
+func cut(data []byte, limit int) string {
+	if len(data) <= limit {
+		return string(data)
+	}
+	end := limit
+	for end > 0 && !utf8.RuneStart(data[end]) {
+		end--
+	}
+	if end == 0 {
+		end = limit
+	}
+	return string(data[:end])
+}
+
+func paginate(data []byte, pageSize int) []string {
+	var pages []string
+	for len(data) > 0 {
+		page := cut(data, pageSize)
+		pages = append(pages, page)
+		data = data[len(page):]
+	}
+	return pages
+}
+
+func mimeTypeOf(data []byte) string {
+	if json.Valid(data) {
+		return "application/json"
+	}
+	return "text/plain"
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate output handle: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
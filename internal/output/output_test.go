@@ -0,0 +1,175 @@
+package output
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManager_Truncate(t *testing.T) {
+	m, err := NewManager(Config{Mode: ModeTruncate, Limit: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Exceeds([]byte("0123456789")) {
+		t.Error("output at the limit should not exceed it")
+	}
+
+	overflow, err := m.Handle([]byte("0123456789abcdef"), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(overflow.Text, "0123456789\n\n[output truncated: returned the first 10 of 16 bytes") {
+		t.Errorf("Text = %q", overflow.Text)
+	}
+	if overflow.TotalBytes != 16 || overflow.ReturnedBytes != 10 {
+		t.Errorf("TotalBytes = %d, ReturnedBytes = %d", overflow.TotalBytes, overflow.ReturnedBytes)
+	}
+}
+
+func TestManager_TruncateKeepsUTF8Intact(t *testing.T) {
+	m, err := NewManager(Config{Mode: ModeTruncate, Limit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// "aé" is 3 bytes; the second "é" would be split at byte 4.
+	overflow, err := m.Handle([]byte("aéé"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overflow.ReturnedBytes != 3 || !strings.HasPrefix(overflow.Text, "aé\n") {
+		t.Errorf("Text = %q, ReturnedBytes = %d", overflow.Text, overflow.ReturnedBytes)
+	}
+}
+
+func TestManager_Page(t *testing.T) {
+	m, err := NewManager(Config{Mode: ModePage, Limit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overflow, err := m.Handle([]byte("aaaabbbbcc"), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if overflow.Pages != 3 || overflow.Page != 1 || overflow.Handle == "" {
+		t.Fatalf("unexpected overflow: %+v", overflow)
+	}
+	if !strings.HasPrefix(overflow.Text, "aaaa\n") || !strings.Contains(overflow.Text, "page=2") {
+		t.Errorf("Text = %q", overflow.Text)
+	}
+	if tr := overflow.Truncation(); tr.Mode != "page" || tr.Handle != overflow.Handle || tr.Pages != 3 || tr.TotalBytes != 10 || tr.ReturnedBytes != overflow.ReturnedBytes {
+		t.Errorf("Truncation() = %+v", tr)
+	}
+
+	page, err := m.Page(overflow.Handle, 3, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(page.Text, "cc\n") || !strings.Contains(page.Text, "last page") {
+		t.Errorf("page 3 Text = %q", page.Text)
+	}
+
+	if _, err := m.Page(overflow.Handle, 4, "s1"); !errors.Is(err, ErrPageOutOfRange) {
+		t.Errorf("Page(4) error = %v, want ErrPageOutOfRange", err)
+	}
+	if _, err := m.Page(overflow.Handle, 2, "other-session"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Page() from another session error = %v, want ErrNotFound", err)
+	}
+	if _, err := m.Page("unknown", 1, "s1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Page() with unknown handle error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManager_PageExpires(t *testing.T) {
+	m, err := NewManager(Config{Mode: ModePage, Limit: 4, TTL: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	overflow, err := m.Handle([]byte("aaaabbbb"), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if _, err := m.Page(overflow.Handle, 2, "s1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Page() after expiry error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestManager_EvictsOldestOutput(t *testing.T) {
+	m, err := NewManager(Config{Mode: ModePage, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := m.Handle([]byte("ab"), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < maxStoredOutputs; i++ {
+		if _, err := m.Handle([]byte("ab"), "s1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := m.Page(first.Handle, 2, "s1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Page() of evicted output error = %v, want ErrNotFound", err)
+	}
+	if len(m.entries) != maxStoredOutputs {
+		t.Errorf("stored %d outputs, want %d", len(m.entries), maxStoredOutputs)
+	}
+}
+
+func TestManager_Spill(t *testing.T) {
+	m, err := NewManager(Config{Mode: ModeSpill, Limit: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := []byte(`[{"name":"vm1"},{"name":"vm2"}]`)
+	overflow, err := m.Handle(data, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(overflow.ResourceURI, ResourceURIPrefix) || overflow.MIMEType != "application/json" {
+		t.Fatalf("unexpected overflow: %+v", overflow)
+	}
+	if !strings.HasPrefix(overflow.Text, `[{"na`) || !strings.Contains(overflow.Text, overflow.ResourceURI) {
+		t.Errorf("Text = %q", overflow.Text)
+	}
+
+	got, mimeType, err := m.ReadResource(overflow.ResourceURI, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(data) || mimeType != "application/json" {
+		t.Errorf("ReadResource() = %s (%s)", got, mimeType)
+	}
+
+	if _, _, err := m.ReadResource(overflow.ResourceURI, "other-session"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadResource() from another session error = %v, want ErrNotFound", err)
+	}
+
+	dir := m.dir
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("spill directory %s still exists after Close()", dir)
+	}
+}
+
+func TestNewManager_Invalid(t *testing.T) {
+	if _, err := NewManager(Config{Mode: "discard", Limit: 10}); err == nil {
+		t.Error("NewManager() should reject unknown modes")
+	}
+	if _, err := NewManager(Config{Mode: ModeTruncate}); err == nil {
+		t.Error("NewManager() should reject a zero limit")
+	}
+}
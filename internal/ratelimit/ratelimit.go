@@ -0,0 +1,232 @@
+// Package ratelimit limits how often call_az may execute commands, with
+// token buckets per MCP session, per client and for the whole server.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+// Scope is what a budget is shared by.
+type Scope string
+
+const (
+	ScopeSession Scope = "session"
+	ScopeClient  Scope = "client"
+	ScopeGlobal  Scope = "global"
+)
+
+// Kind separates the budgets of read-only and write commands.
+type Kind string
+
+const (
+	KindRead  Kind = "read"
+	KindWrite Kind = "write"
+)
+
+// sweepInterval is how often idle buckets are dropped.
+const sweepInterval = time.Minute
+
+// Limit allows PerMinute commands per minute on average, and up to Burst at
+// once (default PerMinute). A zero PerMinute is unlimited.
+type Limit struct {
+	PerMinute float64
+	Burst     int
+}
+
+func (l Limit) enabled() bool {
+	return l.PerMinute > 0
+}
+
+func (l Limit) capacity() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return math.Max(l.PerMinute, 1)
+}
+
+// Budget holds the limits of one scope.
+type Budget struct {
+	Read  Limit
+	Write Limit
+}
+
+func (b Budget) limit(kind Kind) Limit {
+	if kind == KindWrite {
+		return b.Write
+	}
+	return b.Read
+}
+
+type Config struct {
+	// Session limits each MCP session.
+	Session Budget
+	// Client limits each client, such as an authenticated principal or an
+	// MCP client name.
+	Client Budget
+	// Global limits the server as a whole.
+	Global Budget
+}
+
+// Enabled reports whether any limit is set.
+func (c Config) Enabled() bool {
+	for _, budget := range []Budget{c.Session, c.Client, c.Global} {
+		if budget.Read.enabled() || budget.Write.enabled() {
+			return true
+		}
+	}
+	return false
+}
+
+// ExceededError is returned for a command that exceeds a budget.
+type ExceededError struct {
+	Scope Scope
+	Kind  Kind
+	// RetryAfter is when the budget has room for the command again.
+	RetryAfter time.Duration
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s rate limit for %s commands exceeded, retry after %s", e.Scope, e.Kind, e.RetryAfter.Round(time.Millisecond))
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds.
+func (e *ExceededError) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+type bucketKey struct {
+	scope Scope
+	kind  Kind
+	id    string
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+type Limiter struct {
+	config Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[bucketKey]*bucket
+	lastSweep time.Time
+}
+
+// New returns nil when no limit is set. A nil Limiter allows everything.
+func New(config Config) *Limiter {
+	if !config.Enabled() {
+		return nil
+	}
+	return &Limiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[bucketKey]*bucket),
+	}
+}
+
+// Allow takes a token from every budget that applies to a command of kind
+// run by clientID in sessionID. Commands are never queued: when a budget is
+// empty, no token is taken from any budget and an *ExceededError is returned
+// with the longest wait among the empty budgets.
+func (l *Limiter) Allow(sessionID, clientID string, kind Kind) error {
+	if l == nil {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	type candidate struct {
+		scope  Scope
+		limit  Limit
+		bucket *bucket
+	}
+	var candidates []candidate
+	for _, scoped := range []struct {
+		scope  Scope
+		id     string
+		budget Budget
+	}{
+		{ScopeSession, sessionID, l.config.Session},
+		{ScopeClient, clientID, l.config.Client},
+		{ScopeGlobal, "", l.config.Global},
+	} {
+		limit := scoped.budget.limit(kind)
+		if !limit.enabled() {
+			continue
+		}
+		candidates = append(candidates, candidate{scoped.scope, limit, l.refill(bucketKey{scoped.scope, kind, scoped.id}, limit, now)})
+	}
+
+	var exceeded *ExceededError
+	for _, c := range candidates {
+		if c.bucket.tokens >= 1 {
+			continue
+		}
+		wait := time.Duration((1 - c.bucket.tokens) / c.limit.PerMinute * float64(time.Minute))
+		if exceeded == nil || wait > exceeded.RetryAfter {
+			exceeded = &ExceededError{Scope: c.scope, Kind: kind, RetryAfter: wait}
+		}
+	}
+	if exceeded != nil {
+		metrics.RateLimited.Inc(string(exceeded.Scope), string(kind))
+		return exceeded
+	}
+
+	for _, c := range candidates {
+		c.bucket.tokens--
+	}
+	return nil
+}
+
+// refill returns the bucket for key with the tokens earned since its last
+// update. The caller must hold l.mu.
+func (l *Limiter) refill(key bucketKey, limit Limit, now time.Time) *bucket {
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: limit.capacity(), updated: now}
+		l.buckets[key] = b
+		return b
+	}
+	elapsed := now.Sub(b.updated)
+	b.tokens = math.Min(limit.capacity(), b.tokens+elapsed.Minutes()*limit.PerMinute)
+	b.updated = now
+	return b
+}
+
+// sweep drops buckets that have refilled completely, since a new bucket
+// starts out full anyway. The caller must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		limit := l.budget(key.scope).limit(key.kind)
+		if b.tokens+now.Sub(b.updated).Minutes()*limit.PerMinute >= limit.capacity() {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+func (l *Limiter) budget(scope Scope) Budget {
+	switch scope {
+	case ScopeSession:
+		return l.config.Session
+	case ScopeClient:
+		return l.config.Client
+	default:
+		return l.config.Global
+	}
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(config Config) (*Limiter, *time.Time) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	l := New(config)
+	l.now = func() time.Time { return now }
+	return l, &now
+}
+
+func TestNew_Disabled(t *testing.T) {
+	l := New(Config{})
+	if l != nil {
+		t.Fatal("New() with no limits should return nil")
+	}
+	if err := l.Allow("s1", "c1", KindWrite); err != nil {
+		t.Errorf("nil limiter Allow() = %v, want nil", err)
+	}
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	l, now := newTestLimiter(Config{Session: Budget{Read: Limit{PerMinute: 60, Burst: 2}}})
+
+	for i := 0; i < 2; i++ {
+		if err := l.Allow("s1", "", KindRead); err != nil {
+			t.Fatalf("Allow() #%d = %v", i+1, err)
+		}
+	}
+
+	err := l.Allow("s1", "", KindRead)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) {
+		t.Fatalf("Allow() after burst = %v, want ExceededError", err)
+	}
+	if exceeded.Scope != ScopeSession || exceeded.Kind != KindRead || exceeded.RetryAfter != time.Second || exceeded.RetryAfterSeconds() != 1 {
+		t.Errorf("ExceededError = %+v", exceeded)
+	}
+
+	*now = now.Add(time.Second)
+	if err := l.Allow("s1", "", KindRead); err != nil {
+		t.Errorf("Allow() after refill = %v", err)
+	}
+}
+
+func TestLimiter_SeparateBudgets(t *testing.T) {
+	l, _ := newTestLimiter(Config{Session: Budget{Read: Limit{PerMinute: 1}, Write: Limit{PerMinute: 1}}})
+
+	if err := l.Allow("s1", "", KindRead); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Allow("s1", "", KindWrite); err != nil {
+		t.Errorf("write budget should be separate from the read budget: %v", err)
+	}
+	if err := l.Allow("s2", "", KindRead); err != nil {
+		t.Errorf("sessions should have separate budgets: %v", err)
+	}
+	if err := l.Allow("s1", "", KindRead); err == nil {
+		t.Error("exhausted read budget should reject the command")
+	}
+}
+
+func TestLimiter_UnlimitedKind(t *testing.T) {
+	l, _ := newTestLimiter(Config{Global: Budget{Write: Limit{PerMinute: 1}}})
+	for i := 0; i < 100; i++ {
+		if err := l.Allow("", "", KindRead); err != nil {
+			t.Fatalf("reads are unlimited: %v", err)
+		}
+	}
+}
+
+func TestLimiter_RejectionTakesNoTokens(t *testing.T) {
+	l, now := newTestLimiter(Config{
+		Client: Budget{Write: Limit{PerMinute: 10}},
+		Global: Budget{Write: Limit{PerMinute: 1}},
+	})
+
+	if err := l.Allow("s1", "c1", KindWrite); err != nil {
+		t.Fatal(err)
+	}
+
+	err := l.Allow("s1", "c1", KindWrite)
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Scope != ScopeGlobal {
+		t.Fatalf("Allow() = %v, want global ExceededError", err)
+	}
+	if exceeded.RetryAfter != time.Minute {
+		t.Errorf("RetryAfter = %v, want 1m", exceeded.RetryAfter)
+	}
+
+	// The client budget did not pay for the rejected command: after a
+	// minute, the client still has 9 tokens plus the refill.
+	*now = now.Add(time.Minute)
+	if err := l.Allow("s1", "c1", KindWrite); err != nil {
+		t.Fatal(err)
+	}
+	if tokens := l.buckets[bucketKey{ScopeClient, KindWrite, "c1"}].tokens; tokens != 9 {
+		t.Errorf("client tokens = %v, want 9", tokens)
+	}
+}
+
+func TestLimiter_LongestWaitWins(t *testing.T) {
+	l, _ := newTestLimiter(Config{
+		Session: Budget{Read: Limit{PerMinute: 60, Burst: 1}},
+		Client:  Budget{Read: Limit{PerMinute: 6, Burst: 1}},
+	})
+	if err := l.Allow("s1", "c1", KindRead); err != nil {
+		t.Fatal(err)
+	}
+
+	var exceeded *ExceededError
+	if err := l.Allow("s1", "c1", KindRead); !errors.As(err, &exceeded) {
+		t.Fatalf("Allow() = %v, want ExceededError", err)
+	}
+	if exceeded.Scope != ScopeClient || exceeded.RetryAfter != 10*time.Second {
+		t.Errorf("ExceededError = %+v, want client scope with 10s", exceeded)
+	}
+}
+
+func TestLimiter_SweepDropsFullBuckets(t *testing.T) {
+	l, now := newTestLimiter(Config{Session: Budget{Read: Limit{PerMinute: 60}}})
+
+	for _, session := range []string{"s1", "s2"} {
+		if err := l.Allow(session, "", KindRead); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(l.buckets) != 2 {
+		t.Fatalf("buckets = %d, want 2", len(l.buckets))
+	}
+
+	*now = now.Add(2 * time.Minute)
+	if err := l.Allow("s3", "", KindRead); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.buckets) != 1 {
+		t.Errorf("buckets after sweep = %d, want 1", len(l.buckets))
+	}
+}
@@ -2,47 +2,518 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/Azure/azure-api-mcp/internal/approval"
+	"github.com/Azure/azure-api-mcp/internal/audit"
+	"github.com/Azure/azure-api-mcp/internal/authn"
 	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+	"github.com/Azure/azure-api-mcp/internal/output"
+	"github.com/Azure/azure-api-mcp/internal/ratelimit"
+	"github.com/Azure/azure-api-mcp/internal/shutdown"
 	"github.com/Azure/azure-api-mcp/pkg/azcli"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
 )
 
-func CallAzHandler(client azcli.Client) server.ToolHandlerFunc {
+// HandlerConfig holds the optional collaborators of CallAzHandler.
+type HandlerConfig struct {
+	// Approvals decides on commands matched by require-approval policy rules.
+	// When nil, such commands are rejected.
+	Approvals *approval.Manager
+	// Audit records every invocation. When nil, nothing is recorded.
+	Audit *audit.Logger
+	// Identity is the authenticated Azure identity recorded in audit entries.
+	Identity string
+	// DefaultIdentity is the named identity of calls that do not select one
+	// with the identity argument; "" when identities are not named.
+	DefaultIdentity string
+	// Identities maps the names of the identities calls may select to their
+	// Azure account, which replaces Identity for those calls.
+	Identities map[string]string
+	// DryRun makes every call a dry run, regardless of the dry_run argument.
+	DryRun bool
+	// Output handles output larger than a single response. When nil, output
+	// is returned as is.
+	Output *output.Manager
+	// RateLimits rejects commands that exceed a rate limit. When nil, commands
+	// are not rate limited.
+	RateLimits *ratelimit.Limiter
+	// Shutdown tracks calls so that they can be drained when the server
+	// stops. When nil, calls are not tracked.
+	Shutdown *shutdown.Drainer
+}
+
+func CallAzHandler(client azcli.Client, cfg HandlerConfig) server.ToolHandlerFunc {
 	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		startTime := time.Now()
+		ctx = azcli.WithSessionID(ctx, sessionID(ctx))
+		identityName := request.GetString("identity", cfg.DefaultIdentity)
+		identity := cfg.Identity
+		if account, ok := cfg.Identities[identityName]; ok {
+			identity = account
+		}
+		if identityName != "" {
+			ctx = azcli.WithIdentityName(ctx, identityName)
+		}
+		ctx = azcli.WithIdentity(ctx, identity)
+		ctx = azcli.WithCaller(ctx, caller(ctx))
+		entry := newAuditEntry(ctx, identity)
+		entry.IdentityName = identityName
+		defer func() {
+			entry.DurationMs = time.Since(startTime).Milliseconds()
+			cfg.Audit.Record(entry)
+		}()
+
+		out := &azcli.CallAzOutput{}
+		fail := func(text string, toolErr *azcli.ToolError) *mcp.CallToolResult {
+			out.Error = toolErr
+			if out.DurationMs == 0 {
+				out.DurationMs = time.Since(startTime).Milliseconds()
+			}
+			return toolResult(text, out)
+		}
+
 		cliCommand, err := request.RequireString("cli_command")
 		if err != nil {
 			logger.Warnf("Missing cli_command parameter: %v", err)
-			return mcp.NewToolResultError("cli_command is required"), nil
+			entry.Outcome = audit.OutcomeDenied
+			entry.Error = "cli_command is required"
+			return fail("cli_command is required", &azcli.ToolError{Type: azcli.ErrorTypeInvalidCommand, Message: "cli_command is required"}), nil
+		}
+		entry.Command = cliCommand
+		out.Command = cliCommand
+		group := commandGroup(cliCommand)
+		defer func() { metrics.Invocations.Inc(group, entry.Outcome) }()
+
+		ctx, done, err := cfg.Shutdown.Begin(ctx, audit.Redact(cliCommand))
+		if err != nil {
+			entry.Error = err.Error()
+			entry.ErrorType = string(azcli.ErrorTypeShuttingDown)
+			return fail(err.Error(), &azcli.ToolError{Type: azcli.ErrorTypeShuttingDown, Message: err.Error()}), nil
 		}
+		defer func() {
+			if errors.Is(context.Cause(ctx), shutdown.ErrCancelled) {
+				entry.Outcome = audit.OutcomeCancelled
+				entry.ErrorType = string(azcli.ErrorTypeShuttingDown)
+			}
+			done()
+		}()
 
 		timeout := time.Duration(request.GetFloat("timeout", 120)) * time.Second
+
+		if cfg.DryRun || request.GetBool("dry_run", false) {
+			return dryRun(ctx, client, cfg.RateLimits, cliCommand, request.GetBool("what_if", false), timeout, &entry, out, startTime), nil
+		}
+
 		logger.Debugf("Executing command: %s (timeout: %v)", cliCommand, timeout)
 
+		validation, err := client.EvaluateCommand(ctx, cliCommand)
+		if err != nil {
+			logger.Warnf("Command validation failed: %v", err)
+			entry.Outcome = audit.OutcomeDenied
+			setAuditError(&entry, err)
+			recordDenial(err)
+			return fail(fmt.Sprintf("validation error: %v", err), azcli.NewToolError(err, azcli.ErrorTypeInvalidCommand)), nil
+		}
+		if validation.Policy != nil {
+			entry.Rule = validation.Policy.RuleName()
+		}
+		entry.Policy = validation.PolicyName
+
+		if err := rateLimit(ctx, cfg.RateLimits, cliCommand, validation); err != nil {
+			entry.Outcome = audit.OutcomeRateLimited
+			setAuditError(&entry, err)
+			return fail(fmt.Sprintf("rate limit error: %v", err), azcli.NewToolError(err, azcli.ErrorTypeRateLimited)), nil
+		}
+
+		if validation.RequiresApproval {
+			if err := requestApproval(ctx, cfg.Approvals, cliCommand, validation); err != nil {
+				entry.Outcome = audit.OutcomeApprovalDenied
+				entry.Error = err.Error()
+				return fail(err.Error(), azcli.NewToolError(err, azcli.ErrorTypeApprovalDenied)), nil
+			}
+		}
+		entry.Outcome = audit.OutcomeAllowed
+
 		execCtx, cancel := context.WithTimeout(ctx, timeout)
 		defer cancel()
-
-		if err := client.ValidateCommand(cliCommand); err != nil {
-			logger.Warnf("Command validation failed: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("validation error: %v", err)), nil
+		if request.GetBool("no_cache", false) {
+			execCtx = azcli.WithNoCache(execCtx)
 		}
 
 		result, err := client.ExecuteCommand(execCtx, cliCommand)
 		if err != nil {
 			logger.Errorf("Command execution failed: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("execution error: %v", err)), nil
+			setAuditError(&entry, err)
+			// Failures az reported with a recognized error keep its exit
+			// code and stderr.
+			var azErr *azcli.AzCliError
+			if errors.As(err, &azErr) {
+				if exitCode, ok := azErr.Context["exit_code"].(int); ok {
+					entry.ExitCode = &exitCode
+					out.ExitCode = &exitCode
+				}
+				out.Stderr, _ = azErr.Context["stderr"].(string)
+				out.Retries, _ = azErr.Context["retries"].(int)
+				entry.Retries = out.Retries
+			}
+			return fail(fmt.Sprintf("execution error: %v", err), azcli.NewToolError(err, azcli.ErrorTypeExecution)), nil
 		}
 
+		exitCode := result.ExitCode
+		entry.ExitCode = &exitCode
+		entry.OutputBytes = len(result.Output)
+		out.ExitCode = &exitCode
+		out.DurationMs = result.Duration.Milliseconds()
+		out.Retries = result.Retries
+		out.Cached = result.Cached
+		entry.Retries = result.Retries
+		entry.Cached = result.Cached
+
 		if result.ExitCode != 0 {
 			logger.Warnf("Command failed with exit code %d: %s", result.ExitCode, result.Error)
-			return mcp.NewToolResultError(fmt.Sprintf("command failed (exit code %d): %s", result.ExitCode, result.Error)), nil
+			entry.Error = result.Error
+			out.Stderr = result.Error
+			message := fmt.Sprintf("command failed (exit code %d)", result.ExitCode)
+			return fail(fmt.Sprintf("%s: %s", message, result.Error), &azcli.ToolError{Type: azcli.ErrorTypeExecution, Message: message}), nil
 		}
+		out.Warnings = stderrLines(result.Error)
 
 		logger.Debugf("Command executed successfully (duration: %v)", result.Duration)
 
-		return mcp.NewToolResultText(string(result.Output)), nil
+		output, err := transformOutput(result.Output, request)
+		if err != nil {
+			logger.Warnf("Failed to transform output: %v", err)
+			setAuditError(&entry, err)
+			return fail(fmt.Sprintf("query error: %v", err), azcli.NewToolError(err, azcli.ErrorTypeQuery)), nil
+		}
+
+		format := request.GetString("format", "")
+		rendered, err := azcli.RenderOutput(output, azcli.OutputFormat(format))
+		if err != nil {
+			logger.Warnf("Failed to format output: %v", err)
+			setAuditError(&entry, err)
+			return fail(fmt.Sprintf("format error: %v", err), azcli.NewToolError(err, azcli.ErrorTypeParseOutput)), nil
+		}
+		output = json.RawMessage(rendered)
+		out.Format = format
+
+		if cfg.Output != nil && cfg.Output.Exceeds(output) {
+			overflow, err := cfg.Output.Handle(output, sessionID(ctx))
+			if err != nil {
+				logger.Errorf("Failed to handle oversized output: %v", err)
+				return fail(fmt.Sprintf("output error: %v", err), azcli.NewToolError(err, azcli.ErrorTypeExecution)), nil
+			}
+			logger.Infof("Output of %d bytes exceeded the limit of %d bytes (mode: %s)", overflow.TotalBytes, cfg.Output.Limit(), overflow.Mode)
+			out.Output = structuredOutput([]byte(overflow.Text), false)
+			out.Truncation = overflow.Truncation()
+			result := toolResult(overflow.Text, out)
+			result.Content = append(result.Content, resourceLinks(overflow)...)
+			return result, nil
+		}
+
+		out.Output = structuredOutput(output, format == "" || format == string(azcli.OutputFormatJSON) || format == string(azcli.OutputFormatCompactJSON))
+		return toolResult(string(output), out), nil
+	}
+}
+
+// toolResult returns text as the text content and out as the structured
+// content of a call_az result. The result is an error when out.Error is set.
+func toolResult(text string, out *azcli.CallAzOutput) *mcp.CallToolResult {
+	result := mcp.NewToolResultStructured(out, text)
+	result.IsError = out.Error != nil
+	return result
+}
+
+// structuredOutput embeds output as JSON when it is JSON output, and as a
+// JSON string otherwise.
+func structuredOutput(output []byte, isJSON bool) json.RawMessage {
+	if isJSON && json.Valid(output) {
+		return output
+	}
+	encoded, _ := json.Marshal(string(output))
+	return encoded
+}
+
+// stderrLines returns the non-empty lines of stderr.
+func stderrLines(stderr string) []string {
+	var lines []string
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// transformOutput applies the optional jmespath expression and then the
+// optional fields projection of the request.
+func transformOutput(output json.RawMessage, request mcp.CallToolRequest) (json.RawMessage, error) {
+	if expression := request.GetString("jmespath", ""); expression != "" {
+		transformed, err := azcli.ApplyJMESPath(output, expression)
+		if err != nil {
+			return nil, err
+		}
+		output = transformed
+	}
+
+	if fields := request.GetStringSlice("fields", nil); len(fields) > 0 {
+		projected, err := azcli.ProjectFields(output, fields)
+		if err != nil {
+			return nil, err
+		}
+		output = projected
+	}
+
+	return output, nil
+}
+
+// FetchPageHandler serves further pages of outputs paged by CallAzHandler.
+func FetchPageHandler(outputs *output.Manager) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		handle, err := request.RequireString("handle")
+		if err != nil {
+			return mcp.NewToolResultError("handle is required"), nil
+		}
+		page, err := request.RequireFloat("page")
+		if err != nil {
+			return mcp.NewToolResultError("page is required"), nil
+		}
+
+		overflow, err := outputs.Page(handle, int(page), sessionID(ctx))
+		if err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("fetch error: %v", err)), nil
+		}
+		return overflowResult(overflow), nil
+	}
+}
+
+// OutputResourceHandler serves outputs spilled to disk by CallAzHandler.
+func OutputResourceHandler(outputs *output.Manager) server.ResourceTemplateHandlerFunc {
+	return func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+		data, mimeType, err := outputs.ReadResource(request.Params.URI, sessionID(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return []mcp.ResourceContents{
+			mcp.TextResourceContents{
+				URI:      request.Params.URI,
+				MIMEType: mimeType,
+				Text:     string(data),
+			},
+		}, nil
+	}
+}
+
+func overflowResult(overflow *output.Overflow) *mcp.CallToolResult {
+	result := mcp.NewToolResultText(overflow.Text)
+	result.Content = append(result.Content, resourceLinks(overflow)...)
+	return result
+}
+
+// resourceLinks links to the complete output of a spilled overflow.
+func resourceLinks(overflow *output.Overflow) []mcp.Content {
+	if overflow.ResourceURI == "" {
+		return nil
+	}
+	return []mcp.Content{mcp.NewResourceLink(
+		overflow.ResourceURI,
+		"call_az output",
+		fmt.Sprintf("Complete command output (%d bytes)", overflow.TotalBytes),
+		overflow.MIMEType,
+	)}
+}
+
+// dryRun returns a report on how cliCommand would be handled instead of
+// executing it. Only a native what-if variant is executed, and only when
+// requested.
+func dryRun(ctx context.Context, client azcli.Client, limiter *ratelimit.Limiter, cliCommand string, whatIf bool, timeout time.Duration, entry *audit.Entry, out *azcli.CallAzOutput, startTime time.Time) *mcp.CallToolResult {
+	logger.Debugf("Dry run: %s (what-if: %v)", cliCommand, whatIf)
+	entry.Outcome = audit.OutcomeDryRun
+
+	execCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	report, err := client.DryRunCommand(execCtx, cliCommand, false)
+	if err == nil && whatIf && report.WhatIf != nil {
+		// The preview runs az against ARM, so it takes a read token like any
+		// read-only command.
+		if err := rateLimit(ctx, limiter, cliCommand, &azcli.ValidationResult{ReadOnly: true}); err != nil {
+			entry.Outcome = audit.OutcomeRateLimited
+			setAuditError(entry, err)
+			out.DurationMs = time.Since(startTime).Milliseconds()
+			out.Error = azcli.NewToolError(err, azcli.ErrorTypeRateLimited)
+			return toolResult(fmt.Sprintf("rate limit error: %v", err), out)
+		}
+		report, err = client.DryRunCommand(execCtx, cliCommand, true)
+	}
+	out.DurationMs = time.Since(startTime).Milliseconds()
+	if err != nil {
+		setAuditError(entry, err)
+		out.Error = azcli.NewToolError(err, azcli.ErrorTypeInvalidCommand)
+		return toolResult(fmt.Sprintf("validation error: %v", err), out)
+	}
+	entry.Rule = report.MatchedRule
+	entry.Policy = report.Policy
+	if !report.Allowed {
+		entry.Error = strings.Join(report.Reasons, "; ")
+	}
+	if preview := report.WhatIf; preview != nil && preview.Executed {
+		entry.ExitCode = preview.ExitCode
+		entry.OutputBytes = len(preview.Output)
+		entry.PreviewDurationMs = preview.DurationMs
+		if preview.Error != "" && entry.Error == "" {
+			entry.Error = preview.Error
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("failed to encode dry-run report: %v", err))
+	}
+	out.DryRun = report
+	return toolResult(string(data), out)
+}
+
+// requestApproval blocks until the command is approved. It returns an error
+// when the command must not run. Approvers, webhooks and logs only see the
+// command with its secrets redacted.
+func requestApproval(ctx context.Context, approvals *approval.Manager, cliCommand string, validation *azcli.ValidationResult) error {
+	command := audit.Redact(cliCommand)
+	rule := ""
+	if validation.Policy != nil {
+		rule = validation.Policy.RuleName()
+	}
+
+	if approvals == nil {
+		logger.Warnf("Command requires approval but no approval mode is configured: %s", command)
+		return fmt.Errorf("approval error: command requires approval but no approval workflow is configured on the server")
+	}
+
+	decision, err := approvals.Request(ctx, command, rule, sessionID(ctx), validation.ApprovalTimeout)
+	if err != nil {
+		return fmt.Errorf("approval error: %w", err)
+	}
+
+	if !decision.Approved {
+		if decision.Reason != "" {
+			return fmt.Errorf("approval denied: command was not approved: %s", decision.Reason)
+		}
+		return fmt.Errorf("approval denied: command was not approved")
+	}
+	return nil
+}
+
+// rateLimit takes a token from the read or write budgets of the caller's
+// session and client.
+func rateLimit(ctx context.Context, limiter *ratelimit.Limiter, cliCommand string, validation *azcli.ValidationResult) error {
+	kind := ratelimit.KindWrite
+	if validation.ReadOnly {
+		kind = ratelimit.KindRead
+	}
+
+	var exceeded *ratelimit.ExceededError
+	if err := limiter.Allow(sessionID(ctx), clientID(ctx), kind); !errors.As(err, &exceeded) {
+		return err
+	}
+	logger.Warnf("Rate limit exceeded (scope: %s, kind: %s, retry after: %v): %s", exceeded.Scope, exceeded.Kind, exceeded.RetryAfter, audit.Redact(cliCommand))
+	return azcli.NewAzCliError(azcli.ErrorTypeRateLimited, exceeded.Error(), cliCommand).
+		WithContext("retry_after", exceeded.RetryAfterSeconds()).
+		WithContext("scope", string(exceeded.Scope)).
+		WithContext("kind", string(exceeded.Kind))
+}
+
+func newAuditEntry(ctx context.Context, identity string) audit.Entry {
+	entry := audit.Entry{
+		Outcome:   audit.OutcomeFailed,
+		SessionID: sessionID(ctx),
+		Identity:  identity,
+		Principal: authn.PrincipalFromContext(ctx).String(),
+	}
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		info := session.GetClientInfo()
+		entry.ClientName = info.Name
+		entry.ClientVer = info.Version
+	}
+	return entry
+}
+
+func setAuditError(entry *audit.Entry, err error) {
+	entry.Error = err.Error()
+	var azErr *azcli.AzCliError
+	if errors.As(err, &azErr) {
+		entry.ErrorType = string(azErr.Type)
+		if rule, ok := azErr.Context["rule"].(string); ok {
+			entry.Rule = rule
+		}
+		if policy, ok := azErr.Context["policy"].(string); ok {
+			entry.Policy = policy
+		}
+	}
+}
+
+// recordDenial counts a validation failure by error type and by the policy
+// rule, or else the validation layer, that rejected it.
+func recordDenial(err error) {
+	errorType, reason := string(azcli.ErrorTypeInvalidCommand), "unknown"
+	var azErr *azcli.AzCliError
+	if errors.As(err, &azErr) {
+		errorType = string(azErr.Type)
+		if rule, ok := azErr.Context["rule"].(string); ok {
+			reason = rule
+		} else if layer, ok := azErr.Context["layer"].(string); ok {
+			reason = layer
+		}
+	}
+	metrics.ValidationDenials.Inc(errorType, reason)
+}
+
+// commandGroup returns the top-level command group used to label metrics.
+func commandGroup(cliCommand string) string {
+	cmd, err := azcli.ParseCommand(cliCommand)
+	if err != nil || cmd.Group() == "" {
+		return "unknown"
+	}
+	return cmd.Group()
+}
+
+// caller describes the client of the request for policy bindings.
+func caller(ctx context.Context) azcli.Caller {
+	var c azcli.Caller
+	if principal := authn.PrincipalFromContext(ctx); principal != nil {
+		c.Principal = principal.String()
+		c.Claims = principal.Claims
+		if principal.Method == authn.MethodAPIKey {
+			c.APIKey = principal.Subject
+		}
+	}
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		c.ClientName = session.GetClientInfo().Name
+	}
+	return c
+}
+
+// clientID identifies the caller for per-client rate limits: the
+// authenticated principal, or else the MCP client name.
+func clientID(ctx context.Context) string {
+	if principal := authn.PrincipalFromContext(ctx); principal != nil {
+		return principal.String()
+	}
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		return session.GetClientInfo().Name
+	}
+	return ""
+}
+
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
 	}
+	return ""
 }
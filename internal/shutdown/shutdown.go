@@ -0,0 +1,153 @@
+// Package shutdown drains in-flight tool calls when the server stops.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+)
+
+var (
+	// ErrShuttingDown is returned by Begin once the server is draining.
+	ErrShuttingDown = errors.New("server is shutting down")
+	// ErrCancelled is the cause of the contexts of calls still running when
+	// the grace period ends.
+	ErrCancelled = errors.New("cancelled by server shutdown")
+)
+
+// cancelWait bounds how long Drain waits for cancelled calls to return.
+const cancelWait = 5 * time.Second
+
+type call struct {
+	description string
+	cancel      context.CancelCauseFunc
+}
+
+// Drainer tracks in-flight tool calls so that they can finish, or be
+// cancelled and reported, before the process exits. A nil *Drainer accepts
+// every call.
+type Drainer struct {
+	mu       sync.Mutex
+	draining bool
+	calls    map[*call]struct{}
+	idle     chan struct{}
+}
+
+func New() *Drainer {
+	return &Drainer{calls: make(map[*call]struct{})}
+}
+
+// Begin registers a call described by description, usually the command. It
+// returns ErrShuttingDown once Drain was called. Otherwise, done must be
+// called when the call returns, and the returned context is cancelled with
+// ErrCancelled when the call outlives the grace period.
+func (d *Drainer) Begin(ctx context.Context, description string) (context.Context, func(), error) {
+	if d == nil {
+		return ctx, func() {}, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.draining {
+		return ctx, func() {}, ErrShuttingDown
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	c := &call{description: description, cancel: cancel}
+	d.calls[c] = struct{}{}
+
+	var once sync.Once
+	done := func() {
+		once.Do(func() {
+			cancel(nil)
+			d.mu.Lock()
+			defer d.mu.Unlock()
+			delete(d.calls, c)
+			if len(d.calls) == 0 && d.idle != nil {
+				close(d.idle)
+				d.idle = nil
+			}
+		})
+	}
+	return ctx, done, nil
+}
+
+// Ready reports whether new calls are accepted.
+func (d *Drainer) Ready() bool {
+	if d == nil {
+		return true
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return !d.draining
+}
+
+// InFlight returns the number of calls that have not returned yet.
+func (d *Drainer) InFlight() int {
+	if d == nil {
+		return 0
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.calls)
+}
+
+// Drain stops accepting calls and waits up to grace for the in-flight ones
+// to return. Calls still running are then cancelled with ErrCancelled, and
+// Drain waits briefly for them to return so that they are audited. It
+// returns the number of cancelled calls.
+func (d *Drainer) Drain(grace time.Duration) int {
+	if d == nil {
+		return 0
+	}
+
+	d.mu.Lock()
+	d.draining = true
+	idle := d.wait()
+	d.mu.Unlock()
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-idle:
+		return 0
+	case <-timer.C:
+	}
+
+	d.mu.Lock()
+	var descriptions []string
+	for c := range d.calls {
+		descriptions = append(descriptions, c.description)
+		c.cancel(ErrCancelled)
+	}
+	d.mu.Unlock()
+	if len(descriptions) == 0 {
+		return 0
+	}
+	logger.Warnf("Cancelling %d tool calls still running after the shutdown grace period of %v: %s", len(descriptions), grace, strings.Join(descriptions, "; "))
+
+	select {
+	case <-idle:
+	case <-time.After(cancelWait):
+		logger.Warnf("%d cancelled tool calls did not return within %v", d.InFlight(), cancelWait)
+	}
+	return len(descriptions)
+}
+
+// wait returns a channel that is closed when no calls are in flight. d.mu
+// must be held.
+func (d *Drainer) wait() <-chan struct{} {
+	if len(d.calls) == 0 {
+		closed := make(chan struct{})
+		close(closed)
+		return closed
+	}
+	if d.idle == nil {
+		d.idle = make(chan struct{})
+	}
+	return d.idle
+}
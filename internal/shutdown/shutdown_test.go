@@ -0,0 +1,80 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestDrainer_WaitsForInFlightCalls(t *testing.T) {
+	d := New()
+	_, done, err := d.Begin(context.Background(), "az group list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	drained := make(chan int)
+	go func() { drained <- d.Drain(time.Minute) }()
+
+	for d.Ready() {
+		time.Sleep(time.Millisecond)
+	}
+	if _, _, err := d.Begin(context.Background(), "az vm list"); !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("Begin() while draining: error = %v, want ErrShuttingDown", err)
+	}
+
+	done()
+	select {
+	case cancelled := <-drained:
+		if cancelled != 0 {
+			t.Errorf("Drain() = %d, want 0", cancelled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Drain() did not return after the last call finished")
+	}
+}
+
+func TestDrainer_CancelsCallsAfterGracePeriod(t *testing.T) {
+	d := New()
+	ctx, done, err := d.Begin(context.Background(), "az vm create")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		<-ctx.Done()
+		done()
+	}()
+	_, idleDone, err := d.Begin(context.Background(), "az group list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idleDone()
+
+	if cancelled := d.Drain(10 * time.Millisecond); cancelled != 1 {
+		t.Errorf("Drain() = %d, want 1", cancelled)
+	}
+	if !errors.Is(context.Cause(ctx), ErrCancelled) {
+		t.Errorf("cause = %v, want ErrCancelled", context.Cause(ctx))
+	}
+	if d.InFlight() != 0 {
+		t.Errorf("InFlight() = %d after Drain", d.InFlight())
+	}
+}
+
+func TestDrainer_Idle(t *testing.T) {
+	d := New()
+	if cancelled := d.Drain(time.Minute); cancelled != 0 {
+		t.Errorf("Drain() = %d, want 0", cancelled)
+	}
+	if d.Ready() {
+		t.Error("Ready() after Drain")
+	}
+
+	var nilDrainer *Drainer
+	ctx, done, err := nilDrainer.Begin(context.Background(), "az group list")
+	done()
+	if err != nil || ctx.Err() != nil || !nilDrainer.Ready() {
+		t.Error("a nil Drainer must accept every call")
+	}
+}
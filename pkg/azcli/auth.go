@@ -2,9 +2,9 @@ package azcli
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
-	"os/exec"
 	"strings"
 
 	"github.com/Azure/azure-api-mcp/internal/logger"
@@ -29,6 +29,10 @@ func (s *DefaultAuthSetup) Setup(ctx context.Context) error {
 		return nil
 	}
 
+	if err := s.setCloud(ctx); err != nil {
+		return err
+	}
+
 	authMethod := s.config.AuthMethod
 	if authMethod == "" || authMethod == "auto" {
 		authMethod = s.detectAuthMethod()
@@ -49,6 +53,29 @@ func (s *DefaultAuthSetup) Setup(ctx context.Context) error {
 	}
 }
 
+// setCloud registers the custom cloud of the identity, if any, and selects
+// Cloud in the config directory, so that the login goes to that cloud.
+func (s *DefaultAuthSetup) setCloud(ctx context.Context) error {
+	if s.config.Cloud == "" {
+		return nil
+	}
+
+	if cloud := s.config.CustomCloud; cloud != nil {
+		// The cloud stays registered in the config directory across restarts.
+		registered := azCommand(ctx, s.config.ConfigDir, "cloud", "show", "--name", cloud.Name, "--output", "none").Run() == nil
+		cmd := azCommand(ctx, s.config.ConfigDir, cloud.registerArgs(registered)...)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to register cloud %s: %w, output: %s", cloud.Name, err, string(output))
+		}
+	}
+
+	cmd := azCommand(ctx, s.config.ConfigDir, "cloud", "set", "--name", s.config.Cloud)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set cloud %s: %w, output: %s", s.config.Cloud, err, string(output))
+	}
+	return nil
+}
+
 func (s *DefaultAuthSetup) setupWorkloadIdentity(ctx context.Context) error {
 	if s.config.FederatedTokenFile == "" {
 		return fmt.Errorf("AZURE_FEDERATED_TOKEN_FILE not set")
@@ -60,8 +87,7 @@ func (s *DefaultAuthSetup) setupWorkloadIdentity(ctx context.Context) error {
 	}
 	token := strings.TrimSpace(string(tokenBytes))
 
-	// #nosec G204 - This is the intended behavior: execute az login with validated config parameters
-	cmd := exec.CommandContext(ctx, "az", "login",
+	cmd := azCommand(ctx, s.config.ConfigDir, "login",
 		"--federated-token", token,
 		"--service-principal",
 		"-u", s.config.ClientID,
@@ -84,7 +110,7 @@ func (s *DefaultAuthSetup) setupManagedIdentity(ctx context.Context) error {
 		args = append(args, "-u", s.config.ClientID)
 	}
 
-	cmd := exec.CommandContext(ctx, "az", args...)
+	cmd := azCommand(ctx, s.config.ConfigDir, args...)
 
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -99,8 +125,7 @@ func (s *DefaultAuthSetup) setupServicePrincipal(ctx context.Context) error {
 		return fmt.Errorf("AZURE_CLIENT_SECRET not set")
 	}
 
-	// #nosec G204 - This is the intended behavior: execute az login with validated config parameters
-	cmd := exec.CommandContext(ctx, "az", "login",
+	cmd := azCommand(ctx, s.config.ConfigDir, "login",
 		"--service-principal",
 		"-u", s.config.ClientID,
 		"-p", s.config.ClientSecret,
@@ -121,8 +146,7 @@ func (s *DefaultAuthSetup) setDefaultSubscription(ctx context.Context) error {
 		return nil
 	}
 
-	// #nosec G204 - This is the intended behavior: execute az account set with validated config parameter
-	cmd := exec.CommandContext(ctx, "az", "account", "set",
+	cmd := azCommand(ctx, s.config.ConfigDir, "account", "set",
 		"--subscription", s.config.DefaultSubscription,
 	)
 
@@ -153,13 +177,55 @@ type AuthValidator interface {
 	ValidateAuth(ctx context.Context) error
 }
 
-type DefaultAuthValidator struct{}
+// DefaultAuthValidator checks the login in ConfigDir, or in the default
+// directory of az when it is "".
+type DefaultAuthValidator struct {
+	ConfigDir string
+}
 
 func (v *DefaultAuthValidator) ValidateAuth(ctx context.Context) error {
-	cmd := exec.CommandContext(ctx, "az", "account", "show", "--output", "json")
+	cmd := azCommand(ctx, v.ConfigDir, "account", "show", "--output", "json")
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("azure CLI authentication failed: %w, output: %s", err, string(output))
 	}
 	return nil
 }
+
+// ActiveCloud returns the name of the cloud az is set to.
+func (v *DefaultAuthValidator) ActiveCloud(ctx context.Context) (string, error) {
+	cmd := azCommand(ctx, v.ConfigDir, "cloud", "show", "--query", "name", "--output", "tsv")
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get active cloud: %w", err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CurrentAccount returns the account az is currently logged in with.
+func (v *DefaultAuthValidator) CurrentAccount(ctx context.Context) (*AccountInfo, error) {
+	cmd := azCommand(ctx, v.ConfigDir, "account", "show", "--output", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get current account: %w", err)
+	}
+
+	var account struct {
+		ID       string `json:"id"`
+		TenantID string `json:"tenantId"`
+		User     struct {
+			Name string `json:"name"`
+			Type string `json:"type"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(output, &account); err != nil {
+		return nil, fmt.Errorf("failed to parse account: %w", err)
+	}
+
+	return &AccountInfo{
+		SubscriptionID: account.ID,
+		TenantID:       account.TenantID,
+		UserName:       account.User.Name,
+		UserType:       account.User.Type,
+	}, nil
+}
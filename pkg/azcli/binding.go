@@ -0,0 +1,206 @@
+package azcli
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// PolicyProfile is a named security policy and read-only setting that policy
+// bindings assign to callers.
+type PolicyProfile struct {
+	ReadOnly bool `yaml:"readOnly"`
+	// EnableSecurityPolicy applies SecurityPolicyFile, or the embedded default
+	// policy when no file is given. Setting SecurityPolicyFile implies it.
+	EnableSecurityPolicy bool   `yaml:"enableSecurityPolicy"`
+	SecurityPolicyFile   string `yaml:"securityPolicyFile"`
+	// ReadOnlyPatternsFile defaults to the server-wide read-only patterns.
+	ReadOnlyPatternsFile string `yaml:"readOnlyPatternsFile"`
+	// Identities are glob patterns of the identities the callers may run
+	// commands as. When empty, they may only use the default identity.
+	Identities []string `yaml:"identities"`
+}
+
+// PolicyBinding selects Policy for callers that satisfy every condition it
+// sets. Conditions are glob patterns ("*" and "?"): Principal matches the
+// authenticated principal (e.g. "jwt:*"), APIKey the name of the API key,
+// Client the MCP client name sent in initialize, and Claims the named token
+// claims. A claim holding a list matches when any of its values does.
+type PolicyBinding struct {
+	Name      string            `yaml:"name"`
+	Policy    string            `yaml:"policy"`
+	Principal string            `yaml:"principal"`
+	APIKey    string            `yaml:"apiKey"`
+	Client    string            `yaml:"client"`
+	Claims    map[string]string `yaml:"claims"`
+}
+
+// PolicyBindings maps callers to named policies. The first matching binding
+// wins; other callers get DefaultPolicy, or the server-wide policy when
+// DefaultPolicy is empty.
+type PolicyBindings struct {
+	Policies      map[string]PolicyProfile `yaml:"policies"`
+	Bindings      []PolicyBinding          `yaml:"bindings"`
+	DefaultPolicy string                   `yaml:"defaultPolicy"`
+}
+
+// Caller identifies the client of a request for policy bindings.
+type Caller struct {
+	// Principal is the authenticated principal, e.g. "api-key:ci".
+	Principal string
+	// APIKey is the name of the API key the caller authenticated with.
+	APIKey     string
+	ClientName string
+	// Claims are the claims of the caller's bearer token.
+	Claims map[string]any
+}
+
+func LoadPolicyBindings(filePath string) (*PolicyBindings, error) {
+	// #nosec G304 - This is the intended behavior: load policy bindings from user-specified path
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy bindings file: %w", err)
+	}
+
+	var bindings PolicyBindings
+	if err := yaml.Unmarshal(data, &bindings); err != nil {
+		return nil, fmt.Errorf("failed to parse policy bindings: %w", err)
+	}
+	if err := bindings.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy bindings: %w", err)
+	}
+	return &bindings, nil
+}
+
+func (b *PolicyBindings) validate() error {
+	if b.DefaultPolicy != "" {
+		if _, ok := b.Policies[b.DefaultPolicy]; !ok {
+			return fmt.Errorf("default policy %q is not defined", b.DefaultPolicy)
+		}
+	}
+	for i, binding := range b.Bindings {
+		name := binding.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if _, ok := b.Policies[binding.Policy]; !ok {
+			return fmt.Errorf("binding %s: policy %q is not defined", name, binding.Policy)
+		}
+		if binding.Principal == "" && binding.APIKey == "" && binding.Client == "" && len(binding.Claims) == 0 {
+			return fmt.Errorf("binding %s: at least one of principal, apiKey, client or claims is required", name)
+		}
+	}
+	return nil
+}
+
+func (b *PolicyBinding) matches(caller Caller) bool {
+	if b.Principal != "" && !globMatch(b.Principal, caller.Principal) {
+		return false
+	}
+	if b.APIKey != "" && !globMatch(b.APIKey, caller.APIKey) {
+		return false
+	}
+	if b.Client != "" && !globMatch(b.Client, caller.ClientName) {
+		return false
+	}
+	for claim, pattern := range b.Claims {
+		if !claimMatches(caller.Claims[claim], pattern) {
+			return false
+		}
+	}
+	return true
+}
+
+func claimMatches(value any, pattern string) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case string:
+		return globMatch(pattern, v)
+	case []any:
+		for _, item := range v {
+			if claimMatches(item, pattern) {
+				return true
+			}
+		}
+		return false
+	default:
+		return globMatch(pattern, fmt.Sprint(v))
+	}
+}
+
+// policySelector picks the validator of the policy bound to a caller.
+type policySelector struct {
+	bindings      []PolicyBinding
+	defaultPolicy string
+	validators    map[string]Validator
+	identities    map[string][]string
+}
+
+// newPolicySelector builds a validator for every policy in bindings. Policies
+// inherit the server-wide settings of cfg they do not override.
+func newPolicySelector(cfg ClientConfig, bindings *PolicyBindings) (*policySelector, error) {
+	s := &policySelector{
+		bindings:      bindings.Bindings,
+		defaultPolicy: bindings.DefaultPolicy,
+		validators:    make(map[string]Validator),
+		identities:    make(map[string][]string),
+	}
+	for name, profile := range bindings.Policies {
+		profileConfig := cfg
+		profileConfig.ReadOnlyMode = profile.ReadOnly
+		profileConfig.EnableSecurityPolicy = profile.EnableSecurityPolicy || profile.SecurityPolicyFile != ""
+		profileConfig.SecurityPolicyFile = profile.SecurityPolicyFile
+		if profile.ReadOnlyPatternsFile != "" {
+			profileConfig.ReadOnlyPatternsFile = profile.ReadOnlyPatternsFile
+		}
+		validator, err := NewDefaultValidator(profileConfig)
+		if err != nil {
+			return nil, fmt.Errorf("policy %s: %w", name, err)
+		}
+		s.validators[name] = validator
+		s.identities[name] = profile.Identities
+	}
+	return s, nil
+}
+
+// selectFor returns the name and validator of the policy bound to caller. It
+// returns a nil validator when the server-wide policy applies.
+func (s *policySelector) selectFor(caller Caller) (string, Validator) {
+	for _, binding := range s.bindings {
+		if binding.matches(caller) {
+			logger.Debugf("Caller %q matched policy binding %q (policy: %s)", caller.Principal, binding.Name, binding.Policy)
+			return binding.Policy, s.validators[binding.Policy]
+		}
+	}
+	if s.defaultPolicy != "" {
+		return s.defaultPolicy, s.validators[s.defaultPolicy]
+	}
+	return "", nil
+}
+
+// identityPatterns returns the identities policy allows. The server-wide
+// policy ("") has none of its own.
+func (s *policySelector) identityPatterns(policy string) []string {
+	if s == nil || policy == "" {
+		return nil
+	}
+	return s.identities[policy]
+}
+
+// allowsIdentity reports whether the identity patterns of a policy allow
+// running commands as identity. Without patterns, only the default identity
+// is allowed.
+func allowsIdentity(patterns []string, identity, defaultIdentity string) bool {
+	if len(patterns) == 0 {
+		return identity == defaultIdentity
+	}
+	for _, pattern := range patterns {
+		if globMatch(pattern, identity) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package azcli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeBindings(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "bindings.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testBindings = `
+policies:
+  readers:
+    readOnly: true
+  platform:
+    enableSecurityPolicy: true
+bindings:
+  - name: platform-admins
+    policy: platform
+    claims:
+      groups: platform-admins
+  - name: ci
+    policy: platform
+    apiKey: ci-*
+  - name: inspector
+    policy: readers
+    client: "inspector*"
+defaultPolicy: readers
+`
+
+func TestLoadPolicyBindings_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "unknown default", content: "policies:\n  a: {}\ndefaultPolicy: b\n", wantErr: `default policy "b"`},
+		{name: "unknown policy", content: "policies:\n  a: {}\nbindings:\n  - name: x\n    policy: b\n    client: c\n", wantErr: `binding x: policy "b"`},
+		{name: "no conditions", content: "policies:\n  a: {}\nbindings:\n  - policy: a\n", wantErr: "binding #1: at least one"},
+	}
+	for _, tt := range tests {
+		_, err := LoadPolicyBindings(writeBindings(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPolicyBinding_Matches(t *testing.T) {
+	claims := map[string]any{
+		"groups": []any{"developers", "platform-admins"},
+		"tid":    "tenant-1",
+		"level":  float64(3),
+	}
+	tests := []struct {
+		name    string
+		binding PolicyBinding
+		caller  Caller
+		want    bool
+	}{
+		{name: "principal glob", binding: PolicyBinding{Principal: "jwt:*"}, caller: Caller{Principal: "jwt:user-1"}, want: true},
+		{name: "principal mismatch", binding: PolicyBinding{Principal: "jwt:*"}, caller: Caller{Principal: "api-key:ci"}},
+		{name: "api key", binding: PolicyBinding{APIKey: "ci"}, caller: Caller{Principal: "api-key:ci", APIKey: "ci"}, want: true},
+		{name: "client name", binding: PolicyBinding{Client: "claude-*"}, caller: Caller{ClientName: "claude-desktop"}, want: true},
+		{name: "list claim", binding: PolicyBinding{Claims: map[string]string{"groups": "platform-*"}}, caller: Caller{Claims: claims}, want: true},
+		{name: "string claim", binding: PolicyBinding{Claims: map[string]string{"tid": "tenant-1"}}, caller: Caller{Claims: claims}, want: true},
+		{name: "number claim", binding: PolicyBinding{Claims: map[string]string{"level": "3"}}, caller: Caller{Claims: claims}, want: true},
+		{name: "missing claim", binding: PolicyBinding{Claims: map[string]string{"roles": "*"}}, caller: Caller{Claims: claims}},
+		{name: "all conditions", binding: PolicyBinding{Client: "claude-*", Claims: map[string]string{"tid": "tenant-1"}}, caller: Caller{ClientName: "vscode", Claims: claims}},
+	}
+	for _, tt := range tests {
+		if got := tt.binding.matches(tt.caller); got != tt.want {
+			t.Errorf("%s: matches() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestClient_EvaluateCommand_PolicyBindings(t *testing.T) {
+	client, err := NewClient(ClientConfig{PolicyBindingsFile: writeBindings(t, testBindings)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := WithCaller(context.Background(), Caller{Principal: "jwt:user-1", Claims: map[string]any{"groups": []any{"platform-admins"}}})
+	ci := WithCaller(context.Background(), Caller{Principal: "api-key:ci-deploy", APIKey: "ci-deploy"})
+	anonymous := context.Background()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		command    string
+		wantPolicy string
+		wantDenied bool
+	}{
+		{name: "bound caller may write", ctx: admin, command: "az group create --name rg1 --location eastus", wantPolicy: "platform"},
+		{name: "bound caller gets the security policy", ctx: ci, command: "az vm delete --name vm1 -g rg1", wantPolicy: "platform", wantDenied: true},
+		{name: "unbound caller reads", ctx: anonymous, command: "az group list", wantPolicy: "readers"},
+		{name: "unbound caller falls back to read-only", ctx: anonymous, command: "az group create --name rg1 --location eastus", wantPolicy: "readers", wantDenied: true},
+	}
+	for _, tt := range tests {
+		validation, err := client.EvaluateCommand(tt.ctx, tt.command)
+		if tt.wantDenied {
+			var azErr *AzCliError
+			if !errors.As(err, &azErr) || azErr.Context["policy"] != tt.wantPolicy {
+				t.Errorf("%s: error = %v, want denial by policy %s", tt.name, err, tt.wantPolicy)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+			continue
+		}
+		if validation.PolicyName != tt.wantPolicy {
+			t.Errorf("%s: PolicyName = %q, want %q", tt.name, validation.PolicyName, tt.wantPolicy)
+		}
+	}
+
+	report, err := client.DryRunCommand(anonymous, "az vm delete --name vm1 -g rg1", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Policy != "readers" || report.Allowed {
+		t.Errorf("dry run: Policy = %q, Allowed = %v", report.Policy, report.Allowed)
+	}
+}
+
+func TestClient_EvaluateCommand_NoDefaultPolicy(t *testing.T) {
+	bindings := "policies:\n  readers:\n    readOnly: true\nbindings:\n  - policy: readers\n    client: inspector\n"
+	client, err := NewClient(ClientConfig{PolicyBindingsFile: writeBindings(t, bindings)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	validation, err := client.EvaluateCommand(context.Background(), "az group create --name rg1 --location eastus")
+	if err != nil {
+		t.Fatalf("unbound callers should get the server-wide policy: %v", err)
+	}
+	if validation.PolicyName != "" {
+		t.Errorf("PolicyName = %q, want empty", validation.PolicyName)
+	}
+
+	inspector := WithCaller(context.Background(), Caller{ClientName: "inspector"})
+	if _, err := client.EvaluateCommand(inspector, "az group create --name rg1 --location eastus"); err == nil {
+		t.Error("bound read-only caller was allowed to write")
+	}
+}
@@ -0,0 +1,451 @@
+package azcli
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+const defaultCacheMaxEntries = 1000
+
+// secretCommands return keys, tokens, connection strings or other
+// credentials, the output counterpart of the flags the audit log redacts.
+// Their results are never cached, so they are neither kept in memory nor
+// written to the cache directory.
+var secretCommands = []string{
+	"account get-access-token",
+	"** keys list",
+	"** list-keys",
+	"** keys show",
+	"** show-keys",
+	"** credential list",
+	"** credential show",
+	"** list-credentials",
+	"** show-connection-string",
+	"** list-connection-strings",
+	"** connection-string show",
+	"** list-publishing-profiles",
+	"** list-publishing-credentials",
+	"** generate-sas",
+	"keyvault secret show",
+	"keyvault secret download",
+	"keyvault key download",
+	"keyvault certificate download",
+}
+
+// isSecretCommand reports whether cmd is one of secretCommands.
+func isSecretCommand(cmd *ParsedCommand) bool {
+	for _, pattern := range secretCommands {
+		if matchCommandPath(strings.Fields(pattern), cmd.commandPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// CacheConfig enables caching of successful read-only command results. The
+// cache is disabled when neither TTL nor any rule sets a positive TTL.
+type CacheConfig struct {
+	// TTL is how long results are kept when no rule matches.
+	TTL time.Duration
+	// Rules override TTL for matching commands; the first match wins. A rule
+	// with a zero TTL disables caching for its commands.
+	Rules []CacheRule
+	// MaxEntries bounds the number of cached results (default 1000). The
+	// oldest entry is evicted first.
+	MaxEntries int
+	// Dir keeps cached results on disk so they survive restarts. When empty,
+	// results are only kept in memory.
+	Dir string
+	// Subscription is the active subscription of az, used in the key of
+	// commands that do not pass --subscription.
+	Subscription string
+	// Subscriptions are the active subscriptions of named identities whose
+	// subscription differs from Subscription.
+	Subscriptions map[string]string
+}
+
+// cacheScope is the scope results are cached in: key names the identity and,
+// when sessions have their own config directories, the session. Commands
+// in one scope share the subscription selected with az account set.
+type cacheScope struct {
+	key string
+	// identity is the name of the identity, which selects the subscription
+	// of scopes that did not run az account set.
+	identity string
+}
+
+// CacheRule sets the TTL of commands whose path matches Command, using the
+// same syntax as policy rules (e.g. "account show", "aks **").
+type CacheRule struct {
+	Command string
+	TTL     time.Duration
+}
+
+// ParseCacheRule parses a rule in the form "<command>=<ttl>", where ttl is a
+// duration such as "5m" or a number of seconds.
+func ParseCacheRule(value string) (CacheRule, error) {
+	command, ttlStr, ok := strings.Cut(value, "=")
+	command = strings.TrimSpace(command)
+	if !ok || command == "" {
+		return CacheRule{}, fmt.Errorf("invalid cache rule %q (expected <command>=<ttl>)", value)
+	}
+
+	ttlStr = strings.TrimSpace(ttlStr)
+	ttl, err := time.ParseDuration(ttlStr)
+	if err != nil {
+		seconds, convErr := strconv.Atoi(ttlStr)
+		if convErr != nil {
+			return CacheRule{}, fmt.Errorf("invalid TTL in cache rule %q: %w", value, err)
+		}
+		ttl = time.Duration(seconds) * time.Second
+	}
+	if ttl < 0 {
+		return CacheRule{}, fmt.Errorf("invalid TTL in cache rule %q: must not be negative", value)
+	}
+	return CacheRule{Command: command, TTL: ttl}, nil
+}
+
+// cacheEntry is a cached result together with the scope used to invalidate
+// it. It is also the on-disk format.
+type cacheEntry struct {
+	Key           string        `json:"key"`
+	Subscription  string        `json:"subscription"`
+	ResourceGroup string        `json:"resourceGroup,omitempty"`
+	ExpiresAt     time.Time     `json:"expiresAt"`
+	Output        string        `json:"output"`
+	Stderr        string        `json:"stderr,omitempty"`
+	Duration      time.Duration `json:"duration"`
+}
+
+// resultCache caches results of read-only commands per identity and
+// subscription.
+type resultCache struct {
+	config CacheConfig
+
+	mu sync.Mutex
+	// selected holds the subscriptions selected with az account set, by
+	// scope key.
+	selected map[string]string
+	// generation counts the invalidations of every entry, and generations
+	// those of each subscription, so that a read that overlapped a write
+	// does not cache its result.
+	generation  uint64
+	generations map[string]uint64
+	entries     map[string]*cacheEntry
+	order       []string
+}
+
+// newResultCache returns nil when caching is disabled.
+func newResultCache(config CacheConfig) (*resultCache, error) {
+	enabled := config.TTL > 0
+	for _, rule := range config.Rules {
+		enabled = enabled || rule.TTL > 0
+	}
+	if !enabled {
+		return nil, nil
+	}
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = defaultCacheMaxEntries
+	}
+
+	c := &resultCache{
+		config:      config,
+		selected:    make(map[string]string),
+		generations: make(map[string]uint64),
+		entries:     make(map[string]*cacheEntry),
+	}
+	if config.Dir != "" {
+		if err := os.MkdirAll(config.Dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create cache directory: %w", err)
+		}
+		c.load()
+	}
+	return c, nil
+}
+
+// ttl returns how long the result of cmd may be cached.
+func (c *resultCache) ttl(cmd *ParsedCommand) time.Duration {
+	if isSecretCommand(cmd) {
+		return 0
+	}
+	for _, rule := range c.config.Rules {
+		if matchCommandPath(strings.Fields(strings.ToLower(rule.Command)), cmd.commandPath) {
+			return rule.TTL
+		}
+	}
+	return c.config.TTL
+}
+
+// key identifies cmd in scope and its active subscription.
+func (c *resultCache) key(cmd *ParsedCommand, scope cacheScope) string {
+	data, _ := json.Marshal(struct {
+		Args         []string `json:"args"`
+		Subscription string   `json:"subscription"`
+		Identity     string   `json:"identity"`
+	}{normalizedArgs(cmd), c.commandSubscription(cmd, scope), scope.key})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizedArgs returns the arguments of cmd with its flags in sorted order,
+// so that commands differing only in flag order compare equal.
+func normalizedArgs(cmd *ParsedCommand) []string {
+	normalized := append([]string{"az"}, cmd.commandPath...)
+	flags := cmd.Flags()
+	names := make([]string, 0, len(flags))
+	for name := range flags {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		normalized = append(normalized, name)
+		normalized = append(normalized, flags[name]...)
+	}
+	normalized = append(normalized, "--")
+	return append(normalized, cmd.positionals...)
+}
+
+// get returns a copy of the cached result for key.
+func (c *resultCache) get(key string) (*Result, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if ok && time.Now().After(entry.ExpiresAt) {
+		c.remove(key)
+		ok = false
+	}
+	if !ok {
+		metrics.CacheLookups.Inc("miss")
+		return nil, false
+	}
+	metrics.CacheLookups.Inc("hit")
+	return &Result{
+		Output:   json.RawMessage(entry.Output),
+		Error:    entry.Stderr,
+		Duration: entry.Duration,
+		Cached:   true,
+	}, true
+}
+
+// generationOf returns the invalidation generation of the entries of cmd in
+// scope. It changes whenever invalidate may have dropped them.
+func (c *resultCache) generationOf(cmd *ParsedCommand, scope cacheScope) uint64 {
+	subscription := strings.ToLower(c.commandSubscription(cmd, scope))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation + c.generations[subscription]
+}
+
+// put caches a successful result of cmd in scope under key. The result is
+// dropped when the generation of cmd is no longer generation, the one read
+// before cmd ran, because a write may have made it stale in the meantime.
+func (c *resultCache) put(key string, scope cacheScope, cmd *ParsedCommand, result *Result, generation uint64) {
+	ttl := c.ttl(cmd)
+	if ttl <= 0 || result.ExitCode != 0 {
+		return
+	}
+
+	subscription := c.commandSubscription(cmd, scope)
+	entry := &cacheEntry{
+		Key:           key,
+		Subscription:  subscription,
+		ResourceGroup: resourceGroupOf(cmd),
+		ExpiresAt:     time.Now().Add(ttl),
+		Output:        string(result.Output),
+		Stderr:        result.Error,
+		Duration:      result.Duration,
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.generation+c.generations[strings.ToLower(subscription)] != generation {
+		logger.Debugf("Not caching result invalidated while it ran: %s", cmd.CommandString())
+		return
+	}
+	c.remove(key)
+	for len(c.order) >= c.config.MaxEntries {
+		c.remove(c.order[0])
+	}
+	c.entries[key] = entry
+	c.order = append(c.order, key)
+
+	if c.config.Dir != "" {
+		data, err := json.Marshal(entry)
+		if err == nil {
+			err = os.WriteFile(c.path(key), data, 0600)
+		}
+		if err != nil {
+			logger.Warnf("Failed to write cache entry: %v", err)
+		}
+	}
+}
+
+// invalidate drops the entries a successful write command may have made
+// stale: those of its resource group and those not scoped to a resource
+// group, such as subscription-wide lists. Writes without a resource group
+// drop every entry of the subscription, and logging in or switching accounts
+// drops everything. Switching subscriptions only affects the scope of cmd.
+func (c *resultCache) invalidate(cmd *ParsedCommand, scope cacheScope) {
+	subscription := c.commandSubscription(cmd, scope)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := strings.Join(cmd.commandPath, " ")
+	switch path {
+	case "login", "logout", "account clear":
+		c.generation++
+		c.removeIf(func(*cacheEntry) bool { return true })
+		return
+	case "account set":
+		if subscription := firstFlagValue(cmd, "--subscription", "-s", "--name", "-n"); subscription != "" {
+			c.selected[scope.key] = subscription
+		}
+		return
+	}
+
+	c.generations[strings.ToLower(subscription)]++
+	resourceGroup := resourceGroupOf(cmd)
+	removed := c.removeIf(func(entry *cacheEntry) bool {
+		if !strings.EqualFold(entry.Subscription, subscription) {
+			return false
+		}
+		return resourceGroup == "" || entry.ResourceGroup == "" || strings.EqualFold(entry.ResourceGroup, resourceGroup)
+	})
+	if removed > 0 {
+		logger.Debugf("Invalidated %d cached results after %s", removed, cmd.CommandString())
+	}
+}
+
+// commandSubscription returns the subscription cmd runs against in scope.
+func (c *resultCache) commandSubscription(cmd *ParsedCommand, scope cacheScope) string {
+	if subscription := firstFlagValue(cmd, "--subscription"); subscription != "" {
+		return subscription
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if subscription, ok := c.selected[scope.key]; ok {
+		return subscription
+	}
+	if subscription, ok := c.config.Subscriptions[scope.identity]; ok {
+		return subscription
+	}
+	return c.config.Subscription
+}
+
+// removeIf drops matching entries and returns how many were dropped. The
+// caller must hold c.mu.
+func (c *resultCache) removeIf(match func(*cacheEntry) bool) int {
+	var keys []string
+	for key, entry := range c.entries {
+		if match(entry) {
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		c.remove(key)
+	}
+	return len(keys)
+}
+
+// remove drops an entry and its file. The caller must hold c.mu.
+func (c *resultCache) remove(key string) {
+	if _, ok := c.entries[key]; !ok {
+		return
+	}
+	delete(c.entries, key)
+	if i := slices.Index(c.order, key); i >= 0 {
+		c.order = slices.Delete(c.order, i, i+1)
+	}
+	if c.config.Dir != "" {
+		if err := os.Remove(c.path(key)); err != nil && !os.IsNotExist(err) {
+			logger.Warnf("Failed to remove cache entry: %v", err)
+		}
+	}
+}
+
+func (c *resultCache) path(key string) string {
+	return filepath.Join(c.config.Dir, key+".json")
+}
+
+// load reads the unexpired entries left on disk by a previous run.
+func (c *resultCache) load() {
+	files, err := filepath.Glob(filepath.Join(c.config.Dir, "*.json"))
+	if err != nil {
+		return
+	}
+
+	var loaded []*cacheEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var entry cacheEntry
+		if err := json.Unmarshal(data, &entry); err != nil || time.Now().After(entry.ExpiresAt) || c.path(entry.Key) != file {
+			_ = os.Remove(file)
+			continue
+		}
+		loaded = append(loaded, &entry)
+	}
+
+	slices.SortFunc(loaded, func(a, b *cacheEntry) int { return a.ExpiresAt.Compare(b.ExpiresAt) })
+	for _, entry := range loaded {
+		c.entries[entry.Key] = entry
+		c.order = append(c.order, entry.Key)
+	}
+	for len(c.order) > c.config.MaxEntries {
+		c.remove(c.order[0])
+	}
+	if len(loaded) > 0 {
+		logger.Infof("Loaded %d cached results from %s", len(c.order), c.config.Dir)
+	}
+}
+
+var resourceGroupInIDPattern = regexp.MustCompile(`(?i)/resourcegroups/([^/]+)`)
+
+// resourceGroupOf returns the resource group cmd targets, or "" when it is
+// not scoped to one.
+func resourceGroupOf(cmd *ParsedCommand) string {
+	if group := firstFlagValue(cmd, "--resource-group", "-g"); group != "" {
+		return group
+	}
+	if len(cmd.commandPath) > 0 && cmd.commandPath[0] == "group" {
+		if group := firstFlagValue(cmd, "--name", "-n"); group != "" {
+			return group
+		}
+	}
+	for _, flag := range []string{"--ids", "--scope"} {
+		for _, id := range cmd.FlagValues(flag) {
+			if match := resourceGroupInIDPattern.FindStringSubmatch(id); match != nil {
+				return match[1]
+			}
+		}
+	}
+	return ""
+}
+
+func firstFlagValue(cmd *ParsedCommand, names ...string) string {
+	for _, name := range names {
+		if values := cmd.FlagValues(name); len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,358 @@
+package azcli
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func mustParse(t *testing.T, cmdStr string) *ParsedCommand {
+	t.Helper()
+	cmd, err := ParseCommand(cmdStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cmd
+}
+
+func TestParseCacheRule(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    CacheRule
+		wantErr bool
+	}{
+		{value: "account show=5m", want: CacheRule{Command: "account show", TTL: 5 * time.Minute}},
+		{value: "aks ** = 30", want: CacheRule{Command: "aks **", TTL: 30 * time.Second}},
+		{value: "group list=0", want: CacheRule{Command: "group list"}},
+		{value: "account show", wantErr: true},
+		{value: "=5m", wantErr: true},
+		{value: "account show=soon", wantErr: true},
+		{value: "account show=-1s", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseCacheRule(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseCacheRule(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseCacheRule(%q) = %+v, want %+v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestResultCache_Key(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{TTL: time.Minute, Subscription: "sub1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := cache.key(mustParse(t, "az vm list -g rg1 --output json"), cacheScope{key: "user1"})
+	if reordered := cache.key(mustParse(t, "az vm list --output json -g rg1"), cacheScope{key: "user1"}); reordered != key {
+		t.Error("reordering flags should not change the key")
+	}
+	if other := cache.key(mustParse(t, "az vm list -g rg1 --output json"), cacheScope{key: "user2"}); other == key {
+		t.Error("the key should depend on the identity")
+	}
+	if other := cache.key(mustParse(t, "az vm list -g rg1 --output json --subscription sub2"), cacheScope{key: "user1"}); other == key {
+		t.Error("the key should depend on the subscription")
+	}
+	if same := cache.key(mustParse(t, "az vm list -g rg1 --output json --subscription sub1"), cacheScope{key: "user1"}); same == key {
+		t.Error("flags are part of the key even when they name the active subscription")
+	}
+}
+
+func TestResultCache_Disabled(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{Rules: []CacheRule{{Command: "account show"}}})
+	if err != nil || cache != nil {
+		t.Errorf("newResultCache() = %v, %v, want nil cache", cache, err)
+	}
+}
+
+func newCacheTestClient(t *testing.T, config CacheConfig, validator *mockValidator, executor *mockExecutor) *DefaultClient {
+	t.Helper()
+	cache, err := newResultCache(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DefaultClient{validator: validator, executor: executor, cache: cache}
+}
+
+func TestClient_ExecuteCommand_CachesReadOnly(t *testing.T) {
+	executor := &mockExecutor{}
+	client := newCacheTestClient(t, CacheConfig{TTL: time.Minute}, &mockValidator{readOnly: true}, executor)
+	ctx := WithIdentity(context.Background(), "user1")
+
+	first, err := client.ExecuteCommand(ctx, "az group list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.ExecuteCommand(ctx, "az group list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if executor.callCount != 1 {
+		t.Errorf("executions = %d, want 1", executor.callCount)
+	}
+	if first.Cached || !second.Cached || string(second.Output) != string(first.Output) {
+		t.Errorf("first.Cached = %v, second = %+v", first.Cached, second)
+	}
+
+	if _, err := client.ExecuteCommand(WithNoCache(ctx), "az group list"); err != nil {
+		t.Fatal(err)
+	}
+	if executor.callCount != 2 {
+		t.Errorf("executions with no_cache = %d, want 2", executor.callCount)
+	}
+
+	if _, err := client.ExecuteCommand(WithIdentity(context.Background(), "user2"), "az group list"); err != nil {
+		t.Fatal(err)
+	}
+	if executor.callCount != 3 {
+		t.Errorf("executions as another identity = %d, want 3", executor.callCount)
+	}
+}
+
+func TestClient_ExecuteCommand_DoesNotCacheWritesOrFailures(t *testing.T) {
+	executor := &mockExecutor{}
+	client := newCacheTestClient(t, CacheConfig{TTL: time.Minute}, &mockValidator{}, executor)
+
+	for i := 0; i < 2; i++ {
+		if _, err := client.ExecuteCommand(context.Background(), "az group create --name rg1 --location eastus"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if executor.callCount != 2 {
+		t.Errorf("write executions = %d, want 2", executor.callCount)
+	}
+
+	executor = &mockExecutor{executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+		return &Result{Output: json.RawMessage("null"), ExitCode: 1, Error: "ERROR: boom"}, nil
+	}}
+	client = newCacheTestClient(t, CacheConfig{TTL: time.Minute}, &mockValidator{readOnly: true}, executor)
+	for i := 0; i < 2; i++ {
+		if _, err := client.ExecuteCommand(context.Background(), "az group list"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if executor.callCount != 2 {
+		t.Errorf("failed executions = %d, want 2", executor.callCount)
+	}
+}
+
+func TestResultCache_RuleTTL(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{
+		TTL:   time.Minute,
+		Rules: []CacheRule{{Command: "account get-access-token"}, {Command: "aks **", TTL: time.Hour}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ttl := cache.ttl(mustParse(t, "az account get-access-token")); ttl != 0 {
+		t.Errorf("ttl(get-access-token) = %v, want 0", ttl)
+	}
+	if ttl := cache.ttl(mustParse(t, "az aks nodepool list")); ttl != time.Hour {
+		t.Errorf("ttl(aks nodepool list) = %v, want 1h", ttl)
+	}
+	if ttl := cache.ttl(mustParse(t, "az group list")); ttl != time.Minute {
+		t.Errorf("ttl(group list) = %v, want 1m", ttl)
+	}
+
+	cmd := mustParse(t, "az account get-access-token")
+	cache.put(cache.key(cmd, cacheScope{}), cacheScope{}, cmd, &Result{Output: json.RawMessage(`{}`)}, cache.generationOf(cmd, cacheScope{}))
+	if _, ok := cache.get(cache.key(cmd, cacheScope{})); ok {
+		t.Error("a command whose rule has a zero TTL should not be cached")
+	}
+}
+
+func TestResultCache_SecretCommands(t *testing.T) {
+	dir := t.TempDir()
+	cache, err := newResultCache(CacheConfig{TTL: time.Minute, Rules: []CacheRule{{Command: "**", TTL: time.Hour}}, Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, command := range []string{
+		"az storage account keys list --account-name sa1",
+		"az keyvault secret show --vault-name kv1 --name s1",
+		"az account get-access-token",
+		"az redis list-keys --name r1 -g rg1",
+		"az sql db show-connection-string --client ado.net",
+		"az acr credential show --name acr1",
+	} {
+		cmd := mustParse(t, command)
+		key := cache.key(cmd, cacheScope{})
+		cache.put(key, cacheScope{}, cmd, &Result{Output: json.RawMessage(`{"value":"s3cret"}`)}, cache.generationOf(cmd, cacheScope{}))
+		if _, ok := cache.get(key); ok {
+			t.Errorf("%s: secret-bearing result was cached", command)
+		}
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*.json")); len(files) != 0 {
+		t.Errorf("secret-bearing results were written to disk: %v", files)
+	}
+
+	if isSecretCommand(mustParse(t, "az storage account list")) || isSecretCommand(mustParse(t, "az keyvault secret list --vault-name kv1")) {
+		t.Error("commands that return no secrets are treated as secret-bearing")
+	}
+}
+
+func TestResultCache_Expires(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{TTL: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := mustParse(t, "az group list")
+	key := cache.key(cmd, cacheScope{})
+	cache.put(key, cacheScope{}, cmd, &Result{Output: json.RawMessage(`[]`)}, cache.generationOf(cmd, cacheScope{}))
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.get(key); ok {
+		t.Error("expired entries should not be returned")
+	}
+}
+
+func TestResultCache_Invalidate(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{TTL: time.Minute, Subscription: "sub1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reads := map[string]string{
+		"rg1":           "az vm list -g rg1",
+		"rg1 by id":     "az vm show --ids /subscriptions/sub1/resourceGroups/RG1/providers/Microsoft.Compute/virtualMachines/vm1",
+		"rg2":           "az vm list -g rg2",
+		"unscoped":      "az vm list",
+		"other sub rg1": "az vm list -g rg1 --subscription sub2",
+	}
+	keys := make(map[string]string)
+	for name, cmdStr := range reads {
+		cmd := mustParse(t, cmdStr)
+		keys[name] = cache.key(cmd, cacheScope{})
+		cache.put(keys[name], cacheScope{}, cmd, &Result{Output: json.RawMessage(`[]`)}, cache.generationOf(cmd, cacheScope{}))
+	}
+
+	cache.invalidate(mustParse(t, "az vm start -g rg1 --name vm1"), cacheScope{})
+
+	for name, wantCached := range map[string]bool{"rg1": false, "rg1 by id": false, "unscoped": false, "rg2": true, "other sub rg1": true} {
+		if _, ok := cache.get(keys[name]); ok != wantCached {
+			t.Errorf("%s: cached = %v after write to rg1, want %v", name, ok, wantCached)
+		}
+	}
+
+	cache.invalidate(mustParse(t, "az login --identity"), cacheScope{})
+	if _, ok := cache.get(keys["other sub rg1"]); ok {
+		t.Error("az login should clear the cache")
+	}
+}
+
+func TestResultCache_SkipsResultsOfReadsOverlappingWrites(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{TTL: time.Minute, Subscription: "sub1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := mustParse(t, "az vm list -g rg1")
+	other := mustParse(t, "az vm list -g rg1 --subscription sub2")
+	key, otherKey := cache.key(read, cacheScope{}), cache.key(other, cacheScope{})
+
+	// Both reads start, then a write to sub1 finishes before they do.
+	generation, otherGeneration := cache.generationOf(read, cacheScope{}), cache.generationOf(other, cacheScope{})
+	cache.invalidate(mustParse(t, "az vm start -g rg1 --name vm1"), cacheScope{})
+	cache.put(key, cacheScope{}, read, &Result{Output: json.RawMessage(`[]`)}, generation)
+	cache.put(otherKey, cacheScope{}, other, &Result{Output: json.RawMessage(`[]`)}, otherGeneration)
+
+	if _, ok := cache.get(key); ok {
+		t.Error("result of a read that overlapped a write to its subscription was cached")
+	}
+	if _, ok := cache.get(otherKey); !ok {
+		t.Error("result of a read in another subscription was not cached")
+	}
+
+	cache.put(key, cacheScope{}, read, &Result{Output: json.RawMessage(`[]`)}, cache.generationOf(read, cacheScope{}))
+	if _, ok := cache.get(key); !ok {
+		t.Error("result of a read that started after the write was not cached")
+	}
+
+	generation = cache.generationOf(other, cacheScope{})
+	cache.invalidate(mustParse(t, "az logout"), cacheScope{})
+	cache.put(otherKey, cacheScope{}, other, &Result{Output: json.RawMessage(`[]`)}, generation)
+	if _, ok := cache.get(otherKey); ok {
+		t.Error("result of a read that overlapped az logout was cached")
+	}
+}
+
+func TestResultCache_AccountSet(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{TTL: time.Minute, Subscription: "sub1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := mustParse(t, "az group list")
+	before := cache.key(cmd, cacheScope{})
+
+	cache.invalidate(mustParse(t, "az account set --subscription sub2"), cacheScope{})
+	if after := cache.key(cmd, cacheScope{}); after == before {
+		t.Error("switching subscriptions should change the key of commands without --subscription")
+	}
+}
+
+func TestResultCache_AccountSetIsScoped(t *testing.T) {
+	cache, err := newResultCache(CacheConfig{
+		TTL:           time.Minute,
+		Subscription:  "sub1",
+		Subscriptions: map[string]string{"deployer": "sub3"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sessionA := cacheScope{key: "user1 session:a", identity: "reader"}
+	sessionB := cacheScope{key: "user1 session:b", identity: "reader"}
+	deployer := cacheScope{key: "user2 as:deployer", identity: "deployer"}
+	list := mustParse(t, "az group list")
+
+	cache.invalidate(mustParse(t, "az account set --subscription sub2"), sessionA)
+	if got := cache.commandSubscription(list, sessionA); got != "sub2" {
+		t.Errorf("subscription of the switching scope = %q, want sub2", got)
+	}
+	if got := cache.commandSubscription(list, sessionB); got != "sub1" {
+		t.Errorf("subscription of another session = %q, want sub1", got)
+	}
+	if got := cache.commandSubscription(list, deployer); got != "sub3" {
+		t.Errorf("subscription of another identity = %q, want sub3", got)
+	}
+
+	// Results cached in session B stay valid after session A switched.
+	key := cache.key(list, sessionB)
+	cache.put(key, sessionB, list, &Result{Output: json.RawMessage(`[]`)}, cache.generationOf(list, sessionB))
+	cache.invalidate(mustParse(t, "az account set --subscription sub4"), sessionA)
+	if _, ok := cache.get(cache.key(list, sessionB)); !ok {
+		t.Error("switching subscriptions in one scope dropped the results of another")
+	}
+}
+
+func TestResultCache_Disk(t *testing.T) {
+	dir := t.TempDir()
+	config := CacheConfig{TTL: time.Minute, Dir: dir}
+	cache, err := newResultCache(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := mustParse(t, "az group list")
+	key := cache.key(cmd, cacheScope{key: "user1"})
+	cache.put(key, cacheScope{}, cmd, &Result{Output: json.RawMessage(`[{"name":"rg1"}]`), Duration: time.Second}, cache.generationOf(cmd, cacheScope{}))
+
+	reloaded, err := newResultCache(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, ok := reloaded.get(key)
+	if !ok || string(result.Output) != `[{"name":"rg1"}]` || result.Duration != time.Second {
+		t.Fatalf("reloaded get() = %+v, %v", result, ok)
+	}
+
+	reloaded.invalidate(mustParse(t, "az group delete --name rg1"), cacheScope{})
+	if again, err := newResultCache(config); err != nil || len(again.entries) != 0 {
+		t.Errorf("invalidated entries should be removed from disk, found %d", len(again.entries))
+	}
+}
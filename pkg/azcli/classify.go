@@ -0,0 +1,229 @@
+package azcli
+
+import (
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// errorClass recognizes one kind of az failure. Codes are the Azure error
+// codes az prints as "(Code)" or "Code: Code"; patterns match the message
+// text. Named groups of fields are added to the error context.
+type errorClass struct {
+	errType  ErrorType
+	codes    []string
+	patterns []*regexp.Regexp
+	fields   []*regexp.Regexp
+}
+
+// errorClasses are checked in order, so classes with more specific patterns
+// come first.
+var errorClasses = []errorClass{
+	{
+		errType: ErrorTypeExtensionNotInstalled,
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)requires the extension`),
+			regexp.MustCompile(`(?i)az extension add --name`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)requires the extension (?P<extension>[\w-]+)`),
+			regexp.MustCompile(`(?i)az extension add --name (?P<extension>[\w-]+)`),
+		},
+	},
+	{
+		errType: ErrorTypeSubscriptionNotFound,
+		codes:   []string{"SubscriptionNotFound", "InvalidSubscriptionId"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)subscription '[^']*' (could not be found|not found|doesn't exist)`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)subscription '(?P<subscription>[^']+)'`),
+		},
+	},
+	{
+		errType: ErrorTypeAuthorizationFailed,
+		codes:   []string{"AuthorizationFailed", "LinkedAuthorizationFailed", "AuthorizationPermissionMismatch", "Forbidden"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)does not have (authorization|permission) to perform action`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)client '(?P<client>[^']+)'`),
+			regexp.MustCompile(`(?i)object id '(?P<object_id>[^']+)'`),
+			regexp.MustCompile(`(?i)perform action '(?P<action>[^']+)'`),
+			regexp.MustCompile(`(?i)over scope '(?P<resource_id>[^']+)'`),
+		},
+	},
+	{
+		errType: ErrorTypeThrottled,
+		codes:   []string{"TooManyRequests", "Throttled", "ThrottlingException", "RequestThrottled"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)too many requests`),
+			regexp.MustCompile(`(?i)\b429 (client error|too many)`),
+			regexp.MustCompile(`(?i)(status|status code|code):? 429\b`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)retry[- ]after\W{0,3}(?P<retry_after>\d+)`),
+			regexp.MustCompile(`(?i)try again (in|after) (?P<retry_after>\d+) seconds?`),
+		},
+	},
+	{
+		errType: ErrorTypeTransient,
+		codes:   []string{"InternalServerError", "InternalError", "ServiceUnavailable", "BadGateway", "GatewayTimeout", "ServerTimeout", "ServerBusy"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)\b50[0234] (server error|internal server error|service unavailable|bad gateway|gateway time-?out)`),
+			regexp.MustCompile(`(?i)(status|status code|code):? 50[0234]\b`),
+			regexp.MustCompile(`(?i)connection (aborted|reset|refused)`),
+			regexp.MustCompile(`(?i)max retries exceeded`),
+			regexp.MustCompile(`(?i)read timed out`),
+			regexp.MustCompile(`(?i)temporary failure in name resolution`),
+			regexp.MustCompile(`(?i)remote end closed connection`),
+		},
+	},
+	{
+		errType: ErrorTypeQuotaExceeded,
+		codes:   []string{"QuotaExceeded", "SkuNotAvailable", "InsufficientQuota"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)exceed(s|ing)? (the )?(approved )?[\w ]*quota`),
+			regexp.MustCompile(`(?i)quota (limit )?(exceeded|reached)`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)current limit:?\s*(?P<current_limit>\d+)`),
+			regexp.MustCompile(`(?i)current usage:?\s*(?P<current_usage>\d+)`),
+			regexp.MustCompile(`(?i)additional required:?\s*(?P<additional_required>\d+)`),
+		},
+	},
+	{
+		errType: ErrorTypeResourceNotFound,
+		codes:   []string{"ResourceNotFound", "ResourceGroupNotFound", "NotFound", "ParentResourceNotFound"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)(was|were|could) not (be )?found`),
+			regexp.MustCompile(`(?i)\bnot found\b`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)resource '(?P<resource>[^']+)' under resource group '(?P<resource_group>[^']+)'`),
+			regexp.MustCompile(`(?i)resource group '(?P<resource_group>[^']+)' could not be found`),
+			regexp.MustCompile(`'(?P<resource_id>/subscriptions/[^']+)'`),
+		},
+	},
+	{
+		errType: ErrorTypeConflict,
+		codes:   []string{"Conflict", "AnotherOperationInProgress", "OperationNotAllowedOnResource", "ResourceGroupBeingDeleted", "ConflictingUserInput"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)another operation is (already )?in progress`),
+		},
+	},
+	{
+		errType: ErrorTypeInvalidArgument,
+		codes:   []string{"InvalidParameter", "InvalidParameterValue", "InvalidRequestContent", "InvalidResourceName", "BadRequest", "InvalidTemplate", "LocationNotAvailableForResourceType"},
+		patterns: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)unrecognized arguments:`),
+			regexp.MustCompile(`(?i)the following arguments are required:`),
+			regexp.MustCompile(`(?i)argument [\w-]+: (invalid|expected)`),
+			regexp.MustCompile(`(?i)is misspelled or not recognized by the system`),
+		},
+		fields: []*regexp.Regexp{
+			regexp.MustCompile(`(?i)argument (?P<argument>--?[\w-]+):`),
+			regexp.MustCompile(`(?i)unrecognized arguments: (?P<argument>.+)`),
+			regexp.MustCompile(`(?im)^Target: (?P<argument>\S+)`),
+		},
+	},
+}
+
+var (
+	errorCodePatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?m)^(?:ERROR: )?\((\w+)\)`),
+		regexp.MustCompile(`(?m)^Code: (\w+)`),
+	}
+	errorLinePattern = regexp.MustCompile(`(?m)^ERROR: (.+)$`)
+)
+
+// classifyError maps the stderr of a failed az command to a specific
+// ErrorType. It returns nil when the failure is not recognized.
+func classifyError(stderr string, cmdStr string) *AzCliError {
+	if strings.TrimSpace(stderr) == "" {
+		return nil
+	}
+	code := errorCode(stderr)
+
+	class := findErrorClass(stderr, code)
+	if class == nil {
+		return nil
+	}
+
+	azErr := NewAzCliError(class.errType, errorMessage(stderr), cmdStr)
+	if code != "" {
+		azErr.WithContext("code", code)
+	}
+	for _, field := range class.fields {
+		match := field.FindStringSubmatch(stderr)
+		if match == nil {
+			continue
+		}
+		for i, name := range field.SubexpNames() {
+			if name == "" || match[i] == "" {
+				continue
+			}
+			if _, exists := azErr.Context[name]; exists {
+				continue
+			}
+			azErr.WithContext(name, fieldValue(name, strings.TrimSpace(match[i])))
+		}
+	}
+	return azErr
+}
+
+// findErrorClass prefers the class of the Azure error code over message
+// patterns, which are less precise.
+func findErrorClass(stderr string, code string) *errorClass {
+	if code != "" {
+		for i := range errorClasses {
+			if slices.Contains(errorClasses[i].codes, code) {
+				return &errorClasses[i]
+			}
+		}
+	}
+	for i := range errorClasses {
+		for _, pattern := range errorClasses[i].patterns {
+			if pattern.MatchString(stderr) {
+				return &errorClasses[i]
+			}
+		}
+	}
+	return nil
+}
+
+// errorCode returns the Azure error code az printed, if any.
+func errorCode(stderr string) string {
+	for _, pattern := range errorCodePatterns {
+		if match := pattern.FindStringSubmatch(stderr); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
+
+// errorMessage returns the first "ERROR:" line of stderr, or else its first
+// non-empty line.
+func errorMessage(stderr string) string {
+	if match := errorLinePattern.FindStringSubmatch(stderr); match != nil {
+		return strings.TrimSpace(match[1])
+	}
+	for _, line := range strings.Split(stderr, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// fieldValue converts numeric fields such as retry_after to integers.
+func fieldValue(name string, value string) any {
+	switch name {
+	case "retry_after", "current_limit", "current_usage", "additional_required":
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return value
+}
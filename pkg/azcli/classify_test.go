@@ -0,0 +1,147 @@
+package azcli
+
+import (
+	"testing"
+)
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name        string
+		stderr      string
+		wantType    ErrorType
+		wantContext map[string]any
+	}{
+		{
+			name: "resource not found",
+			stderr: "ERROR: (ResourceNotFound) The Resource 'Microsoft.Compute/virtualMachines/vm1' under resource group 'rg1' was not found. For more details please go to https://aka.ms/ARMResourceNotFoundFix\n" +
+				"Code: ResourceNotFound\n" +
+				"Message: The Resource 'Microsoft.Compute/virtualMachines/vm1' under resource group 'rg1' was not found.",
+			wantType: ErrorTypeResourceNotFound,
+			wantContext: map[string]any{
+				"code":           "ResourceNotFound",
+				"resource":       "Microsoft.Compute/virtualMachines/vm1",
+				"resource_group": "rg1",
+			},
+		},
+		{
+			name:     "resource group not found",
+			stderr:   "ERROR: (ResourceGroupNotFound) Resource group 'missing-rg' could not be found.\nCode: ResourceGroupNotFound\nMessage: Resource group 'missing-rg' could not be found.",
+			wantType: ErrorTypeResourceNotFound,
+			wantContext: map[string]any{
+				"code":           "ResourceGroupNotFound",
+				"resource_group": "missing-rg",
+			},
+		},
+		{
+			name: "authorization failed",
+			stderr: "ERROR: (AuthorizationFailed) The client 'app@contoso.com' with object id '1111' does not have authorization to perform action " +
+				"'Microsoft.Compute/virtualMachines/delete' over scope '/subscriptions/sub1/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachines/vm1' or the scope is invalid.\n" +
+				"Code: AuthorizationFailed",
+			wantType: ErrorTypeAuthorizationFailed,
+			wantContext: map[string]any{
+				"code":        "AuthorizationFailed",
+				"client":      "app@contoso.com",
+				"object_id":   "1111",
+				"action":      "Microsoft.Compute/virtualMachines/delete",
+				"resource_id": "/subscriptions/sub1/resourceGroups/rg1/providers/Microsoft.Compute/virtualMachines/vm1",
+			},
+		},
+		{
+			name:     "throttled with retry-after",
+			stderr:   "ERROR: (TooManyRequests) The request is being throttled. Retry after 17 seconds.\nCode: TooManyRequests",
+			wantType: ErrorTypeThrottled,
+			wantContext: map[string]any{
+				"code":        "TooManyRequests",
+				"retry_after": 17,
+			},
+		},
+		{
+			name:        "throttled by status code",
+			stderr:      "ERROR: Operation returned an invalid status code 'Too Many Requests'",
+			wantType:    ErrorTypeThrottled,
+			wantContext: map[string]any{},
+		},
+		{
+			name:        "server error",
+			stderr:      "ERROR: (InternalServerError) Encountered internal server error. Diagnostic information: timestamp '20240101T000000Z'.\nCode: InternalServerError",
+			wantType:    ErrorTypeTransient,
+			wantContext: map[string]any{"code": "InternalServerError"},
+		},
+		{
+			name:        "network failure",
+			stderr:      "ERROR: HTTPSConnectionPool(host='management.azure.com', port=443): Max retries exceeded with url: /subscriptions (Caused by NewConnectionError('Failed to establish a new connection: [Errno 111] Connection refused'))",
+			wantType:    ErrorTypeTransient,
+			wantContext: map[string]any{},
+		},
+		{
+			name: "quota exceeded",
+			stderr: "ERROR: (OperationNotAllowed) Operation could not be completed as it results in exceeding approved Total Regional Cores quota. " +
+				"Location: eastus, Current Limit: 10, Current Usage: 8, Additional Required: 4, (Minimum) New Limit Required: 12.",
+			wantType: ErrorTypeQuotaExceeded,
+			wantContext: map[string]any{
+				"code":                "OperationNotAllowed",
+				"current_limit":       10,
+				"current_usage":       8,
+				"additional_required": 4,
+			},
+		},
+		{
+			name:        "conflict",
+			stderr:      "ERROR: (AnotherOperationInProgress) Another operation is in progress on the resource.\nCode: AnotherOperationInProgress",
+			wantType:    ErrorTypeConflict,
+			wantContext: map[string]any{"code": "AnotherOperationInProgress"},
+		},
+		{
+			name:        "invalid parameter",
+			stderr:      "ERROR: (InvalidParameter) The value of parameter name is invalid.\nCode: InvalidParameter\nTarget: name",
+			wantType:    ErrorTypeInvalidArgument,
+			wantContext: map[string]any{"code": "InvalidParameter", "argument": "name"},
+		},
+		{
+			name:        "unrecognized arguments",
+			stderr:      "ERROR: unrecognized arguments: --bogus 1",
+			wantType:    ErrorTypeInvalidArgument,
+			wantContext: map[string]any{"argument": "--bogus 1"},
+		},
+		{
+			name:        "extension not installed",
+			stderr:      "ERROR: The command requires the extension aks-preview. Unable to prompt for extension install confirmation as no tty available. Run 'az extension add --name aks-preview' to install the extension.",
+			wantType:    ErrorTypeExtensionNotInstalled,
+			wantContext: map[string]any{"extension": "aks-preview"},
+		},
+		{
+			name:        "subscription not found",
+			stderr:      "ERROR: Subscription 'does-not-exist' not found. Check the spelling and casing and try again.",
+			wantType:    ErrorTypeSubscriptionNotFound,
+			wantContext: map[string]any{"subscription": "does-not-exist"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			azErr := classifyError(tt.stderr, "az test")
+			if azErr == nil {
+				t.Fatalf("classifyError() = nil, want %s", tt.wantType)
+			}
+			if azErr.Type != tt.wantType {
+				t.Errorf("Type = %s, want %s", azErr.Type, tt.wantType)
+			}
+			for key, want := range tt.wantContext {
+				if got := azErr.Context[key]; got != want {
+					t.Errorf("Context[%q] = %#v, want %#v", key, got, want)
+				}
+			}
+			if azErr.Message == "" || azErr.Message[:5] == "ERROR" {
+				t.Errorf("Message = %q, want the error line without the ERROR prefix", azErr.Message)
+			}
+		})
+	}
+}
+
+func TestClassifyError_Unrecognized(t *testing.T) {
+	for _, stderr := range []string{"", "ERROR: something unexpected happened", "WARNING: deprecated"} {
+		if azErr := classifyError(stderr, "az test"); azErr != nil {
+			t.Errorf("classifyError(%q) = %v, want nil", stderr, azErr)
+		}
+	}
+}
@@ -2,20 +2,45 @@ package azcli
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
 )
 
 type Client interface {
 	ExecuteCommand(ctx context.Context, cmdStr string) (*Result, error)
 	ValidateCommand(cmdStr string) error
+	// EvaluateCommand validates cmdStr and reports how it was classified,
+	// including whether it requires approval before execution.
+	EvaluateCommand(ctx context.Context, cmdStr string) (*ValidationResult, error)
+	// DryRunCommand reports how cmdStr would be validated without executing
+	// it. When whatIf is set and the command has a native preview variant
+	// that passes validation on its own, that variant is executed and its
+	// output included in the report.
+	DryRunCommand(ctx context.Context, cmdStr string, whatIf bool) (*DryRunReport, error)
 }
 
 type DefaultClient struct {
-	validator Validator
-	executor  Executor
-	authSetup AuthSetup
+	validator            Validator
+	policies             *policySelector
+	executor             Executor
+	authSetup            AuthSetup
+	credentials          *CredentialManager
+	credentialsOnce      sync.Once
+	identities           map[string]*CredentialManager
+	defaultIdentity      string
+	allowedIdentities    []string
+	configDirs           *ConfigDirManager
+	allowedOutputFormats []string
+	retry                *retryPolicy
+	cache                *resultCache
+	flights              *flightGroup
 }
 
 func NewClient(cfg ClientConfig) (Client, error) {
@@ -25,47 +50,366 @@ func NewClient(cfg ClientConfig) (Client, error) {
 	}
 
 	executorConfig := ExecutorConfig{
-		Timeout:    cfg.Timeout,
-		WorkingDir: cfg.WorkingDir,
+		Timeout:       cfg.Timeout,
+		WorkingDir:    cfg.WorkingDir,
+		MaxConcurrent: cfg.MaxConcurrent,
+		MaxQueued:     cfg.MaxQueued,
+		QueueTimeout:  cfg.QueueTimeout,
+		MaxOutputSize: cfg.MaxOutputSize,
+		ConfigDirs:    cfg.ConfigDirs,
 	}
 	executor := NewDefaultExecutor(executorConfig)
 
+	var policies *policySelector
+	if cfg.PolicyBindingsFile != "" {
+		bindings, err := LoadPolicyBindings(cfg.PolicyBindingsFile)
+		if err != nil {
+			return nil, err
+		}
+		if policies, err = newPolicySelector(cfg, bindings); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateOutputFormats(cfg.AllowedOutputFormats); err != nil {
+		return nil, err
+	}
+
+	cache, err := newResultCache(cfg.Cache)
+	if err != nil {
+		return nil, err
+	}
+
 	return &DefaultClient{
-		validator: validator,
-		executor:  executor,
-		authSetup: cfg.AuthSetup,
+		validator:            validator,
+		policies:             policies,
+		executor:             executor,
+		authSetup:            cfg.AuthSetup,
+		credentials:          cfg.Credentials,
+		identities:           cfg.Identities,
+		defaultIdentity:      cfg.DefaultIdentity,
+		allowedIdentities:    cfg.AllowedIdentities,
+		configDirs:           cfg.ConfigDirs,
+		allowedOutputFormats: cfg.AllowedOutputFormats,
+		retry:                newRetryPolicy(cfg.Retry),
+		cache:                cache,
+		flights:              newFlightGroup(),
 	}, nil
 }
 
 func (c *DefaultClient) ExecuteCommand(ctx context.Context, cmdStr string) (*Result, error) {
-	if err := c.validator.Validate(cmdStr); err != nil {
+	cmd, expectJSON, err := c.prepare(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+
+	validation, err := c.validate(ctx, cmd)
+	if err != nil {
 		return nil, err
 	}
 
-	result, err := c.executor.Execute(ctx, cmdStr)
+	cacheKey := ""
+	cacheScope := cacheScope{key: c.scope(ctx), identity: c.identityName(ctx)}
+	if c.cache != nil && validation.ReadOnly {
+		cacheKey = c.cache.key(cmd, cacheScope)
+		if !NoCacheFromContext(ctx) {
+			if cached, ok := c.cache.get(cacheKey); ok {
+				logger.Debugf("Serving cached result: %s", cmd.Raw())
+				return cached, nil
+			}
+		}
+	}
+
+	retry := c.retry.allows(validation)
+	var result *Result
+	// Only the caller that runs a read caches its result, and only when no
+	// write invalidated it since az started. Callers that join a read in
+	// flight do not know when it started.
+	var generation uint64
+	ran := false
+	if validation.ReadOnly {
+		result, err = c.flights.do(ctx, flightKey(cmd, c.scope(ctx)), cmd, func(ctx context.Context) (*Result, error) {
+			if c.cache != nil {
+				generation = c.cache.generationOf(cmd, cacheScope)
+			}
+			ran = true
+			return c.executeWithRetry(ctx, cmd, retry)
+		})
+	} else {
+		result, err = c.executeWithRetry(ctx, cmd, retry)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if expectJSON && result.ExitCode == 0 && len(result.Output) > 0 && !json.Valid(result.Output) {
+		return nil, NewAzCliError(ErrorTypeParseOutput, "command output is not valid JSON", cmd.Raw()).
+			WithContext("output_bytes", len(result.Output))
+	}
+
+	if c.cache != nil && result.ExitCode == 0 {
+		if validation.ReadOnly {
+			if ran {
+				c.cache.put(cacheKey, cacheScope, cmd, result, generation)
+			}
+		} else {
+			c.cache.invalidate(cmd, cacheScope)
+		}
+	}
+	return result, nil
+}
+
+// prepare parses cmdStr and normalizes its --output flag, so the command that
+// is validated is the one that is executed. It reports whether the output is
+// expected to be JSON.
+func (c *DefaultClient) prepare(cmdStr string) (*ParsedCommand, bool, error) {
+	cmd, err := parseCommand(cmdStr)
+	if err != nil {
+		return nil, false, err
+	}
+	normalized, expectJSON, err := normalizeOutputFormat(cmd, c.allowedOutputFormats)
+	if err != nil {
+		return nil, false, NewAzCliError(ErrorTypeInvalidCommand, err.Error(), cmdStr)
+	}
+	return normalized, expectJSON, nil
+}
+
+// validatorFor returns the validator of the policy bound to the caller in
+// ctx, and the policy's name ("" for the server-wide policy).
+func (c *DefaultClient) validatorFor(ctx context.Context) (Validator, string) {
+	if c.policies == nil {
+		return c.validator, ""
+	}
+	name, validator := c.policies.selectFor(CallerFromContext(ctx))
+	if validator == nil {
+		return c.validator, ""
+	}
+	return validator, name
+}
+
+// checkIdentity reports an error when the identity selected in ctx does not
+// exist or policy does not allow it.
+func (c *DefaultClient) checkIdentity(ctx context.Context, policy string) error {
+	name := c.identityName(ctx)
+	if name == "" {
+		return nil
+	}
+	if _, ok := c.identities[name]; !ok && name != c.defaultIdentity {
+		return NewAzCliError(ErrorTypeInvalidCommand, fmt.Sprintf("unknown identity %q", name), "").
+			WithContext("identity", name)
+	}
+	if policy == "" {
+		if name != c.defaultIdentity && !allowsIdentity(c.allowedIdentities, name, c.defaultIdentity) {
+			return NewAzCliError(ErrorTypeCommandDenied, fmt.Sprintf("the server does not allow running commands as identity %q", name), "").
+				WithContext("identity", name)
+		}
+		return nil
+	}
+	if !allowsIdentity(c.policies.identityPatterns(policy), name, c.defaultIdentity) {
+		return NewAzCliError(ErrorTypeCommandDenied, fmt.Sprintf("policy %s does not allow running commands as identity %q", policy, name), "").
+			WithContext("identity", name)
+	}
+	return nil
+}
+
+// validate validates cmd against the policy of the caller in ctx.
+func (c *DefaultClient) validate(ctx context.Context, cmd *ParsedCommand) (*ValidationResult, error) {
+	validator, name := c.validatorFor(ctx)
+	validation, err := validator.Validate(cmd)
+	if err == nil {
+		err = c.checkIdentity(ctx, name)
+	}
 	if err != nil {
 		var azErr *AzCliError
-		if errors.As(err, &azErr) && azErr.Type == ErrorTypeAuth && c.authSetup != nil {
+		if name != "" && errors.As(err, &azErr) {
+			azErr.WithContext("policy", name)
+		}
+		return nil, err
+	}
+	validation.PolicyName = name
+	return validation, nil
+}
+
+// execute runs a validated command, re-authenticating once on auth errors.
+func (c *DefaultClient) execute(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+	// Commands started during a credential refresh would fail with the old
+	// credentials.
+	credentials := c.credentialManager(ctx)
+	if err := credentials.Wait(ctx); err != nil {
+		return nil, NewAzCliError(ErrorTypeTimeout, "timed out waiting for the Azure credentials to be refreshed", cmd.Raw())
+	}
+
+	result, err := c.executor.Execute(ctx, cmd)
+	if err != nil {
+		var azErr *AzCliError
+		if errors.As(err, &azErr) && azErr.Type == ErrorTypeAuth && credentials.CanRefresh() {
 			// Authentication retry logic:
 			// When Azure CLI tokens expire (e.g., after long-running server sessions),
 			// we detect auth errors from stderr and automatically re-authenticate using
 			// the configured auth method (workload identity, managed identity, or service principal).
 			// We only retry once to avoid infinite loops. If re-authentication fails, we return
 			// the original auth error to the caller.
+			// Concurrent auth errors share one login through the credential manager, and
+			// repeated login failures suspend re-authentication for a while.
 			logger.Info("Authentication error detected, attempting to re-authenticate")
-			if authErr := c.authSetup.Setup(ctx); authErr != nil {
+			if authErr := credentials.Refresh(ctx, RefreshAuthError); authErr != nil {
+				var openErr *circuitOpenError
+				if errors.As(authErr, &openErr) {
+					logger.Warnf("Not re-authenticating: %v", authErr)
+					recordExecution(cmd, nil, err)
+					retryAfter := int(time.Until(openErr.until).Round(time.Second).Seconds())
+					return nil, NewAzCliError(ErrorTypeAuthCircuitOpen, "Azure authentication failed and re-authentication is suspended after repeated failures", cmd.Raw()).
+						WithContext("retry_after", max(retryAfter, 1))
+				}
 				logger.Errorf("Re-authentication failed: %v", authErr)
+				metrics.AuthRelogins.Inc("failure")
+				recordExecution(cmd, nil, err)
 				return nil, err
 			}
+			metrics.AuthRelogins.Inc("success")
 			logger.Info("Re-authentication successful, retrying command")
-			return c.executor.Execute(ctx, cmdStr)
+			result, err = c.executor.Execute(ctx, cmd)
+			recordExecution(cmd, result, err)
+			return result, err
 		}
+		recordExecution(cmd, nil, err)
 		return nil, err
 	}
 
+	recordExecution(cmd, result, nil)
 	return result, nil
 }
 
+// scope identifies whose results a command may share through the cache and
+// coalescing. With a config directory per session, a session may have
+// selected another subscription or defaults, so results are not shared
+// between sessions.
+func (c *DefaultClient) scope(ctx context.Context) string {
+	identity := IdentityFromContext(ctx)
+	if name := IdentityNameFromContext(ctx); name != "" {
+		identity += " as:" + name
+	}
+	if sessionID := SessionIDFromContext(ctx); c.configDirs.PerSession() && sessionID != "" {
+		return identity + " session:" + sessionID
+	}
+	return identity
+}
+
+// identityName returns the name of the identity commands of ctx run as.
+func (c *DefaultClient) identityName(ctx context.Context) string {
+	if name := IdentityNameFromContext(ctx); name != "" {
+		return name
+	}
+	return c.defaultIdentity
+}
+
+// credentialManager returns the manager that serializes re-authentication
+// of the identity selected in ctx. Without ClientConfig.Credentials, one that
+// runs authSetup is created on first use for the default identity.
+func (c *DefaultClient) credentialManager(ctx context.Context) *CredentialManager {
+	if credentials, ok := c.identities[IdentityNameFromContext(ctx)]; ok {
+		return credentials
+	}
+	c.credentialsOnce.Do(func() {
+		if c.credentials == nil && c.authSetup != nil {
+			c.credentials = NewCredentialManager(CredentialConfig{AuthSetup: c.authSetup})
+		}
+	})
+	return c.credentials
+}
+
+func recordExecution(cmd *ParsedCommand, result *Result, err error) {
+	group := cmd.Group()
+	if err != nil {
+		errorType := string(ErrorTypeExecution)
+		var azErr *AzCliError
+		if errors.As(err, &azErr) {
+			errorType = string(azErr.Type)
+		}
+		metrics.ExecutionErrors.Inc(group, errorType)
+		return
+	}
+
+	metrics.ExitCodes.Inc(group, strconv.Itoa(result.ExitCode))
+	metrics.Duration.Observe(result.Duration.Seconds(), group)
+	metrics.OutputBytes.Observe(float64(len(result.Output)), group)
+}
+
 func (c *DefaultClient) ValidateCommand(cmdStr string) error {
-	return c.validator.Validate(cmdStr)
+	_, err := c.EvaluateCommand(context.Background(), cmdStr)
+	return err
+}
+
+func (c *DefaultClient) EvaluateCommand(ctx context.Context, cmdStr string) (*ValidationResult, error) {
+	cmd, _, err := c.prepare(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+	return c.validate(ctx, cmd)
+}
+
+func (c *DefaultClient) DryRunCommand(ctx context.Context, cmdStr string, whatIf bool) (*DryRunReport, error) {
+	cmd, _, err := c.prepare(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+
+	validator, policyName := c.validatorFor(ctx)
+	report := validator.Explain(cmd)
+	report.Policy = policyName
+	identityErr := c.checkIdentity(ctx, policyName)
+	if report.Identity = c.identityName(ctx); report.Identity != "" {
+		report.addCheck(LayerIdentity, identityErr)
+	}
+
+	preview, err := whatIfCommand(cmd)
+	if err != nil {
+		logger.Warnf("Could not build what-if variant of %s: %v", cmdStr, err)
+		return report, nil
+	}
+	if preview == nil {
+		return report, nil
+	}
+
+	report.WhatIf = &WhatIfReport{Command: preview.Raw()}
+	if !whatIf {
+		report.WhatIf.Reason = "what_if was not requested"
+		return report, nil
+	}
+	// The preview runs with the credentials of the selected identity.
+	if identityErr != nil {
+		report.WhatIf.Reason = identityErr.Error()
+		return report, nil
+	}
+
+	validation, err := validator.Validate(preview)
+	if err != nil {
+		report.WhatIf.Reason = err.Error()
+		return report, nil
+	}
+	if validation.RequiresApproval {
+		report.WhatIf.Reason = "the what-if command itself requires approval"
+		return report, nil
+	}
+
+	result, err := c.execute(ctx, preview)
+	report.WhatIf.Executed = true
+	if err != nil {
+		report.WhatIf.Error = err.Error()
+		return report, nil
+	}
+	exitCode := result.ExitCode
+	report.WhatIf.ExitCode = &exitCode
+	report.WhatIf.DurationMs = result.Duration.Milliseconds()
+	report.WhatIf.Output = result.Output
+	report.WhatIf.Error = result.Error
+	return report, nil
+}
+
+func parseCommand(cmdStr string) (*ParsedCommand, error) {
+	cmd, err := ParseCommand(cmdStr)
+	if err != nil {
+		return nil, NewAzCliError(ErrorTypeInvalidCommand, err.Error(), cmdStr)
+	}
+	return cmd, nil
 }
@@ -4,30 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"reflect"
 	"testing"
 	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/metrics"
 )
 
 type mockValidator struct {
-	validateFunc func(cmdStr string) error
+	validateFunc func(cmd *ParsedCommand) error
+	readOnly     bool
+	policy       *PolicyDecision
 }
 
-func (m *mockValidator) Validate(cmdStr string) error {
+func (m *mockValidator) Validate(cmd *ParsedCommand) (*ValidationResult, error) {
 	if m.validateFunc != nil {
-		return m.validateFunc(cmdStr)
+		if err := m.validateFunc(cmd); err != nil {
+			return nil, err
+		}
 	}
-	return nil
+	return &ValidationResult{Command: cmd, ReadOnly: m.readOnly, Policy: m.policy}, nil
+}
+
+func (m *mockValidator) Explain(cmd *ParsedCommand) *DryRunReport {
+	report := newDryRunReport(cmd)
+	if _, err := m.Validate(cmd); err != nil {
+		report.addCheck(LayerBasicSecurity, err)
+	}
+	return report
 }
 
 type mockExecutor struct {
-	executeFunc func(ctx context.Context, cmdStr string) (*Result, error)
+	executeFunc func(ctx context.Context, cmd *ParsedCommand) (*Result, error)
 	callCount   int
 }
 
-func (m *mockExecutor) Execute(ctx context.Context, cmdStr string) (*Result, error) {
+func (m *mockExecutor) Execute(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
 	m.callCount++
 	if m.executeFunc != nil {
-		return m.executeFunc(ctx, cmdStr)
+		return m.executeFunc(ctx, cmd)
 	}
 	return &Result{
 		Output:   json.RawMessage(`{"status":"ok"}`),
@@ -74,8 +89,8 @@ func TestClient_ExecuteCommand_Success(t *testing.T) {
 func TestClient_ExecuteCommand_ValidationError(t *testing.T) {
 	mockExec := &mockExecutor{}
 	mockVal := &mockValidator{
-		validateFunc: func(cmdStr string) error {
-			return NewAzCliError(ErrorTypeCommandDenied, "command denied", cmdStr)
+		validateFunc: func(cmd *ParsedCommand) error {
+			return NewAzCliError(ErrorTypeCommandDenied, "command denied", cmd.Raw())
 		},
 	}
 
@@ -98,10 +113,10 @@ func TestClient_ExecuteCommand_ValidationError(t *testing.T) {
 func TestClient_ExecuteCommand_AuthRetry(t *testing.T) {
 	firstCall := true
 	mockExec := &mockExecutor{
-		executeFunc: func(ctx context.Context, cmdStr string) (*Result, error) {
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
 			if firstCall {
 				firstCall = false
-				return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmdStr)
+				return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmd.Raw())
 			}
 			return &Result{
 				Output:   json.RawMessage(`{"status":"ok"}`),
@@ -119,6 +134,9 @@ func TestClient_ExecuteCommand_AuthRetry(t *testing.T) {
 		authSetup: mockAuth,
 	}
 
+	reloginsBefore := metrics.AuthRelogins.Value("success")
+	exitCodesBefore := metrics.ExitCodes.Value("vm", "0")
+
 	ctx := context.Background()
 	result, err := client.ExecuteCommand(ctx, "az vm list")
 
@@ -134,12 +152,18 @@ func TestClient_ExecuteCommand_AuthRetry(t *testing.T) {
 	if mockAuth.callCount != 1 {
 		t.Errorf("authSetup.Setup() called %d times, want 1", mockAuth.callCount)
 	}
+	if got := metrics.AuthRelogins.Value("success") - reloginsBefore; got != 1 {
+		t.Errorf("auth re-login metric increased by %v, want 1", got)
+	}
+	if got := metrics.ExitCodes.Value("vm", "0") - exitCodesBefore; got != 1 {
+		t.Errorf("exit code metric increased by %v, want 1", got)
+	}
 }
 
 func TestClient_ExecuteCommand_AuthRetryFailed(t *testing.T) {
 	mockExec := &mockExecutor{
-		executeFunc: func(ctx context.Context, cmdStr string) (*Result, error) {
-			return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmdStr)
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmd.Raw())
 		},
 	}
 	mockVal := &mockValidator{}
@@ -175,8 +199,8 @@ func TestClient_ExecuteCommand_AuthRetryFailed(t *testing.T) {
 
 func TestClient_ExecuteCommand_NoAuthSetup(t *testing.T) {
 	mockExec := &mockExecutor{
-		executeFunc: func(ctx context.Context, cmdStr string) (*Result, error) {
-			return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmdStr)
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmd.Raw())
 		},
 	}
 	mockVal := &mockValidator{}
@@ -200,8 +224,8 @@ func TestClient_ExecuteCommand_NoAuthSetup(t *testing.T) {
 
 func TestClient_ExecuteCommand_NonAuthError(t *testing.T) {
 	mockExec := &mockExecutor{
-		executeFunc: func(ctx context.Context, cmdStr string) (*Result, error) {
-			return nil, NewAzCliError(ErrorTypeExecution, "resource not found", cmdStr)
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			return nil, NewAzCliError(ErrorTypeExecution, "resource not found", cmd.Raw())
 		},
 	}
 	mockVal := &mockValidator{}
@@ -226,3 +250,138 @@ func TestClient_ExecuteCommand_NonAuthError(t *testing.T) {
 		t.Errorf("authSetup.Setup() called %d times, want 0 (should not retry for non-auth errors)", mockAuth.callCount)
 	}
 }
+
+func TestClient_ExecuteCommand_ExecutesValidatedArgs(t *testing.T) {
+	var validated, executed []string
+	mockVal := &mockValidator{
+		validateFunc: func(cmd *ParsedCommand) error {
+			validated = cmd.Args()
+			return nil
+		},
+	}
+	mockExec := &mockExecutor{
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			executed = cmd.Args()
+			return &Result{Output: json.RawMessage(`[]`)}, nil
+		},
+	}
+
+	client := &DefaultClient{
+		validator: mockVal,
+		executor:  mockExec,
+	}
+
+	_, err := client.ExecuteCommand(context.Background(), `az vm list --query "[?name=='a \"b\"']"`)
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+	if !reflect.DeepEqual(validated, executed) {
+		t.Errorf("validated args %q differ from executed args %q", validated, executed)
+	}
+}
+
+func TestClient_ExecuteCommand_ParseError(t *testing.T) {
+	mockExec := &mockExecutor{}
+	client := &DefaultClient{
+		validator: &mockValidator{},
+		executor:  mockExec,
+	}
+
+	_, err := client.ExecuteCommand(context.Background(), `az vm list --name "unclosed`)
+
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeInvalidCommand {
+		t.Errorf("ExecuteCommand() error = %v, want ErrorTypeInvalidCommand", err)
+	}
+	if mockExec.callCount != 0 {
+		t.Errorf("executor.Execute() called %d times, want 0", mockExec.callCount)
+	}
+}
+
+func TestClient_ExecuteCommand_NormalizesOutputFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		allowed []string
+		want    []string
+	}{
+		{
+			name:    "no output flag",
+			command: "az vm list",
+			want:    []string{"az", "vm", "list", "--output", "json"},
+		},
+		{
+			name:    "table replaced",
+			command: "az vm list -o table --resource-group rg",
+			want:    []string{"az", "vm", "list", "--resource-group", "rg", "--output", "json"},
+		},
+		{
+			name:    "json kept",
+			command: "az vm list --output json",
+			want:    []string{"az", "vm", "list", "--output", "json"},
+		},
+		{
+			name:    "allowed format kept",
+			command: "az vm list --output tsv",
+			allowed: []string{"tsv"},
+			want:    []string{"az", "vm", "list", "--output", "tsv"},
+		},
+		{
+			name:    "help left alone",
+			command: "az vm list --help",
+			want:    []string{"az", "vm", "list", "--help"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var validated, executed []string
+			client := &DefaultClient{
+				validator: &mockValidator{validateFunc: func(cmd *ParsedCommand) error {
+					validated = cmd.Args()
+					return nil
+				}},
+				executor: &mockExecutor{executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+					executed = cmd.Args()
+					return &Result{Output: json.RawMessage(`[]`)}, nil
+				}},
+				allowedOutputFormats: tt.allowed,
+			}
+
+			if _, err := client.ExecuteCommand(context.Background(), tt.command); err != nil {
+				t.Fatalf("ExecuteCommand() error = %v", err)
+			}
+			if !reflect.DeepEqual(executed, tt.want) {
+				t.Errorf("executed args = %q, want %q", executed, tt.want)
+			}
+			if !reflect.DeepEqual(validated, executed) {
+				t.Errorf("validated args %q differ from executed args %q", validated, executed)
+			}
+		})
+	}
+}
+
+func TestClient_ExecuteCommand_InvalidJSONOutput(t *testing.T) {
+	output := json.RawMessage("Name    Location\nvm1     eastus")
+	client := &DefaultClient{
+		validator: &mockValidator{},
+		executor: &mockExecutor{executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			return &Result{Output: output}, nil
+		}},
+	}
+
+	_, err := client.ExecuteCommand(context.Background(), "az vm list")
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeParseOutput {
+		t.Errorf("ExecuteCommand() error = %v, want ErrorTypeParseOutput", err)
+	}
+
+	client.allowedOutputFormats = []string{"table"}
+	result, err := client.ExecuteCommand(context.Background(), "az vm list --output table")
+	if err != nil {
+		t.Fatalf("ExecuteCommand() with allowed format error = %v", err)
+	}
+	if string(result.Output) != string(output) {
+		t.Errorf("Output = %q, want %q", result.Output, output)
+	}
+}
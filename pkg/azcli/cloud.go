@@ -0,0 +1,140 @@
+package azcli
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultCloud is the cloud az uses when none is selected.
+const DefaultCloud = "AzureCloud"
+
+// builtinClouds are the clouds az knows without registration.
+var builtinClouds = []string{"AzureCloud", "AzureChinaCloud", "AzureUSGovernment", "AzureGermanCloud"}
+
+// CloudDefinition is a custom cloud, such as an Azure Stack Hub, that is
+// registered with az cloud register before az logs in to it. Endpoints that
+// are left empty are discovered by az from the resource manager endpoint.
+type CloudDefinition struct {
+	Name string `yaml:"name"`
+	// Profile is the API profile of the cloud, e.g. "2020-09-01-hybrid" for
+	// Azure Stack Hub (default: latest).
+	Profile   string         `yaml:"profile"`
+	Endpoints CloudEndpoints `yaml:"endpoints"`
+	Suffixes  CloudSuffixes  `yaml:"suffixes"`
+}
+
+type CloudEndpoints struct {
+	ResourceManager                string `yaml:"resourceManager"`
+	ActiveDirectory                string `yaml:"activeDirectory"`
+	ActiveDirectoryResourceID      string `yaml:"activeDirectoryResourceId"`
+	ActiveDirectoryGraphResourceID string `yaml:"activeDirectoryGraphResourceId"`
+	MicrosoftGraphResourceID       string `yaml:"microsoftGraphResourceId"`
+	Management                     string `yaml:"management"`
+	Gallery                        string `yaml:"gallery"`
+	SQLManagement                  string `yaml:"sqlManagement"`
+	VMImageAliasDoc                string `yaml:"vmImageAliasDoc"`
+}
+
+type CloudSuffixes struct {
+	StorageEndpoint        string `yaml:"storageEndpoint"`
+	KeyVaultDNS            string `yaml:"keyvaultDns"`
+	ACRLoginServerEndpoint string `yaml:"acrLoginServerEndpoint"`
+	SQLServerHostname      string `yaml:"sqlServerHostname"`
+}
+
+// CloudDefinitions are the custom clouds identities can select in addition
+// to the clouds built into az.
+type CloudDefinitions struct {
+	Clouds []CloudDefinition `yaml:"clouds"`
+}
+
+func LoadCloudDefinitions(filePath string) (*CloudDefinitions, error) {
+	// #nosec G304 - This is the intended behavior: load cloud definitions from user-specified path
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read clouds file: %w", err)
+	}
+
+	var definitions CloudDefinitions
+	if err := yaml.Unmarshal(data, &definitions); err != nil {
+		return nil, fmt.Errorf("failed to parse clouds: %w", err)
+	}
+	if err := definitions.validate(); err != nil {
+		return nil, fmt.Errorf("invalid clouds: %w", err)
+	}
+	return &definitions, nil
+}
+
+func (d *CloudDefinitions) validate() error {
+	seen := make(map[string]bool)
+	for i, cloud := range d.Clouds {
+		if !identityNamePattern.MatchString(cloud.Name) {
+			return fmt.Errorf("cloud #%d: invalid name %q (letters, digits, '.', '_' and '-')", i+1, cloud.Name)
+		}
+		if slices.Contains(builtinClouds, cloud.Name) {
+			return fmt.Errorf("cloud %s is built into az and cannot be redefined", cloud.Name)
+		}
+		if seen[cloud.Name] {
+			return fmt.Errorf("cloud %s is defined more than once", cloud.Name)
+		}
+		seen[cloud.Name] = true
+		endpoint, err := url.Parse(cloud.Endpoints.ResourceManager)
+		if err != nil || endpoint.Scheme != "https" || endpoint.Host == "" {
+			return fmt.Errorf("cloud %s: endpoints.resourceManager must be an https URL", cloud.Name)
+		}
+	}
+	return nil
+}
+
+// Resolve checks that name is a built-in or custom cloud. It returns the
+// definition to register for custom clouds, and nil for built-in clouds and
+// for "", which keeps the cloud az is set to.
+func (d *CloudDefinitions) Resolve(name string) (*CloudDefinition, error) {
+	if name == "" || slices.Contains(builtinClouds, name) {
+		return nil, nil
+	}
+	if d != nil {
+		for i := range d.Clouds {
+			if d.Clouds[i].Name == name {
+				return &d.Clouds[i], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("unknown cloud %q (built-in clouds: %s; define custom clouds in a clouds file)", name, strings.Join(builtinClouds, ", "))
+}
+
+// registerArgs returns the arguments of az cloud register, or of az cloud
+// update for a cloud registered before.
+func (c *CloudDefinition) registerArgs(update bool) []string {
+	verb := "register"
+	if update {
+		verb = "update"
+	}
+	args := []string{"cloud", verb, "--name", c.Name}
+	for _, flag := range []struct{ name, value string }{
+		{"--profile", c.Profile},
+		{"--endpoint-resource-manager", c.Endpoints.ResourceManager},
+		{"--endpoint-active-directory", c.Endpoints.ActiveDirectory},
+		{"--endpoint-active-directory-resource-id", c.Endpoints.ActiveDirectoryResourceID},
+		{"--endpoint-active-directory-graph-resource-id", c.Endpoints.ActiveDirectoryGraphResourceID},
+		{"--endpoint-microsoft-graph-resource-id", c.Endpoints.MicrosoftGraphResourceID},
+		{"--endpoint-management", c.Endpoints.Management},
+		{"--endpoint-gallery", c.Endpoints.Gallery},
+		{"--endpoint-sql-management", c.Endpoints.SQLManagement},
+		{"--endpoint-vm-image-alias-doc", c.Endpoints.VMImageAliasDoc},
+		{"--suffix-storage-endpoint", c.Suffixes.StorageEndpoint},
+		{"--suffix-keyvault-dns", c.Suffixes.KeyVaultDNS},
+		{"--suffix-acr-login-server-endpoint", c.Suffixes.ACRLoginServerEndpoint},
+		{"--suffix-sql-server-hostname", c.Suffixes.SQLServerHostname},
+	} {
+		if flag.value != "" {
+			args = append(args, flag.name, flag.value)
+		}
+	}
+	return append(args, "--output", "none")
+}
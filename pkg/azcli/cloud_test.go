@@ -0,0 +1,116 @@
+package azcli
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func writeClouds(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "clouds.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testClouds = `
+clouds:
+  - name: AzureStackUser
+    profile: 2020-09-01-hybrid
+    endpoints:
+      resourceManager: https://management.local.azurestack.external
+    suffixes:
+      storageEndpoint: local.azurestack.external
+      keyvaultDns: .vault.local.azurestack.external
+`
+
+func TestLoadCloudDefinitions(t *testing.T) {
+	clouds, err := LoadCloudDefinitions(writeClouds(t, testClouds))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	custom, err := clouds.Resolve("AzureStackUser")
+	if err != nil || custom == nil {
+		t.Fatalf("Resolve(AzureStackUser) = %v, %v", custom, err)
+	}
+	want := []string{
+		"cloud", "register", "--name", "AzureStackUser",
+		"--profile", "2020-09-01-hybrid",
+		"--endpoint-resource-manager", "https://management.local.azurestack.external",
+		"--suffix-storage-endpoint", "local.azurestack.external",
+		"--suffix-keyvault-dns", ".vault.local.azurestack.external",
+		"--output", "none",
+	}
+	if got := custom.registerArgs(false); !slices.Equal(got, want) {
+		t.Errorf("registerArgs(false) = %v, want %v", got, want)
+	}
+	if got := custom.registerArgs(true); got[1] != "update" {
+		t.Errorf("registerArgs(true) = %v, want az cloud update", got)
+	}
+
+	for _, name := range []string{"", "AzureCloud", "AzureUSGovernment", "AzureChinaCloud"} {
+		if custom, err := clouds.Resolve(name); custom != nil || err != nil {
+			t.Errorf("Resolve(%q) = %v, %v, want nil, nil", name, custom, err)
+		}
+	}
+	if _, err := clouds.Resolve("AzureMoon"); err == nil {
+		t.Error("Resolve() accepted an unknown cloud")
+	}
+
+	// Without a clouds file only the built-in clouds are known.
+	var none *CloudDefinitions
+	if _, err := none.Resolve("AzureStackUser"); err == nil {
+		t.Error("Resolve() on nil definitions accepted a custom cloud")
+	}
+	if custom, err := none.Resolve("AzureUSGovernment"); custom != nil || err != nil {
+		t.Errorf("Resolve(AzureUSGovernment) on nil definitions = %v, %v", custom, err)
+	}
+}
+
+func TestLoadCloudDefinitions_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "missing name", content: "clouds:\n  - endpoints:\n      resourceManager: https://arm\n", wantErr: "cloud #1: invalid name"},
+		{name: "built-in", content: "clouds:\n  - name: AzureCloud\n    endpoints:\n      resourceManager: https://arm\n", wantErr: "built into az"},
+		{name: "duplicate", content: "clouds:\n  - name: a\n    endpoints:\n      resourceManager: https://arm\n  - name: a\n    endpoints:\n      resourceManager: https://arm\n", wantErr: "cloud a is defined more than once"},
+		{name: "missing endpoint", content: "clouds:\n  - name: a\n", wantErr: "resourceManager must be an https URL"},
+		{name: "http endpoint", content: "clouds:\n  - name: a\n    endpoints:\n      resourceManager: http://arm\n", wantErr: "resourceManager must be an https URL"},
+	}
+	for _, tt := range tests {
+		_, err := LoadCloudDefinitions(writeClouds(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestRegisterCallAzTool_Cloud(t *testing.T) {
+	profiles := &IdentityProfiles{
+		DefaultIdentity: "gov",
+		Identities: []AuthConfig{
+			{Name: "gov", Cloud: "AzureUSGovernment"},
+			{Name: "china", Cloud: "AzureChinaCloud"},
+		},
+	}
+	tool := RegisterCallAzTool(true, "", false, profiles)
+	for _, want := range []string{"Cloud: AzureUSGovernment - Use the locations", "- china [cloud: AzureChinaCloud]", "- gov (default)\n"} {
+		if !strings.Contains(tool.Description, want) {
+			t.Errorf("description does not contain %q:\n%s", want, tool.Description)
+		}
+	}
+
+	if desc := generateToolDescription(true, "", false, DefaultCloud); !strings.Contains(desc, "Cloud: AzureCloud\n") {
+		t.Errorf("description does not name the public cloud:\n%s", desc)
+	}
+	if desc := generateToolDescription(true, "", false, ""); strings.Contains(desc, "Cloud:") {
+		t.Errorf("description names a cloud that is not known:\n%s", desc)
+	}
+}
@@ -0,0 +1,144 @@
+package azcli
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+// flightGroup coalesces identical read-only commands that run at the same
+// time, so that they share one az process.
+//
+// The shared execution runs detached from the context of the caller that
+// started it. Each caller waits until the execution finishes or its own
+// context is done; the execution is cancelled only once every caller has
+// given up. Its deadline is the latest deadline of the callers, so that
+// retries within it stop when no caller can use their result anymore.
+type flightGroup struct {
+	mu      sync.Mutex
+	flights map[string]*flight
+}
+
+type flight struct {
+	done    chan struct{}
+	result  *Result
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+
+	deadlineMu  sync.Mutex
+	deadline    time.Time
+	hasDeadline bool
+}
+
+// join extends the deadline of the flight to that of ctx. A caller without
+// a deadline removes it.
+func (f *flight) join(ctx context.Context) {
+	f.deadlineMu.Lock()
+	defer f.deadlineMu.Unlock()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		f.hasDeadline = false
+		return
+	}
+	if deadline.After(f.deadline) {
+		f.deadline = deadline
+	}
+}
+
+// flightContext is the context of a shared execution. It keeps the values of
+// the caller that started it, and reports the latest deadline of the callers.
+type flightContext struct {
+	context.Context
+	f *flight
+}
+
+func (c flightContext) Deadline() (time.Time, bool) {
+	c.f.deadlineMu.Lock()
+	defer c.f.deadlineMu.Unlock()
+	return c.f.deadline, c.f.hasDeadline
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{flights: make(map[string]*flight)}
+}
+
+// flightKey identifies cmd run as identity.
+func flightKey(cmd *ParsedCommand, identity string) string {
+	return identity + "\x00" + strings.Join(normalizedArgs(cmd), "\x00")
+}
+
+// do runs fn for cmd, or waits for the identical command already in flight
+// under key. Each caller gets its own copy of the result.
+func (g *flightGroup) do(ctx context.Context, key string, cmd *ParsedCommand, fn func(context.Context) (*Result, error)) (*Result, error) {
+	if g == nil {
+		return fn(ctx)
+	}
+
+	g.mu.Lock()
+	f, ok := g.flights[key]
+	if ok {
+		f.waiters++
+		f.join(ctx)
+		g.mu.Unlock()
+		metrics.Coalesced.Inc(cmd.Group())
+		logger.Debugf("Joining identical command in flight: %s", cmd.Raw())
+	} else {
+		// The execution keeps the values of ctx, such as the session ID used
+		// for fair scheduling, but not its cancellation.
+		flightCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		f = &flight{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		f.deadline, f.hasDeadline = ctx.Deadline()
+		g.flights[key] = f
+		g.mu.Unlock()
+		go g.run(flightContext{Context: flightCtx, f: f}, key, f, fn)
+	}
+
+	select {
+	case <-f.done:
+		if f.err != nil {
+			return nil, f.err
+		}
+		result := *f.result
+		return &result, nil
+	case <-ctx.Done():
+		g.leave(key, f)
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, NewAzCliError(ErrorTypeTimeout, "command execution timed out", cmd.Raw())
+		}
+		return nil, NewAzCliError(ErrorTypeTimeout, "command was cancelled", cmd.Raw())
+	}
+}
+
+func (g *flightGroup) run(ctx context.Context, key string, f *flight, fn func(context.Context) (*Result, error)) {
+	defer f.cancel()
+	f.result, f.err = fn(ctx)
+
+	g.mu.Lock()
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	g.mu.Unlock()
+	close(f.done)
+}
+
+// leave removes a caller that gave up waiting. When it was the last one, the
+// execution is cancelled and later callers start a new one.
+func (g *flightGroup) leave(key string, f *flight) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	f.waiters--
+	if f.waiters > 0 {
+		return
+	}
+	if g.flights[key] == f {
+		delete(g.flights, key)
+	}
+	f.cancel()
+}
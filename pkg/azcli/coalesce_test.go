@@ -0,0 +1,247 @@
+package azcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// blockingExecutor blocks every execution until release is closed or the
+// execution's context is done.
+type blockingExecutor struct {
+	calls     atomic.Int32
+	release   chan struct{}
+	cancelled chan struct{}
+}
+
+func newBlockingExecutor() *blockingExecutor {
+	return &blockingExecutor{release: make(chan struct{}), cancelled: make(chan struct{}, 8)}
+}
+
+func (e *blockingExecutor) Execute(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+	e.calls.Add(1)
+	select {
+	case <-e.release:
+		return &Result{Output: json.RawMessage(`[{"name":"rg1"}]`)}, nil
+	case <-ctx.Done():
+		e.cancelled <- struct{}{}
+		return nil, ctx.Err()
+	}
+}
+
+func waitForWaiters(t *testing.T, g *flightGroup, key string, want int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		g.mu.Lock()
+		f, ok := g.flights[key]
+		waiters := 0
+		if ok {
+			waiters = f.waiters
+		}
+		g.mu.Unlock()
+		if waiters == want {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d callers", want)
+}
+
+func TestClient_ExecuteCommand_CoalescesIdenticalReads(t *testing.T) {
+	executor := newBlockingExecutor()
+	client := &DefaultClient{validator: &mockValidator{readOnly: true}, executor: executor, flights: newFlightGroup()}
+	ctx := WithIdentity(context.Background(), "user1")
+
+	commands := []string{"az vm list -g rg1 --output json", "az vm list --output json -g rg1", "az vm list -g rg1 --output json"}
+	results := make([]*Result, len(commands))
+	errs := make([]error, len(commands))
+	var wg sync.WaitGroup
+	for i, cmdStr := range commands {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = client.ExecuteCommand(ctx, cmdStr)
+		}()
+	}
+
+	waitForWaiters(t, client.flights, flightKey(mustParse(t, commands[0]), "user1"), len(commands))
+	close(executor.release)
+	wg.Wait()
+
+	if calls := executor.calls.Load(); calls != 1 {
+		t.Errorf("executions = %d, want 1", calls)
+	}
+	for i := range commands {
+		if errs[i] != nil || results[i] == nil || string(results[i].Output) != `[{"name":"rg1"}]` {
+			t.Errorf("caller %d: result = %+v, err = %v", i, results[i], errs[i])
+		}
+	}
+	if results[0] == results[1] {
+		t.Error("callers should get their own copy of the result")
+	}
+}
+
+func TestClient_ExecuteCommand_DoesNotCoalesceAcrossIdentitiesOrWrites(t *testing.T) {
+	tests := []struct {
+		name      string
+		readOnly  bool
+		identity2 string
+	}{
+		{name: "different identities", readOnly: true, identity2: "user2"},
+		{name: "writes", readOnly: false, identity2: "user1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			executor := newBlockingExecutor()
+			client := &DefaultClient{validator: &mockValidator{readOnly: tt.readOnly}, executor: executor, flights: newFlightGroup()}
+
+			var wg sync.WaitGroup
+			for _, identity := range []string{"user1", tt.identity2} {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, _ = client.ExecuteCommand(WithIdentity(context.Background(), identity), "az vm start -g rg1 -n vm1")
+				}()
+			}
+
+			deadline := time.Now().Add(5 * time.Second)
+			for executor.calls.Load() < 2 && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			close(executor.release)
+			wg.Wait()
+
+			if calls := executor.calls.Load(); calls != 2 {
+				t.Errorf("executions = %d, want 2", calls)
+			}
+		})
+	}
+}
+
+func TestClient_ExecuteCommand_CoalescedCancellation(t *testing.T) {
+	executor := newBlockingExecutor()
+	client := &DefaultClient{validator: &mockValidator{readOnly: true}, executor: executor, flights: newFlightGroup()}
+	key := flightKey(mustParse(t, "az group list --output json"), "")
+
+	firstCtx, cancelFirst := context.WithCancel(context.Background())
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := client.ExecuteCommand(firstCtx, "az group list")
+		firstErr <- err
+	}()
+	waitForWaiters(t, client.flights, key, 1)
+
+	second := make(chan *Result, 1)
+	go func() {
+		result, _ := client.ExecuteCommand(context.Background(), "az group list")
+		second <- result
+	}()
+	waitForWaiters(t, client.flights, key, 2)
+
+	cancelFirst()
+	var azErr *AzCliError
+	if err := <-firstErr; !errors.As(err, &azErr) || azErr.Type != ErrorTypeTimeout {
+		t.Errorf("cancelled caller error = %v, want %s", err, ErrorTypeTimeout)
+	}
+	select {
+	case <-executor.cancelled:
+		t.Fatal("the shared execution should keep running while another caller waits")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(executor.release)
+	if result := <-second; result == nil || string(result.Output) != `[{"name":"rg1"}]` {
+		t.Errorf("remaining caller result = %+v", result)
+	}
+}
+
+func TestClient_ExecuteCommand_CoalescedCancellationOfAllCallers(t *testing.T) {
+	executor := newBlockingExecutor()
+	client := &DefaultClient{validator: &mockValidator{readOnly: true}, executor: executor, flights: newFlightGroup()}
+	key := flightKey(mustParse(t, "az group list --output json"), "")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.ExecuteCommand(ctx, "az group list")
+			var azErr *AzCliError
+			if !errors.As(err, &azErr) || azErr.Type != ErrorTypeTimeout {
+				t.Errorf("error = %v, want %s", err, ErrorTypeTimeout)
+			}
+		}()
+	}
+	waitForWaiters(t, client.flights, key, 2)
+	cancel()
+	wg.Wait()
+
+	select {
+	case <-executor.cancelled:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the shared execution should be cancelled once every caller gave up")
+	}
+
+	// A later caller starts a new execution instead of joining the cancelled one.
+	close(executor.release)
+	result, err := client.ExecuteCommand(context.Background(), "az group list")
+	if err != nil || result == nil {
+		t.Errorf("ExecuteCommand() after cancellation = %+v, %v", result, err)
+	}
+	if calls := executor.calls.Load(); calls != 2 {
+		t.Errorf("executions = %d, want 2", calls)
+	}
+}
+
+func TestClient_ExecuteCommand_CoalescedRetryBoundedByDeadline(t *testing.T) {
+	executor := failingExecutor(1, func() error {
+		return NewAzCliError(ErrorTypeThrottled, "throttled", "az vm list").WithContext("retry_after", 60)
+	})
+	client := newRetryTestClient(&mockValidator{readOnly: true}, executor, 3)
+	client.flights = newFlightGroup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.ExecuteCommand(ctx, "az vm list")
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeThrottled {
+		t.Fatalf("ExecuteCommand() error = %v, want the throttling error without waiting for Retry-After", err)
+	}
+	if executor.callCount != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("executions = %d after %v, want 1 without waiting", executor.callCount, time.Since(start))
+	}
+}
+
+func TestFlight_DeadlineIsLatestOfCallers(t *testing.T) {
+	now := time.Now()
+	early, cancelEarly := context.WithDeadline(context.Background(), now.Add(time.Minute))
+	defer cancelEarly()
+	late, cancelLate := context.WithDeadline(context.Background(), now.Add(time.Hour))
+	defer cancelLate()
+
+	f := &flight{}
+	f.deadline, f.hasDeadline = early.Deadline()
+	ctx := flightContext{Context: context.Background(), f: f}
+
+	f.join(late)
+	if deadline, ok := ctx.Deadline(); !ok || !deadline.Equal(now.Add(time.Hour)) {
+		t.Errorf("Deadline() = %v, %v, want the deadline of the later caller", deadline, ok)
+	}
+	f.join(early)
+	if deadline, _ := ctx.Deadline(); !deadline.Equal(now.Add(time.Hour)) {
+		t.Errorf("Deadline() = %v after an earlier caller joined, want it unchanged", deadline)
+	}
+	f.join(context.Background())
+	if _, ok := ctx.Deadline(); ok {
+		t.Error("Deadline() is set after a caller without deadline joined")
+	}
+}
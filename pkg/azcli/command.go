@@ -0,0 +1,278 @@
+package azcli
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// commandSegmentPattern matches a single command group or subcommand token
+// (e.g. "vm", "nodepool", "list-skus"). The first token that does not match
+// ends the command path.
+var commandSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9-]*$`)
+
+// negativeNumberPattern matches values such as "-1" or "-0.5" that start with
+// a dash but must not be treated as flags.
+var negativeNumberPattern = regexp.MustCompile(`^-[0-9]+(\.[0-9]+)?$`)
+
+// globalFlags are Azure CLI flags that take no value and may appear before the
+// command path (e.g. "az --debug vm delete"). They are skipped while the
+// command path is being collected so they cannot be used to hide a command.
+var globalFlags = map[string]bool{
+	"--debug":            true,
+	"--verbose":          true,
+	"--only-show-errors": true,
+	"--help":             true,
+	"-h":                 true,
+}
+
+// globalValueFlags are Azure CLI flags that take a value and may appear before
+// the command path (e.g. "az -o json vm delete"). They are skipped together
+// with their value while the command path is being collected.
+var globalValueFlags = map[string]bool{
+	"--output":       true,
+	"-o":             true,
+	"--query":        true,
+	"--subscription": true,
+}
+
+// ParsedCommand is the tokenized form of an Azure CLI command string. It is
+// the single representation shared by the validator, the read-only matcher
+// and the executor, so the argument vector that is validated is exactly the
+// one that gets executed. Instances can only be created by ParseCommand.
+//
+// The command path holds the command groups and subcommand ("vm", "delete"),
+// lower-cased for matching. Flags are keyed by their lower-cased name
+// including leading dashes ("--resource-group", "-g"); a flag maps to every
+// non-flag token that follows it until the next flag, so "--yes" maps to an
+// empty slice and "--tags a=b c=d" maps to two values.
+type ParsedCommand struct {
+	parsed      bool
+	raw         string
+	args        []string
+	commandPath []string
+	flags       map[string][]string
+	positionals []string
+}
+
+// ParseCommand tokenizes cmdStr using shell-like quoting rules and splits the
+// resulting arguments into command path, flags and positional arguments.
+func ParseCommand(cmdStr string) (*ParsedCommand, error) {
+	args, err := tokenizeCommand(cmdStr)
+	if err != nil {
+		return nil, err
+	}
+
+	if args[0] != "az" {
+		return nil, fmt.Errorf("command must start with 'az'")
+	}
+
+	cmd := &ParsedCommand{
+		parsed: true,
+		raw:    cmdStr,
+		args:   args,
+		flags:  make(map[string][]string),
+	}
+
+	inPath := true
+	currentFlag := ""
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+
+		if arg == "--" {
+			cmd.positionals = append(cmd.positionals, args[i+1:]...)
+			break
+		}
+
+		if isFlagToken(arg) {
+			name, value, hasValue := splitFlagToken(arg)
+			if _, ok := cmd.flags[name]; !ok {
+				cmd.flags[name] = []string{}
+			}
+			if hasValue {
+				cmd.flags[name] = append(cmd.flags[name], value)
+			}
+			if inPath && globalFlags[name] {
+				currentFlag = ""
+				continue
+			}
+			if inPath && globalValueFlags[name] {
+				if !hasValue && i+1 < len(args) {
+					i++
+					cmd.flags[name] = append(cmd.flags[name], args[i])
+				}
+				currentFlag = ""
+				continue
+			}
+			inPath = false
+			currentFlag = name
+			continue
+		}
+
+		if inPath && commandSegmentPattern.MatchString(arg) {
+			cmd.commandPath = append(cmd.commandPath, strings.ToLower(arg))
+			continue
+		}
+		inPath = false
+
+		if currentFlag != "" {
+			cmd.flags[currentFlag] = append(cmd.flags[currentFlag], arg)
+			continue
+		}
+		cmd.positionals = append(cmd.positionals, arg)
+	}
+
+	return cmd, nil
+}
+
+// Raw returns the original command string.
+func (c *ParsedCommand) Raw() string {
+	return c.raw
+}
+
+// Args returns a copy of the full argument vector, starting with "az".
+func (c *ParsedCommand) Args() []string {
+	return append([]string(nil), c.args...)
+}
+
+// CommandPath returns a copy of the command groups and subcommand.
+func (c *ParsedCommand) CommandPath() []string {
+	return append([]string(nil), c.commandPath...)
+}
+
+// HasFlag reports whether the flag was given, regardless of value.
+func (c *ParsedCommand) HasFlag(name string) bool {
+	_, ok := c.flags[strings.ToLower(name)]
+	return ok
+}
+
+// FlagValues returns a copy of the values given for a flag.
+func (c *ParsedCommand) FlagValues(name string) []string {
+	return append([]string(nil), c.flags[strings.ToLower(name)]...)
+}
+
+// Flags returns a copy of the flag map.
+func (c *ParsedCommand) Flags() map[string][]string {
+	flags := make(map[string][]string, len(c.flags))
+	for name, values := range c.flags {
+		flags[name] = append([]string{}, values...)
+	}
+	return flags
+}
+
+// CommandString returns the normalized command path prefixed with "az"
+// (e.g. "az vm list"), without flags or other arguments.
+func (c *ParsedCommand) CommandString() string {
+	return strings.Join(append([]string{"az"}, c.commandPath...), " ")
+}
+
+// Group returns the top-level command group (e.g. "vm"), or "" when the
+// command has no command path.
+func (c *ParsedCommand) Group() string {
+	if len(c.commandPath) == 0 {
+		return ""
+	}
+	return c.commandPath[0]
+}
+
+// Positionals returns a copy of the arguments that are neither part of the
+// command path nor a flag value.
+func (c *ParsedCommand) Positionals() []string {
+	return append([]string(nil), c.positionals...)
+}
+
+// verify checks that c was produced by ParseCommand and that its argument
+// vector still matches what tokenizing the raw command string yields.
+func (c *ParsedCommand) verify() error {
+	if c == nil || !c.parsed {
+		return fmt.Errorf("command was not produced by the command parser")
+	}
+	args, err := tokenizeCommand(c.raw)
+	if err != nil || !slices.Equal(args, c.args) {
+		return fmt.Errorf("command arguments do not match the parsed command string")
+	}
+	if len(c.commandPath) == 0 {
+		return fmt.Errorf("command has no command group or subcommand")
+	}
+	return nil
+}
+
+func isFlagToken(arg string) bool {
+	return len(arg) > 1 && strings.HasPrefix(arg, "-") && !negativeNumberPattern.MatchString(arg)
+}
+
+// splitFlagToken normalizes "--name=value" and "-nvalue" into a flag name and
+// an attached value.
+func splitFlagToken(arg string) (name string, value string, hasValue bool) {
+	if strings.HasPrefix(arg, "--") {
+		if idx := strings.Index(arg, "="); idx > 0 {
+			return strings.ToLower(arg[:idx]), arg[idx+1:], true
+		}
+		return strings.ToLower(arg), "", false
+	}
+	if len(arg) > 2 {
+		return strings.ToLower(arg[:2]), strings.TrimPrefix(arg[2:], "="), true
+	}
+	return strings.ToLower(arg), "", false
+}
+
+func tokenizeCommand(cmdStr string) ([]string, error) {
+	cmdStr = strings.TrimSpace(cmdStr)
+	if cmdStr == "" {
+		return nil, fmt.Errorf("empty command string")
+	}
+
+	args := []string{}
+	var current strings.Builder
+	inQuote := false
+	quoteChar := byte(0)
+
+	// Iterate over bytes rather than runes: every character with special
+	// meaning is ASCII, and writing bytes back keeps multi-byte UTF-8 values
+	// intact.
+	for i := 0; i < len(cmdStr); i++ {
+		ch := cmdStr[i]
+		switch {
+		case ch == '"' || ch == '\'':
+			if !inQuote {
+				inQuote = true
+				quoteChar = ch
+			} else if ch == quoteChar {
+				inQuote = false
+				quoteChar = 0
+			} else {
+				current.WriteByte(ch)
+			}
+		case ch == ' ' && !inQuote:
+			if current.Len() > 0 {
+				args = append(args, current.String())
+				current.Reset()
+			}
+		case ch == '\\' && i+1 < len(cmdStr):
+			next := cmdStr[i+1]
+			if next == '"' || next == '\'' || next == '\\' {
+				current.WriteByte(next)
+				i++
+			} else {
+				current.WriteByte(ch)
+			}
+		default:
+			current.WriteByte(ch)
+		}
+	}
+
+	if inQuote {
+		return nil, fmt.Errorf("unclosed quote in command string")
+	}
+
+	if current.Len() > 0 {
+		args = append(args, current.String())
+	}
+
+	if len(args) == 0 {
+		return nil, fmt.Errorf("no command found")
+	}
+
+	return args, nil
+}
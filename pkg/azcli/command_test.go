@@ -0,0 +1,266 @@
+package azcli
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCommand(t *testing.T) {
+	tests := []struct {
+		name            string
+		input           string
+		wantPath        []string
+		wantFlags       map[string][]string
+		wantPositionals []string
+		wantErr         bool
+	}{
+		{
+			name:      "simple command",
+			input:     "az vm list",
+			wantPath:  []string{"vm", "list"},
+			wantFlags: map[string][]string{},
+		},
+		{
+			name:     "flags with values",
+			input:    "az vm list --resource-group myRG -o json",
+			wantPath: []string{"vm", "list"},
+			wantFlags: map[string][]string{
+				"--resource-group": {"myRG"},
+				"-o":               {"json"},
+			},
+		},
+		{
+			name:     "boolean flag",
+			input:    "az group delete --name myRG --yes",
+			wantPath: []string{"group", "delete"},
+			wantFlags: map[string][]string{
+				"--name": {"myRG"},
+				"--yes":  {},
+			},
+		},
+		{
+			name:     "flag with equals",
+			input:    "az vm show --name=myVM",
+			wantPath: []string{"vm", "show"},
+			wantFlags: map[string][]string{
+				"--name": {"myVM"},
+			},
+		},
+		{
+			name:     "short flag with attached value",
+			input:    "az group show -nmyRG",
+			wantPath: []string{"group", "show"},
+			wantFlags: map[string][]string{
+				"-n": {"myRG"},
+			},
+		},
+		{
+			name:     "multi-value flag",
+			input:    "az group update --name myRG --tags env=dev team=core",
+			wantPath: []string{"group", "update"},
+			wantFlags: map[string][]string{
+				"--name": {"myRG"},
+				"--tags": {"env=dev", "team=core"},
+			},
+		},
+		{
+			name:     "quoted flag value",
+			input:    `az vm list --query "[?name=='my vm']"`,
+			wantPath: []string{"vm", "list"},
+			wantFlags: map[string][]string{
+				"--query": {"[?name=='my vm']"},
+			},
+		},
+		{
+			name:     "negative number value",
+			input:    "az monitor metrics list --offset -1",
+			wantPath: []string{"monitor", "metrics", "list"},
+			wantFlags: map[string][]string{
+				"--offset": {"-1"},
+			},
+		},
+		{
+			name:     "extra spaces",
+			input:    "az  vm   delete  --yes",
+			wantPath: []string{"vm", "delete"},
+			wantFlags: map[string][]string{
+				"--yes": {},
+			},
+		},
+		{
+			name:     "global flag before command path",
+			input:    "az --debug vm delete --name myVM",
+			wantPath: []string{"vm", "delete"},
+			wantFlags: map[string][]string{
+				"--debug": {},
+				"--name":  {"myVM"},
+			},
+		},
+		{
+			name:     "global flags with values before command path",
+			input:    "az -o json --query [0] --subscription=sub1 vm delete --name myVM --yes",
+			wantPath: []string{"vm", "delete"},
+			wantFlags: map[string][]string{
+				"-o":             {"json"},
+				"--query":        {"[0]"},
+				"--subscription": {"sub1"},
+				"--name":         {"myVM"},
+				"--yes":          {},
+			},
+		},
+		{
+			name:            "positional argument",
+			input:           `az find "create a vm"`,
+			wantPath:        []string{"find"},
+			wantFlags:       map[string][]string{},
+			wantPositionals: []string{"create a vm"},
+		},
+		{
+			name:     "mixed case command path",
+			input:    "az VM Delete --Name myVM",
+			wantPath: []string{"vm", "delete"},
+			wantFlags: map[string][]string{
+				"--name": {"myVM"},
+			},
+		},
+		{
+			name:    "empty command",
+			input:   "",
+			wantErr: true,
+		},
+		{
+			name:    "not an az command",
+			input:   "ls -la",
+			wantErr: true,
+		},
+		{
+			name:    "unclosed quote",
+			input:   `az vm list --name "unclosed`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(cmd.CommandPath(), tt.wantPath) {
+				t.Errorf("CommandPath() = %v, want %v", cmd.CommandPath(), tt.wantPath)
+			}
+			if !reflect.DeepEqual(cmd.Flags(), tt.wantFlags) {
+				t.Errorf("Flags() = %v, want %v", cmd.Flags(), tt.wantFlags)
+			}
+			if !reflect.DeepEqual(cmd.Positionals(), tt.wantPositionals) {
+				t.Errorf("Positionals() = %v, want %v", cmd.Positionals(), tt.wantPositionals)
+			}
+		})
+	}
+}
+
+func TestTokenizeCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+		wantErr  bool
+	}{
+		{
+			name:     "simple command",
+			input:    "az vm list",
+			expected: []string{"az", "vm", "list"},
+			wantErr:  false,
+		},
+		{
+			name:     "command with flags",
+			input:    "az vm list --resource-group myRG --output json",
+			expected: []string{"az", "vm", "list", "--resource-group", "myRG", "--output", "json"},
+			wantErr:  false,
+		},
+		{
+			name:     "command with quoted argument",
+			input:    `az vm create --name "my vm" --resource-group myRG`,
+			expected: []string{"az", "vm", "create", "--name", "my vm", "--resource-group", "myRG"},
+			wantErr:  false,
+		},
+		{
+			name:     "command with single quotes",
+			input:    "az vm create --name 'my vm' --resource-group myRG",
+			expected: []string{"az", "vm", "create", "--name", "my vm", "--resource-group", "myRG"},
+			wantErr:  false,
+		},
+		{
+			name:     "command with extra spaces",
+			input:    "az  vm   list  --resource-group  myRG",
+			expected: []string{"az", "vm", "list", "--resource-group", "myRG"},
+			wantErr:  false,
+		},
+		{
+			name:     "escaped quotes",
+			input:    `az vm list --query "[?tags.owner=='a \"b\"']"`,
+			expected: []string{"az", "vm", "list", "--query", `[?tags.owner=='a "b"']`},
+			wantErr:  false,
+		},
+		{
+			name:     "non-ASCII value",
+			input:    "az group create --name grüße --tags owner='José'",
+			expected: []string{"az", "group", "create", "--name", "grüße", "--tags", "owner=José"},
+			wantErr:  false,
+		},
+		{
+			name:     "empty command",
+			input:    "",
+			expected: nil,
+			wantErr:  true,
+		},
+		{
+			name:     "unclosed quote",
+			input:    `az vm list --name "unclosed`,
+			expected: nil,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := tokenizeCommand(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tokenizeCommand() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr {
+				if len(result) != len(tt.expected) {
+					t.Errorf("tokenizeCommand() got %d args, want %d", len(result), len(tt.expected))
+					return
+				}
+				for i := range result {
+					if result[i] != tt.expected[i] {
+						t.Errorf("tokenizeCommand() arg[%d] = %v, want %v", i, result[i], tt.expected[i])
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestParsedCommand_AccessorsReturnCopies(t *testing.T) {
+	cmd, err := ParseCommand("az vm delete --name myVM")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := cmd.Args()
+	args[1] = "group"
+	path := cmd.CommandPath()
+	path[0] = "group"
+	values := cmd.FlagValues("--name")
+	values[0] = "other"
+
+	if cmd.Args()[1] != "vm" || cmd.CommandPath()[0] != "vm" || cmd.FlagValues("--name")[0] != "myVM" {
+		t.Error("mutating returned slices should not change the parsed command")
+	}
+}
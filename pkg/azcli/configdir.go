@@ -0,0 +1,333 @@
+package azcli
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+)
+
+// DefaultIdentity is the name of the identity configured with the auth
+// flags and environment variables.
+const DefaultIdentity = "default"
+
+// credentialFiles are the files of an az configuration directory that hold
+// the login. They are copied into session directories again after the
+// identity logged in again; the other files, such as the selected
+// subscription in azureProfile.json, stay per session.
+var credentialFiles = []string{
+	"msal_token_cache.json",
+	"msal_token_cache.bin",
+	"msal_http_cache.bin",
+	"service_principal_entries.json",
+	"service_principal_entries.bin",
+}
+
+type ConfigDirConfig struct {
+	// Root holds a directory per identity under identities/ and, with
+	// PerSession, a directory per MCP session under sessions/.
+	Root string
+	// PerSession gives each MCP session its own directory, cloned from the
+	// directory of the identity on first use.
+	PerSession bool
+	// DefaultIdentity is the identity of commands that do not select one
+	// with WithIdentityName (default: DefaultIdentity).
+	DefaultIdentity string
+	// IdleTimeout removes session directories that were not used for this
+	// long (default 1 hour), for sessions that end without being
+	// unregistered.
+	IdleTimeout time.Duration
+}
+
+type sessionDir struct {
+	mu   sync.Mutex
+	path string
+	// synced is the modification time of the identity's credentials when
+	// they were last copied.
+	synced   time.Time
+	lastUsed time.Time
+}
+
+// ConfigDirManager manages the AZURE_CONFIG_DIR that az runs with, so that
+// commands such as az account set or az config set in one session do not
+// change the defaults of other sessions. A nil *ConfigDirManager leaves az
+// on its default directory.
+type ConfigDirManager struct {
+	config ConfigDirConfig
+
+	mu       sync.Mutex
+	sessions map[sessionKey]*sessionDir
+}
+
+// sessionKey identifies the directory of an identity in a session.
+type sessionKey struct {
+	sessionID string
+	identity  string
+}
+
+// NewConfigDirManager creates the directories below config.Root. Session
+// directories left over from a previous run are removed.
+func NewConfigDirManager(config ConfigDirConfig) (*ConfigDirManager, error) {
+	if config.Root == "" {
+		return nil, fmt.Errorf("config directory root is required")
+	}
+	if config.IdleTimeout == 0 {
+		config.IdleTimeout = time.Hour
+	}
+	if config.DefaultIdentity == "" {
+		config.DefaultIdentity = DefaultIdentity
+	}
+	root, err := filepath.Abs(config.Root)
+	if err != nil {
+		return nil, fmt.Errorf("invalid config directory root: %w", err)
+	}
+	config.Root = root
+
+	m := &ConfigDirManager{config: config, sessions: make(map[sessionKey]*sessionDir)}
+	if err := os.RemoveAll(m.sessionsRoot()); err != nil {
+		return nil, fmt.Errorf("failed to remove old session config directories: %w", err)
+	}
+	for _, dir := range []string{filepath.Join(root, "identities"), m.sessionsRoot()} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, fmt.Errorf("failed to create config directory: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// PerSession reports whether sessions get their own directories.
+func (m *ConfigDirManager) PerSession() bool {
+	return m != nil && m.config.PerSession
+}
+
+// IdentityDir returns the directory of identity, creating it if needed.
+// Logins of the identity are made in it.
+func (m *ConfigDirManager) IdentityDir(identity string) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	if !identityNamePattern.MatchString(identity) {
+		return "", fmt.Errorf("invalid identity name %q", identity)
+	}
+	dir := filepath.Join(m.config.Root, "identities", identity)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+	return dir, nil
+}
+
+// Dir returns the directory commands of ctx run with. Without PerSession or
+// a session ID, this is the directory of the identity selected in ctx.
+func (m *ConfigDirManager) Dir(ctx context.Context) (string, error) {
+	if m == nil {
+		return "", nil
+	}
+	identity := IdentityNameFromContext(ctx)
+	if identity == "" {
+		identity = m.config.DefaultIdentity
+	}
+	identityDir, err := m.IdentityDir(identity)
+	if err != nil {
+		return "", err
+	}
+	sessionID := SessionIDFromContext(ctx)
+	if !m.config.PerSession || sessionID == "" {
+		return identityDir, nil
+	}
+
+	key := sessionKey{sessionID: sessionID, identity: identity}
+	m.mu.Lock()
+	session, ok := m.sessions[key]
+	if !ok {
+		session = &sessionDir{path: filepath.Join(m.sessionsRoot(), sessionDirName(sessionID), identity)}
+		m.sessions[key] = session
+	}
+	session.lastUsed = time.Now()
+	m.mu.Unlock()
+
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	if err := session.sync(identityDir); err != nil {
+		return "", fmt.Errorf("failed to prepare the config directory of the session: %w", err)
+	}
+	return session.path, nil
+}
+
+// sync clones identityDir on first use, and copies the credentials again
+// when the identity logged in since. s.mu must be held.
+func (s *sessionDir) sync(identityDir string) error {
+	modTime := credentialsModTime(identityDir)
+	if _, err := os.Stat(s.path); err == nil {
+		if !modTime.After(s.synced) {
+			return nil
+		}
+		for _, name := range credentialFiles {
+			if err := copyFile(filepath.Join(identityDir, name), filepath.Join(s.path, name)); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+		s.synced = modTime
+		return nil
+	}
+
+	if err := os.MkdirAll(s.path, 0700); err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(identityDir)
+	if err != nil {
+		return err
+	}
+	// Only top-level files are copied; subdirectories hold logs, command
+	// history and extensions.
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(identityDir, entry.Name()), filepath.Join(s.path, entry.Name())); err != nil {
+			return err
+		}
+	}
+	s.synced = modTime
+	return nil
+}
+
+// Release removes the directories of an ended session.
+func (m *ConfigDirManager) Release(sessionID string) {
+	if !m.PerSession() || sessionID == "" {
+		return
+	}
+	m.mu.Lock()
+	found := false
+	for key := range m.sessions {
+		if key.sessionID == sessionID {
+			delete(m.sessions, key)
+			found = true
+		}
+	}
+	m.mu.Unlock()
+	if !found {
+		return
+	}
+	if err := os.RemoveAll(filepath.Join(m.sessionsRoot(), sessionDirName(sessionID))); err != nil {
+		logger.Warnf("Failed to remove the config directory of session %s: %v", sessionID, err)
+		return
+	}
+	logger.Debugf("Removed the config directory of session %s", sessionID)
+}
+
+// Start removes idle session directories every minute until ctx ends.
+func (m *ConfigDirManager) Start(ctx context.Context) {
+	if !m.PerSession() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.removeIdle()
+			}
+		}
+	}()
+}
+
+func (m *ConfigDirManager) removeIdle() {
+	// A session is idle when none of its directories was used.
+	m.mu.Lock()
+	lastUsed := make(map[string]time.Time)
+	for key, session := range m.sessions {
+		if session.lastUsed.After(lastUsed[key.sessionID]) {
+			lastUsed[key.sessionID] = session.lastUsed
+		}
+	}
+	m.mu.Unlock()
+	var idle []string
+	for sessionID, used := range lastUsed {
+		if time.Since(used) > m.config.IdleTimeout {
+			idle = append(idle, sessionID)
+		}
+	}
+	for _, sessionID := range idle {
+		m.Release(sessionID)
+	}
+}
+
+// Close removes all session directories.
+func (m *ConfigDirManager) Close() error {
+	if !m.PerSession() {
+		return nil
+	}
+	m.mu.Lock()
+	m.sessions = make(map[sessionKey]*sessionDir)
+	m.mu.Unlock()
+	return os.RemoveAll(m.sessionsRoot())
+}
+
+func (m *ConfigDirManager) sessionsRoot() string {
+	return filepath.Join(m.config.Root, "sessions")
+}
+
+// sessionDirName turns a session ID, which the client may choose, into a
+// safe directory name.
+func sessionDirName(sessionID string) string {
+	sum := sha256.Sum256([]byte(sessionID))
+	return hex.EncodeToString(sum[:16])
+}
+
+// credentialsModTime returns the latest modification time of the credential
+// files in dir.
+func credentialsModTime(dir string) time.Time {
+	var latest time.Time
+	for _, name := range credentialFiles {
+		if info, err := os.Stat(filepath.Join(dir, name)); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest
+}
+
+// copyFile copies src to dst through a temporary file, so that az never
+// reads a partially written file.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.CreateTemp(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(out.Name()) }()
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), dst)
+}
+
+// azCommand returns an az command that runs with configDir as its
+// AZURE_CONFIG_DIR, or with the default directory when configDir is "".
+func azCommand(ctx context.Context, configDir string, args ...string) *exec.Cmd {
+	// #nosec G204 - This is the intended behavior: execute az with arguments built by the server
+	cmd := exec.CommandContext(ctx, "az", args...)
+	if configDir != "" {
+		cmd.Env = append(os.Environ(), "AZURE_CONFIG_DIR="+configDir)
+	}
+	return cmd
+}
@@ -0,0 +1,149 @@
+package azcli
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestConfigDirManager_SessionsAreIsolated(t *testing.T) {
+	root := t.TempDir()
+	// Directories of a previous run are removed.
+	stale := filepath.Join(root, "sessions", "stale")
+	if err := os.MkdirAll(stale, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewConfigDirManager(ConfigDirConfig{Root: root, PerSession: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale session directory was not removed: %v", err)
+	}
+
+	identityDir, err := m.IdentityDir(DefaultIdentity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(identityDir, "azureProfile.json"), "subscription-a")
+	writeTestFile(t, filepath.Join(identityDir, "msal_token_cache.json"), "token-1")
+
+	dirA, err := m.Dir(WithSessionID(context.Background(), "session-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dirB, err := m.Dir(WithSessionID(context.Background(), "session-b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dirA == dirB || dirA == identityDir {
+		t.Fatalf("sessions share a directory: %s, %s", dirA, dirB)
+	}
+	if got := readTestFile(t, filepath.Join(dirA, "msal_token_cache.json")); got != "token-1" {
+		t.Errorf("cloned token cache = %q", got)
+	}
+
+	// az account set in session A does not affect session B.
+	writeTestFile(t, filepath.Join(dirA, "azureProfile.json"), "subscription-b")
+	if got := readTestFile(t, filepath.Join(dirB, "azureProfile.json")); got != "subscription-a" {
+		t.Errorf("session B profile = %q", got)
+	}
+
+	// A new login of the identity reaches the sessions, but their profiles
+	// are kept.
+	writeTestFile(t, filepath.Join(identityDir, "msal_token_cache.json"), "token-2")
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(identityDir, "msal_token_cache.json"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.Dir(WithSessionID(context.Background(), "session-a")); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTestFile(t, filepath.Join(dirA, "msal_token_cache.json")); got != "token-2" {
+		t.Errorf("token cache after login = %q, want token-2", got)
+	}
+	if got := readTestFile(t, filepath.Join(dirA, "azureProfile.json")); got != "subscription-b" {
+		t.Errorf("profile after login = %q, want subscription-b", got)
+	}
+
+	// Commands outside a session use the identity's directory.
+	if dir, err := m.Dir(context.Background()); err != nil || dir != identityDir {
+		t.Errorf("Dir() without session = %q, %v, want %q", dir, err, identityDir)
+	}
+
+	m.Release("session-a")
+	if _, err := os.Stat(dirA); !os.IsNotExist(err) {
+		t.Errorf("session directory still exists after Release: %v", err)
+	}
+	if err := m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dirB); !os.IsNotExist(err) {
+		t.Errorf("session directory still exists after Close: %v", err)
+	}
+}
+
+func TestConfigDirManager_RemovesIdleSessions(t *testing.T) {
+	m, err := NewConfigDirManager(ConfigDirConfig{Root: t.TempDir(), PerSession: true, IdleTimeout: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := m.Dir(WithSessionID(context.Background(), "session-a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	m.removeIdle()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("idle session directory was not removed: %v", err)
+	}
+}
+
+func TestConfigDirManager_Nil(t *testing.T) {
+	var m *ConfigDirManager
+	dir, err := m.Dir(WithSessionID(context.Background(), "session-a"))
+	if dir != "" || err != nil || m.PerSession() {
+		t.Errorf("nil manager: Dir() = %q, %v", dir, err)
+	}
+	m.Release("session-a")
+	if err := m.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestClient_SessionConfigDirsSeparateCache(t *testing.T) {
+	m, err := NewConfigDirManager(ConfigDirConfig{Root: t.TempDir(), PerSession: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &DefaultClient{configDirs: m}
+	ctxA := WithSessionID(context.Background(), "session-a")
+	ctxB := WithSessionID(context.Background(), "session-b")
+	if client.scope(ctxA) == client.scope(ctxB) {
+		t.Error("sessions with their own config directories share cached results")
+	}
+
+	shared := &DefaultClient{}
+	if shared.scope(ctxA) != shared.scope(ctxB) {
+		t.Error("sessions sharing the config directory do not share cached results")
+	}
+}
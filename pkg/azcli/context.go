@@ -0,0 +1,75 @@
+package azcli
+
+import (
+	"context"
+)
+
+type contextKey int
+
+const (
+	sessionIDKey contextKey = iota
+	identityKey
+	noCacheKey
+	callerKey
+	identityNameKey
+)
+
+// WithSessionID returns a context carrying the MCP session ID of the caller.
+// The executor uses it to share execution slots fairly between sessions.
+func WithSessionID(ctx context.Context, sessionID string) context.Context {
+	return context.WithValue(ctx, sessionIDKey, sessionID)
+}
+
+// SessionIDFromContext returns the session ID set by WithSessionID, or "".
+func SessionIDFromContext(ctx context.Context) string {
+	sessionID, _ := ctx.Value(sessionIDKey).(string)
+	return sessionID
+}
+
+// WithIdentity returns a context carrying the Azure identity commands run as.
+// The result cache keys entries on it.
+func WithIdentity(ctx context.Context, identity string) context.Context {
+	return context.WithValue(ctx, identityKey, identity)
+}
+
+// IdentityFromContext returns the identity set by WithIdentity, or "".
+func IdentityFromContext(ctx context.Context) string {
+	identity, _ := ctx.Value(identityKey).(string)
+	return identity
+}
+
+// WithIdentityName returns a context selecting the named identity that
+// commands run as.
+func WithIdentityName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, identityNameKey, name)
+}
+
+// IdentityNameFromContext returns the name set by WithIdentityName, or "".
+func IdentityNameFromContext(ctx context.Context) string {
+	name, _ := ctx.Value(identityNameKey).(string)
+	return name
+}
+
+// WithNoCache returns a context that bypasses cached results. A fresh result
+// still replaces the cached one.
+func WithNoCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey, true)
+}
+
+// NoCacheFromContext reports whether WithNoCache was applied.
+func NoCacheFromContext(ctx context.Context) bool {
+	noCache, _ := ctx.Value(noCacheKey).(bool)
+	return noCache
+}
+
+// WithCaller returns a context carrying the client of the request, which
+// selects the policy of its commands when policy bindings are configured.
+func WithCaller(ctx context.Context, caller Caller) context.Context {
+	return context.WithValue(ctx, callerKey, caller)
+}
+
+// CallerFromContext returns the caller set by WithCaller, or a zero Caller.
+func CallerFromContext(ctx context.Context) Caller {
+	caller, _ := ctx.Value(callerKey).(Caller)
+	return caller
+}
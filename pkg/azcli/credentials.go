@@ -0,0 +1,442 @@
+package azcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+// CredentialStatus describes the Azure credentials of az.
+type CredentialStatus string
+
+const (
+	CredentialUnknown    CredentialStatus = "unknown"
+	CredentialValid      CredentialStatus = "valid"
+	CredentialRefreshing CredentialStatus = "refreshing"
+	CredentialExpired    CredentialStatus = "expired"
+	CredentialError      CredentialStatus = "error"
+)
+
+// Reasons for a credential refresh, recorded in logs and metrics.
+const (
+	RefreshExpiry    = "expiry"
+	RefreshTokenFile = "token_file"
+	RefreshAuthError = "auth_error"
+)
+
+// ErrAuthCircuitOpen is returned by Refresh while re-authentication is
+// suspended after repeated failures.
+var ErrAuthCircuitOpen = errors.New("re-authentication is suspended after repeated failures")
+
+// circuitOpenError wraps ErrAuthCircuitOpen with the time of the next
+// attempt.
+type circuitOpenError struct {
+	until time.Time
+}
+
+func (e *circuitOpenError) Error() string {
+	return fmt.Sprintf("%v until %s", ErrAuthCircuitOpen, e.until.Format(time.RFC3339))
+}
+
+func (e *circuitOpenError) Unwrap() error {
+	return ErrAuthCircuitOpen
+}
+
+// CredentialState is the state of the Azure credentials reported in /health.
+type CredentialState struct {
+	Status CredentialStatus `json:"status"`
+	// ExpiresOn is when the current access token expires.
+	ExpiresOn   time.Time `json:"expiresOn,omitzero"`
+	LastRefresh time.Time `json:"lastRefresh,omitzero"`
+	LastError   string    `json:"lastError,omitempty"`
+	// CircuitOpenUntil is set while re-authentication is suspended.
+	CircuitOpenUntil time.Time `json:"circuitOpenUntil,omitzero"`
+	// Cloud is the Azure cloud the credentials are for.
+	Cloud string `json:"cloud,omitempty"`
+}
+
+type CredentialConfig struct {
+	// Identity names the identity in metrics (default: DefaultIdentity).
+	Identity string
+	// AuthSetup logs in again. When nil, credentials are only monitored.
+	AuthSetup AuthSetup
+	// FederatedTokenFile is watched for rotation. A changed file triggers a
+	// refresh.
+	FederatedTokenFile string
+	// ConfigDir is the AZURE_CONFIG_DIR AuthSetup logs in to; "" is the
+	// default directory of az.
+	ConfigDir string
+	// Cloud is the Azure cloud az is logged in to, reported in State.
+	Cloud string
+	// RefreshBefore is how long before the access token expires it is
+	// refreshed (default 10 minutes).
+	RefreshBefore time.Duration
+	// CheckInterval is how often the expiry and the token file are checked
+	// (default 1 minute).
+	CheckInterval time.Duration
+	// Timeout bounds a refresh (default 30 seconds).
+	Timeout time.Duration
+	// Cooldown is how long after a successful refresh auth errors are
+	// retried without logging in again (default 30 seconds). They come from
+	// commands that started before the refresh.
+	Cooldown time.Duration
+	// MaxFailures failed refreshes within FailureWindow open the circuit
+	// breaker (defaults 3 and 5 minutes). While it is open, Refresh fails
+	// with ErrAuthCircuitOpen for BreakerTimeout (default 1 minute). Then
+	// one refresh is attempted again.
+	MaxFailures    int
+	FailureWindow  time.Duration
+	BreakerTimeout time.Duration
+}
+
+type refresh struct {
+	done chan struct{}
+	err  error
+}
+
+// CredentialManager refreshes the credentials of az before they expire and
+// when the federated token rotates. Concurrent refreshes share one run of
+// AuthSetup. A nil *CredentialManager never refreshes.
+type CredentialManager struct {
+	config CredentialConfig
+	// expiry returns when the current access token expires.
+	expiry func(ctx context.Context) (time.Time, error)
+
+	mu            sync.Mutex
+	inProgress    *refresh
+	expiresOn     time.Time
+	lastRefresh   time.Time
+	lastSuccess   time.Time
+	lastErr       error
+	tokenFileTime time.Time
+	failures      []time.Time
+	openUntil     time.Time
+}
+
+func NewCredentialManager(config CredentialConfig) *CredentialManager {
+	if config.Identity == "" {
+		config.Identity = DefaultIdentity
+	}
+	if config.RefreshBefore == 0 {
+		config.RefreshBefore = 10 * time.Minute
+	}
+	if config.CheckInterval == 0 {
+		config.CheckInterval = time.Minute
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 30 * time.Second
+	}
+	if config.Cooldown == 0 {
+		config.Cooldown = 30 * time.Second
+	}
+	if config.MaxFailures == 0 {
+		config.MaxFailures = 3
+	}
+	if config.FailureWindow == 0 {
+		config.FailureWindow = 5 * time.Minute
+	}
+	if config.BreakerTimeout == 0 {
+		config.BreakerTimeout = time.Minute
+	}
+	m := &CredentialManager{config: config}
+	m.expiry = func(ctx context.Context) (time.Time, error) {
+		return accessTokenExpiry(ctx, config.ConfigDir)
+	}
+	m.tokenFileTime, _ = m.tokenFileModTime()
+	return m
+}
+
+// Start checks the credentials every CheckInterval until ctx ends.
+func (m *CredentialManager) Start(ctx context.Context) {
+	if m == nil {
+		return
+	}
+	go func() {
+		m.check(ctx)
+		ticker := time.NewTicker(m.config.CheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				m.check(ctx)
+			}
+		}
+	}()
+}
+
+// check refreshes the credentials when the federated token file changed or
+// the access token is about to expire. When the expiry is not known yet, it
+// is looked up.
+func (m *CredentialManager) check(ctx context.Context) {
+	if m.tokenFileChanged() {
+		_ = m.Refresh(ctx, RefreshTokenFile)
+		return
+	}
+
+	m.mu.Lock()
+	expiresOn := m.expiresOn
+	m.mu.Unlock()
+	if expiresOn.IsZero() {
+		m.updateExpiry(ctx)
+		return
+	}
+	if time.Until(expiresOn) <= m.config.RefreshBefore {
+		_ = m.Refresh(ctx, RefreshExpiry)
+	}
+}
+
+// updateExpiry looks up the expiry of the current access token.
+func (m *CredentialManager) updateExpiry(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+	defer cancel()
+	expiresOn, err := m.expiry(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err != nil {
+		logger.Warnf("Could not determine when the Azure access token expires: %v", err)
+		m.lastErr = err
+		return
+	}
+	m.expiresOn, m.lastErr = expiresOn, nil
+	metrics.CredentialExpiry.Set(float64(expiresOn.Unix()), m.config.Identity)
+	logger.Infof("Azure access token is valid until %s", expiresOn.Format(time.RFC3339))
+}
+
+// CanRefresh reports whether Refresh logs in again.
+func (m *CredentialManager) CanRefresh() bool {
+	return m != nil && m.config.AuthSetup != nil
+}
+
+// Refresh runs AuthSetup and looks up the new expiry. Calls while a refresh
+// is in progress wait for it instead of starting another one. The refresh
+// itself is not cancelled with ctx.
+//
+// Auth errors within Cooldown of a successful refresh return right away, so
+// that the command is retried with the new credentials. While the circuit
+// breaker is open, Refresh fails with ErrAuthCircuitOpen.
+func (m *CredentialManager) Refresh(ctx context.Context, reason string) error {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.Lock()
+	r := m.inProgress
+	if r == nil {
+		if reason == RefreshAuthError && time.Since(m.lastSuccess) < m.config.Cooldown {
+			m.mu.Unlock()
+			logger.Debugf("Credentials were refreshed %v ago; retrying without logging in again", time.Since(m.lastSuccess).Round(time.Millisecond))
+			return nil
+		}
+		if until := m.openUntil; time.Now().Before(until) {
+			m.mu.Unlock()
+			metrics.CredentialRefreshes.Inc(reason, "circuit_open")
+			return &circuitOpenError{until: until}
+		}
+		r = &refresh{done: make(chan struct{})}
+		m.inProgress = r
+		go m.refresh(r, reason)
+	}
+	m.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return r.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *CredentialManager) refresh(r *refresh, reason string) {
+	ctx, cancel := context.WithTimeout(context.Background(), m.config.Timeout)
+	defer cancel()
+
+	logger.Infof("Refreshing Azure credentials (reason: %s)", reason)
+	var err error
+	if m.config.AuthSetup != nil {
+		err = m.config.AuthSetup.Setup(ctx)
+	}
+	var expiresOn time.Time
+	expiryErr := err
+	if err == nil {
+		expiresOn, expiryErr = m.expiry(ctx)
+	}
+
+	m.mu.Lock()
+	now := time.Now()
+	m.lastRefresh = now
+	m.lastErr = expiryErr
+	if expiryErr == nil {
+		m.expiresOn = expiresOn
+	}
+	opened := false
+	if err == nil {
+		m.lastSuccess = now
+		m.failures = nil
+		m.openUntil = time.Time{}
+	} else {
+		opened = m.recordFailure(now)
+	}
+	m.inProgress = nil
+	r.err = err
+	m.mu.Unlock()
+	close(r.done)
+
+	if opened {
+		logger.Errorf("Suspending re-authentication for %v after repeated failures", m.config.BreakerTimeout)
+	}
+
+	switch {
+	case err != nil:
+		metrics.CredentialRefreshes.Inc(reason, "failure")
+		logger.Errorf("Refreshing Azure credentials failed: %v", err)
+	case expiryErr != nil:
+		metrics.CredentialRefreshes.Inc(reason, "success")
+		logger.Warnf("Refreshed Azure credentials, but could not determine when they expire: %v", expiryErr)
+	default:
+		metrics.CredentialRefreshes.Inc(reason, "success")
+		metrics.CredentialExpiry.Set(float64(expiresOn.Unix()), m.config.Identity)
+		logger.Infof("Refreshed Azure credentials; the access token is valid until %s", expiresOn.Format(time.RFC3339))
+	}
+}
+
+// recordFailure counts a failed refresh and reports whether it opened the
+// circuit breaker. A failure right after the breaker timed out opens it
+// again. m.mu must be held.
+func (m *CredentialManager) recordFailure(now time.Time) bool {
+	recent := m.failures[:0]
+	for _, failure := range m.failures {
+		if now.Sub(failure) < m.config.FailureWindow {
+			recent = append(recent, failure)
+		}
+	}
+	m.failures = append(recent, now)
+
+	halfOpen := !m.openUntil.IsZero()
+	if len(m.failures) < m.config.MaxFailures && !halfOpen {
+		return false
+	}
+	m.openUntil = now.Add(m.config.BreakerTimeout)
+	return true
+}
+
+// Wait blocks while a refresh is in progress. It only fails when ctx ends
+// first.
+func (m *CredentialManager) Wait(ctx context.Context) error {
+	if m == nil {
+		return nil
+	}
+	m.mu.Lock()
+	r := m.inProgress
+	m.mu.Unlock()
+	if r == nil {
+		return nil
+	}
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// State returns the current state of the credentials.
+func (m *CredentialManager) State() CredentialState {
+	if m == nil {
+		return CredentialState{Status: CredentialUnknown}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	state := CredentialState{ExpiresOn: m.expiresOn, LastRefresh: m.lastRefresh, Cloud: m.config.Cloud}
+	if time.Now().Before(m.openUntil) {
+		state.CircuitOpenUntil = m.openUntil
+	}
+	if m.lastErr != nil {
+		state.LastError = m.lastErr.Error()
+	}
+	switch {
+	case m.inProgress != nil:
+		state.Status = CredentialRefreshing
+	case m.lastErr != nil:
+		state.Status = CredentialError
+	case m.expiresOn.IsZero():
+		state.Status = CredentialUnknown
+	case time.Now().After(m.expiresOn):
+		state.Status = CredentialExpired
+	default:
+		state.Status = CredentialValid
+	}
+	return state
+}
+
+// tokenFileChanged reports whether the federated token file was replaced
+// since the last call.
+func (m *CredentialManager) tokenFileChanged() bool {
+	modTime, err := m.tokenFileModTime()
+	if err != nil {
+		return false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if modTime.Equal(m.tokenFileTime) {
+		return false
+	}
+	m.tokenFileTime = modTime
+	return true
+}
+
+func (m *CredentialManager) tokenFileModTime() (time.Time, error) {
+	if m.config.FederatedTokenFile == "" {
+		return time.Time{}, fmt.Errorf("no federated token file")
+	}
+	info, err := os.Stat(m.config.FederatedTokenFile)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return info.ModTime(), nil
+}
+
+// accessTokenExpiry asks az when its current access token expires.
+func accessTokenExpiry(ctx context.Context, configDir string) (time.Time, error) {
+	cmd := azCommand(ctx, configDir, "account", "get-access-token", "--output", "json")
+	output, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get access token: %w", err)
+	}
+	return parseTokenExpiry(output)
+}
+
+// parseTokenExpiry reads the expiry from the output of az account
+// get-access-token. Recent versions report expires_on as a Unix timestamp;
+// older ones only report expiresOn in local time.
+func parseTokenExpiry(output []byte) (time.Time, error) {
+	var token struct {
+		ExpiresOnUnix int64  `json:"expires_on"`
+		ExpiresOn     string `json:"expiresOn"`
+	}
+	if err := json.Unmarshal(output, &token); err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse access token: %w", err)
+	}
+	if token.ExpiresOnUnix > 0 {
+		return time.Unix(token.ExpiresOnUnix, 0), nil
+	}
+	if token.ExpiresOn != "" {
+		expiresOn, err := time.ParseInLocation("2006-01-02 15:04:05.999999", token.ExpiresOn, time.Local)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse token expiry: %w", err)
+		}
+		return expiresOn, nil
+	}
+	return time.Time{}, fmt.Errorf("access token has no expiry")
+}
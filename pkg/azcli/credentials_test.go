@@ -0,0 +1,365 @@
+package azcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+// blockingAuthSetup counts Setup calls and blocks them until release is
+// closed.
+type blockingAuthSetup struct {
+	calls   atomic.Int32
+	started chan struct{}
+	release chan struct{}
+}
+
+func newBlockingAuthSetup() *blockingAuthSetup {
+	return &blockingAuthSetup{started: make(chan struct{}, 16), release: make(chan struct{})}
+}
+
+func (s *blockingAuthSetup) Setup(ctx context.Context) error {
+	s.calls.Add(1)
+	s.started <- struct{}{}
+	select {
+	case <-s.release:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newTestCredentialManager(setup AuthSetup, expiresIn time.Duration) *CredentialManager {
+	m := NewCredentialManager(CredentialConfig{AuthSetup: setup})
+	m.expiry = func(context.Context) (time.Time, error) {
+		return time.Now().Add(expiresIn), nil
+	}
+	return m
+}
+
+func TestCredentialManager_RefreshIsSingleFlight(t *testing.T) {
+	setup := newBlockingAuthSetup()
+	m := newTestCredentialManager(setup, time.Hour)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- m.Refresh(context.Background(), RefreshAuthError)
+		}()
+	}
+	<-setup.started
+	if state := m.State(); state.Status != CredentialRefreshing {
+		t.Errorf("status during refresh = %s, want refreshing", state.Status)
+	}
+
+	waited := make(chan error)
+	go func() { waited <- m.Wait(context.Background()) }()
+	select {
+	case <-waited:
+		t.Fatal("Wait() returned while the refresh was in progress")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(setup.release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Refresh() error = %v", err)
+		}
+	}
+	if err := <-waited; err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+	if got := setup.calls.Load(); got != 1 {
+		t.Errorf("Setup() called %d times, want 1", got)
+	}
+	if state := m.State(); state.Status != CredentialValid || state.LastRefresh.IsZero() {
+		t.Errorf("state after refresh = %+v", state)
+	}
+}
+
+func TestCredentialManager_RefreshesBeforeExpiry(t *testing.T) {
+	setup := &mockAuthSetup{}
+	m := newTestCredentialManager(setup, 5*time.Minute)
+
+	// The first check only looks up the expiry.
+	m.check(context.Background())
+	if setup.callCount != 0 {
+		t.Fatalf("Setup() called %d times on the first check", setup.callCount)
+	}
+
+	// The token expires within RefreshBefore, so it is refreshed.
+	m.expiry = func(context.Context) (time.Time, error) { return time.Now().Add(time.Hour), nil }
+	m.check(context.Background())
+	if setup.callCount != 1 {
+		t.Fatalf("Setup() called %d times, want 1", setup.callCount)
+	}
+
+	m.check(context.Background())
+	if setup.callCount != 1 {
+		t.Errorf("Setup() called %d times for a fresh token, want 1", setup.callCount)
+	}
+	if state := m.State(); state.Status != CredentialValid || time.Until(state.ExpiresOn) < 50*time.Minute {
+		t.Errorf("state = %+v", state)
+	}
+}
+
+func TestCredentialManager_RefreshesOnTokenFileRotation(t *testing.T) {
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token-1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	setup := &mockAuthSetup{}
+	m := NewCredentialManager(CredentialConfig{AuthSetup: setup, FederatedTokenFile: tokenFile})
+	m.expiry = func(context.Context) (time.Time, error) { return time.Now().Add(time.Hour), nil }
+
+	m.check(context.Background())
+	if setup.callCount != 0 {
+		t.Fatalf("Setup() called %d times before the token rotated", setup.callCount)
+	}
+
+	if err := os.WriteFile(tokenFile, []byte("token-2"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tokenFile, future, future); err != nil {
+		t.Fatal(err)
+	}
+	m.check(context.Background())
+	m.check(context.Background())
+	if setup.callCount != 1 {
+		t.Errorf("Setup() called %d times after the token rotated, want 1", setup.callCount)
+	}
+}
+
+func TestCredentialManager_CooldownAfterRefresh(t *testing.T) {
+	setup := &mockAuthSetup{}
+	m := newTestCredentialManager(setup, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if err := m.Refresh(context.Background(), RefreshAuthError); err != nil {
+			t.Fatalf("Refresh() error = %v", err)
+		}
+	}
+	if setup.callCount != 1 {
+		t.Errorf("Setup() called %d times within the cooldown, want 1", setup.callCount)
+	}
+
+	// Token rotation is not an auth error and always logs in again.
+	if err := m.Refresh(context.Background(), RefreshTokenFile); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if setup.callCount != 2 {
+		t.Errorf("Setup() called %d times after the token rotated, want 2", setup.callCount)
+	}
+}
+
+func TestCredentialManager_CircuitBreaker(t *testing.T) {
+	failing := true
+	setup := &mockAuthSetup{setupFunc: func(context.Context) error {
+		if failing {
+			return errors.New("login failed")
+		}
+		return nil
+	}}
+	m := NewCredentialManager(CredentialConfig{AuthSetup: setup, MaxFailures: 2, BreakerTimeout: 50 * time.Millisecond})
+	m.expiry = func(context.Context) (time.Time, error) { return time.Now().Add(time.Hour), nil }
+
+	for i := 0; i < 2; i++ {
+		if err := m.Refresh(context.Background(), RefreshAuthError); err == nil || errors.Is(err, ErrAuthCircuitOpen) {
+			t.Fatalf("Refresh() #%d error = %v, want the login error", i+1, err)
+		}
+	}
+	if err := m.Refresh(context.Background(), RefreshAuthError); !errors.Is(err, ErrAuthCircuitOpen) {
+		t.Fatalf("Refresh() with the breaker open: error = %v, want ErrAuthCircuitOpen", err)
+	}
+	if setup.callCount != 2 {
+		t.Errorf("Setup() called %d times, want 2", setup.callCount)
+	}
+	if state := m.State(); state.CircuitOpenUntil.IsZero() {
+		t.Errorf("state = %+v, want circuitOpenUntil", state)
+	}
+
+	// After the timeout one attempt is made; a failure opens the breaker again.
+	time.Sleep(60 * time.Millisecond)
+	if err := m.Refresh(context.Background(), RefreshAuthError); err == nil || errors.Is(err, ErrAuthCircuitOpen) {
+		t.Fatalf("Refresh() after the timeout: error = %v, want the login error", err)
+	}
+	if err := m.Refresh(context.Background(), RefreshAuthError); !errors.Is(err, ErrAuthCircuitOpen) {
+		t.Fatalf("Refresh() after a failed attempt: error = %v, want ErrAuthCircuitOpen", err)
+	}
+
+	// A successful attempt closes the breaker.
+	time.Sleep(60 * time.Millisecond)
+	failing = false
+	if err := m.Refresh(context.Background(), RefreshAuthError); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if state := m.State(); !state.CircuitOpenUntil.IsZero() || state.Status != CredentialValid {
+		t.Errorf("state = %+v, want a valid closed state", state)
+	}
+}
+
+func TestCredentialManager_State(t *testing.T) {
+	var nilManager *CredentialManager
+	if nilManager.State().Status != CredentialUnknown || nilManager.CanRefresh() {
+		t.Error("a nil manager should report unknown credentials and not refresh")
+	}
+
+	m := newTestCredentialManager(nil, -time.Minute)
+	m.check(context.Background())
+	if status := m.State().Status; status != CredentialExpired {
+		t.Errorf("status = %s, want expired", status)
+	}
+
+	m.expiry = func(context.Context) (time.Time, error) { return time.Time{}, context.DeadlineExceeded }
+	if err := m.Refresh(context.Background(), RefreshExpiry); err != nil {
+		t.Errorf("Refresh() without AuthSetup error = %v", err)
+	}
+	if state := m.State(); state.Status != CredentialError || state.LastError == "" {
+		t.Errorf("state = %+v, want error", state)
+	}
+
+	data, err := json.Marshal(CredentialState{Status: CredentialUnknown})
+	if err != nil || string(data) != `{"status":"unknown"}` {
+		t.Errorf("json = %s, %v", data, err)
+	}
+}
+
+func TestParseTokenExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		want    time.Time
+		wantErr bool
+	}{
+		{name: "unix", output: `{"accessToken":"secret","expires_on":1700000000,"expiresOn":"2023-11-14 22:13:20.000000"}`, want: time.Unix(1700000000, 0)},
+		{name: "local time", output: `{"accessToken":"secret","expiresOn":"2023-11-14 22:13:20.000000"}`, want: time.Date(2023, 11, 14, 22, 13, 20, 0, time.Local)},
+		{name: "no expiry", output: `{"accessToken":"secret"}`, wantErr: true},
+		{name: "invalid", output: `not json`, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseTokenExpiry([]byte(tt.output))
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: error = nil", tt.name)
+			}
+			continue
+		}
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("%s: parseTokenExpiry() = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestClient_ExecuteCommand_ConcurrentAuthErrorsShareRefresh(t *testing.T) {
+	setup := newBlockingAuthSetup()
+	credentials := newTestCredentialManager(setup, time.Hour)
+
+	// All three commands fail with an auth error before any of them
+	// re-authenticates.
+	var refreshed atomic.Bool
+	arrived := make(chan struct{})
+	mockExec := &concurrentExecutor{}
+	mockExec.execute = func() (*Result, error) {
+		if refreshed.Load() {
+			return &Result{Output: json.RawMessage(`[]`)}, nil
+		}
+		if mockExec.calls.Load() == 3 {
+			close(arrived)
+		}
+		<-arrived
+		return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", "")
+	}
+	client := &DefaultClient{validator: &mockValidator{}, executor: mockExec, credentials: credentials}
+
+	var wg sync.WaitGroup
+	for _, command := range []string{"az vm create --name a", "az vm create --name b", "az vm create --name c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.ExecuteCommand(context.Background(), command); err != nil {
+				t.Errorf("ExecuteCommand(%q) error = %v", command, err)
+			}
+		}()
+	}
+
+	<-setup.started
+	// Give the other commands time to join the refresh.
+	time.Sleep(50 * time.Millisecond)
+	refreshed.Store(true)
+	close(setup.release)
+	wg.Wait()
+
+	if got := setup.calls.Load(); got != 1 {
+		t.Errorf("Setup() called %d times, want 1", got)
+	}
+}
+
+func TestClient_ExecuteCommand_AuthCircuitOpen(t *testing.T) {
+	setup := &mockAuthSetup{setupFunc: func(context.Context) error { return errors.New("login failed") }}
+	credentials := NewCredentialManager(CredentialConfig{AuthSetup: setup, MaxFailures: 1})
+	mockExec := &mockExecutor{
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			return nil, NewAzCliError(ErrorTypeAuth, "authentication expired", cmd.Raw())
+		},
+	}
+	client := &DefaultClient{validator: &mockValidator{}, executor: mockExec, credentials: credentials}
+
+	_, err := client.ExecuteCommand(context.Background(), "az vm list")
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeAuth {
+		t.Fatalf("first ExecuteCommand() error = %v, want auth_failed", err)
+	}
+
+	_, err = client.ExecuteCommand(context.Background(), "az vm list")
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeAuthCircuitOpen {
+		t.Fatalf("ExecuteCommand() with the breaker open: error = %v, want auth_circuit_open", err)
+	}
+	if retryAfter, ok := azErr.Context["retry_after"].(int); !ok || retryAfter < 1 {
+		t.Errorf("retry_after = %v", azErr.Context["retry_after"])
+	}
+	if setup.callCount != 1 {
+		t.Errorf("Setup() called %d times, want 1", setup.callCount)
+	}
+}
+
+// concurrentExecutor is an Executor that is safe for concurrent use.
+type concurrentExecutor struct {
+	calls   atomic.Int32
+	execute func() (*Result, error)
+}
+
+func (e *concurrentExecutor) Execute(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+	e.calls.Add(1)
+	return e.execute()
+}
+
+func TestCredentialManager_ExpiryMetricPerIdentity(t *testing.T) {
+	reader := NewCredentialManager(CredentialConfig{Identity: "metrics-reader"})
+	reader.expiry = func(context.Context) (time.Time, error) { return time.Unix(1000, 0), nil }
+	deployer := NewCredentialManager(CredentialConfig{Identity: "metrics-deployer"})
+	deployer.expiry = func(context.Context) (time.Time, error) { return time.Unix(2000, 0), nil }
+
+	reader.updateExpiry(context.Background())
+	deployer.updateExpiry(context.Background())
+
+	if got := metrics.CredentialExpiry.Value("metrics-reader"); got != 1000 {
+		t.Errorf("expiry of metrics-reader = %v, want 1000", got)
+	}
+	if got := metrics.CredentialExpiry.Value("metrics-deployer"); got != 2000 {
+		t.Errorf("expiry of metrics-deployer = %v, want 2000", got)
+	}
+}
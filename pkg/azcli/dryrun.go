@@ -0,0 +1,241 @@
+package azcli
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+)
+
+// CommandClass is the read/write classification of a command.
+type CommandClass string
+
+const (
+	CommandClassRead  CommandClass = "read"
+	CommandClassWrite CommandClass = "write"
+)
+
+// Validation layers reported by a dry run, in the order they are applied.
+const (
+	LayerBasicSecurity  = "basic-security"
+	LayerSecurityPolicy = "security-policy"
+	LayerReadOnly       = "read-only"
+	// LayerIdentity checks that the policy allows the selected identity.
+	LayerIdentity = "identity"
+)
+
+// CheckStatus is the outcome of a single validation layer in a dry run.
+type CheckStatus string
+
+const (
+	CheckStatusPassed  CheckStatus = "passed"
+	CheckStatusFailed  CheckStatus = "failed"
+	CheckStatusSkipped CheckStatus = "skipped"
+)
+
+// DryRunReport describes how a command would be handled without executing
+// it. Unlike Validate, every layer is evaluated even after one has failed, so
+// the report lists all reasons a command would be rejected.
+type DryRunReport struct {
+	Command          string              `json:"command"`
+	CommandPath      []string            `json:"commandPath"`
+	Flags            map[string][]string `json:"flags,omitempty"`
+	Positionals      []string            `json:"positionals,omitempty"`
+	Classification   CommandClass        `json:"classification"`
+	Policy           string              `json:"policy,omitempty"`
+	Identity         string              `json:"identity,omitempty"`
+	Checks           []DryRunCheck       `json:"checks"`
+	RulesEvaluated   []RuleEvaluation    `json:"rulesEvaluated,omitempty"`
+	MatchedRule      string              `json:"matchedRule,omitempty"`
+	Allowed          bool                `json:"allowed"`
+	RequiresApproval bool                `json:"requiresApproval"`
+	Reasons          []string            `json:"reasons,omitempty"`
+	WhatIf           *WhatIfReport       `json:"whatIf,omitempty"`
+}
+
+// DryRunCheck is the result of one validation layer.
+type DryRunCheck struct {
+	Layer   string      `json:"layer"`
+	Status  CheckStatus `json:"status"`
+	Message string      `json:"message,omitempty"`
+}
+
+// WhatIfReport describes the native preview variant of a command (for
+// example "az deployment group what-if" for "az deployment group create").
+// Output and ExitCode are only set when the preview was executed.
+type WhatIfReport struct {
+	Command  string `json:"command"`
+	Executed bool   `json:"executed"`
+	Reason   string `json:"reason,omitempty"`
+	ExitCode *int   `json:"exitCode,omitempty"`
+	// DurationMs is how long the preview ran.
+	DurationMs int64           `json:"durationMs,omitempty"`
+	Output     json.RawMessage `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// Explain runs every validation layer against cmd and reports the outcome of
+// each one.
+func (v *DefaultValidator) Explain(cmd *ParsedCommand) *DryRunReport {
+	report := newDryRunReport(cmd)
+	report.Classification = CommandClassWrite
+	if v.isReadOnly(cmd) {
+		report.Classification = CommandClassRead
+	}
+
+	if err := cmd.verify(); err != nil {
+		report.addCheck(LayerBasicSecurity, NewAzCliError(ErrorTypeInvalidCommand, err.Error(), ""))
+		return report
+	}
+	report.addCheck(LayerBasicSecurity, v.validateBasicSecurity(cmd))
+
+	if v.enableSecurityPolicy && v.policy != nil {
+		evaluations, decision := v.policy.trace(cmd)
+		report.RulesEvaluated = evaluations
+		report.MatchedRule = decision.RuleName()
+		report.RequiresApproval = decision.RequiresApproval()
+		report.addCheck(LayerSecurityPolicy, policyError(cmd, decision))
+	} else {
+		report.skipCheck(LayerSecurityPolicy, "security policy is not enabled")
+	}
+
+	if v.readOnlyMode {
+		report.addCheck(LayerReadOnly, v.checkReadOnly(cmd))
+	} else {
+		report.skipCheck(LayerReadOnly, "read-only mode is not enabled")
+	}
+
+	return report
+}
+
+func newDryRunReport(cmd *ParsedCommand) *DryRunReport {
+	return &DryRunReport{
+		Command:     cmd.Raw(),
+		CommandPath: cmd.CommandPath(),
+		Flags:       cmd.Flags(),
+		Positionals: cmd.Positionals(),
+		Allowed:     true,
+	}
+}
+
+func (r *DryRunReport) addCheck(layer string, err error) {
+	if err == nil {
+		r.Checks = append(r.Checks, DryRunCheck{Layer: layer, Status: CheckStatusPassed})
+		return
+	}
+
+	message := err.Error()
+	var azErr *AzCliError
+	if errors.As(err, &azErr) {
+		message = azErr.Message
+	}
+	r.Checks = append(r.Checks, DryRunCheck{Layer: layer, Status: CheckStatusFailed, Message: message})
+	r.Allowed = false
+	r.RequiresApproval = false
+	r.Reasons = append(r.Reasons, message)
+}
+
+func (r *DryRunReport) skipCheck(layer string, message string) {
+	r.Checks = append(r.Checks, DryRunCheck{Layer: layer, Status: CheckStatusSkipped, Message: message})
+}
+
+// whatIfDropFlags are flags of "az deployment ... create" that the what-if
+// variant does not accept.
+var whatIfDropFlags = map[string]bool{
+	"--no-wait":                      true,
+	"--confirm-with-what-if":         true,
+	"-c":                             true,
+	"--what-if":                      true,
+	"--what-if-result-format":        true,
+	"-r":                             true,
+	"--what-if-exclude-change-types": true,
+	"-x":                             true,
+	"--proceed-if-no-change":         true,
+	"--rollback-on-error":            true,
+}
+
+// dryrunBatchCommands are storage batch operations that accept "--dryrun".
+var dryrunBatchCommands = map[string]bool{
+	"delete-batch":   true,
+	"upload-batch":   true,
+	"download-batch": true,
+}
+
+// whatIfCommand returns the native preview variant of cmd, or nil when the
+// command has none:
+//
+//   - az deployment {group|sub|mg|tenant} create -> az deployment ... what-if --no-pretty-print
+//   - az webapp up                               -> az webapp up --dryrun
+//   - az storage {blob|file} *-batch             -> ... --dryrun
+func whatIfCommand(cmd *ParsedCommand) (*ParsedCommand, error) {
+	path := cmd.commandPath
+
+	switch {
+	case len(path) == 3 && path[0] == "deployment" && path[2] == "create" &&
+		slices.Contains([]string{"group", "sub", "mg", "tenant"}, path[1]):
+		args := replaceCommandPath(cmd, []string{"deployment", path[1], "what-if"})
+		args = dropFlags(args, whatIfDropFlags)
+		return parsedFromArgs(append(args, "--no-pretty-print"))
+
+	case slices.Equal(path, []string{"webapp", "up"}),
+		len(path) == 3 && path[0] == "storage" && (path[1] == "blob" || path[1] == "file") && dryrunBatchCommands[path[2]]:
+		if cmd.HasFlag("--dryrun") {
+			return nil, nil
+		}
+		return parsedFromArgs(append(cmd.Args(), "--dryrun"))
+	}
+
+	return nil, nil
+}
+
+// replaceCommandPath returns the arguments of cmd with its command path
+// replaced by path. Flags given before the command path are kept in place.
+func replaceCommandPath(cmd *ParsedCommand, path []string) []string {
+	args := []string{"az"}
+	matched := 0
+	for _, arg := range cmd.args[1:] {
+		if matched < len(cmd.commandPath) && strings.EqualFold(arg, cmd.commandPath[matched]) {
+			matched++
+			if matched == len(cmd.commandPath) {
+				args = append(args, path...)
+			}
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// dropFlags removes the given flags and their values from args.
+func dropFlags(args []string, drop map[string]bool) []string {
+	kept := []string{}
+	dropping := false
+	for _, arg := range args {
+		if isFlagToken(arg) {
+			name, _, _ := splitFlagToken(arg)
+			dropping = drop[name]
+		}
+		if !dropping {
+			kept = append(kept, arg)
+		}
+	}
+	return kept
+}
+
+// parsedFromArgs builds a ParsedCommand from an argument vector by quoting
+// each argument so that tokenizing the joined string yields args again.
+func parsedFromArgs(args []string) (*ParsedCommand, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = quoteArg(arg)
+	}
+	return ParseCommand(strings.Join(quoted, " "))
+}
+
+func quoteArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, ` "'\`) {
+		return arg
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(arg) + `"`
+}
@@ -0,0 +1,241 @@
+package azcli
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func newTestDryRunValidator(t *testing.T, readOnlyMode bool) *DefaultValidator {
+	t.Helper()
+	patterns, err := LoadReadOnlyPatterns("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &DefaultValidator{
+		readOnlyMode:         readOnlyMode,
+		enableSecurityPolicy: true,
+		readOnlyPatterns:     patterns,
+		policy: &SecurityPolicy{
+			Policy: PolicyRules{
+				Rules: []PolicyRule{
+					{Name: "deny-vm-delete", Action: PolicyActionDeny, Command: "vm delete"},
+					{Name: "approve-group-create", Action: PolicyActionRequireApproval, Command: "group create"},
+					{Name: "allow-rest", Action: PolicyActionAllow, Command: "**"},
+				},
+			},
+		},
+	}
+}
+
+func TestValidator_Explain(t *testing.T) {
+	tests := []struct {
+		name             string
+		readOnlyMode     bool
+		input            string
+		allowed          bool
+		requiresApproval bool
+		classification   CommandClass
+		matchedRule      string
+		rulesEvaluated   int
+		checks           []CheckStatus
+	}{
+		{
+			name:           "allowed read",
+			input:          "az vm list --resource-group rg",
+			allowed:        true,
+			classification: CommandClassRead,
+			matchedRule:    "allow-rest",
+			rulesEvaluated: 3,
+			checks:         []CheckStatus{CheckStatusPassed, CheckStatusPassed, CheckStatusSkipped},
+		},
+		{
+			name:           "denied by policy",
+			input:          "az vm delete --name vm1 --resource-group rg",
+			allowed:        false,
+			classification: CommandClassWrite,
+			matchedRule:    "deny-vm-delete",
+			rulesEvaluated: 1,
+			checks:         []CheckStatus{CheckStatusPassed, CheckStatusFailed, CheckStatusSkipped},
+		},
+		{
+			name:             "requires approval",
+			input:            "az group create --name rg --location eastus",
+			allowed:          true,
+			requiresApproval: true,
+			classification:   CommandClassWrite,
+			matchedRule:      "approve-group-create",
+			rulesEvaluated:   2,
+			checks:           []CheckStatus{CheckStatusPassed, CheckStatusPassed, CheckStatusSkipped},
+		},
+		{
+			name:           "every failing layer is reported",
+			readOnlyMode:   true,
+			input:          "az vm delete --name vm1 --resource-group ../rg",
+			allowed:        false,
+			classification: CommandClassWrite,
+			matchedRule:    "deny-vm-delete",
+			rulesEvaluated: 1,
+			checks:         []CheckStatus{CheckStatusFailed, CheckStatusFailed, CheckStatusFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := newTestDryRunValidator(t, tt.readOnlyMode)
+			cmd, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			report := validator.Explain(cmd)
+			if report.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v (reasons: %v)", report.Allowed, tt.allowed, report.Reasons)
+			}
+			if report.RequiresApproval != tt.requiresApproval {
+				t.Errorf("RequiresApproval = %v, want %v", report.RequiresApproval, tt.requiresApproval)
+			}
+			if report.Classification != tt.classification {
+				t.Errorf("Classification = %v, want %v", report.Classification, tt.classification)
+			}
+			if report.MatchedRule != tt.matchedRule {
+				t.Errorf("MatchedRule = %q, want %q", report.MatchedRule, tt.matchedRule)
+			}
+			if len(report.RulesEvaluated) != tt.rulesEvaluated {
+				t.Errorf("RulesEvaluated = %v, want %d entries", report.RulesEvaluated, tt.rulesEvaluated)
+			}
+
+			var statuses []CheckStatus
+			for _, check := range report.Checks {
+				statuses = append(statuses, check.Status)
+			}
+			if !reflect.DeepEqual(statuses, tt.checks) {
+				t.Errorf("check statuses = %v, want %v", statuses, tt.checks)
+			}
+		})
+	}
+}
+
+func TestWhatIfCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []string
+	}{
+		{
+			name:  "deployment group create",
+			input: "az deployment group create -g rg --template-file main.bicep --no-wait --parameters name='my app'",
+			want:  []string{"az", "deployment", "group", "what-if", "-g", "rg", "--template-file", "main.bicep", "--parameters", "name=my app", "--no-pretty-print"},
+		},
+		{
+			name:  "deployment sub create drops what-if flags",
+			input: "az deployment sub create --location eastus --template-file main.bicep --what-if-result-format ResourceIdOnly -c",
+			want:  []string{"az", "deployment", "sub", "what-if", "--location", "eastus", "--template-file", "main.bicep", "--no-pretty-print"},
+		},
+		{
+			name:  "webapp up",
+			input: "az webapp up --name app --runtime PYTHON:3.11",
+			want:  []string{"az", "webapp", "up", "--name", "app", "--runtime", "PYTHON:3.11", "--dryrun"},
+		},
+		{
+			name:  "storage blob delete-batch",
+			input: "az storage blob delete-batch --source c1 --account-name sa",
+			want:  []string{"az", "storage", "blob", "delete-batch", "--source", "c1", "--account-name", "sa", "--dryrun"},
+		},
+		{
+			name:  "already a dry run",
+			input: "az storage blob upload-batch --destination c1 --source . --dryrun",
+		},
+		{
+			name:  "no preview variant",
+			input: "az vm delete --name vm1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			preview, err := whatIfCommand(cmd)
+			if err != nil {
+				t.Fatalf("whatIfCommand() error = %v", err)
+			}
+			if tt.want == nil {
+				if preview != nil {
+					t.Errorf("whatIfCommand() = %v, want none", preview.Args())
+				}
+				return
+			}
+			if preview == nil {
+				t.Fatal("whatIfCommand() returned no preview")
+			}
+			if !reflect.DeepEqual(preview.Args(), tt.want) {
+				t.Errorf("whatIfCommand() = %q, want %q", preview.Args(), tt.want)
+			}
+			if err := preview.verify(); err != nil {
+				t.Errorf("preview does not verify: %v", err)
+			}
+		})
+	}
+}
+
+func TestClient_DryRunCommand(t *testing.T) {
+	var executed [][]string
+	mockExec := &mockExecutor{
+		executeFunc: func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+			executed = append(executed, cmd.Args())
+			return &Result{Output: json.RawMessage(`{"changes":[]}`)}, nil
+		},
+	}
+	client := &DefaultClient{
+		validator: newTestDryRunValidator(t, false),
+		executor:  mockExec,
+	}
+
+	report, err := client.DryRunCommand(context.Background(), "az group create --name rg --location eastus", true)
+	if err != nil {
+		t.Fatalf("DryRunCommand() error = %v", err)
+	}
+	if !report.RequiresApproval || report.WhatIf != nil {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if len(executed) != 0 {
+		t.Errorf("dry run executed commands: %v", executed)
+	}
+
+	cmdStr := "az deployment group create -g rg --template-file main.bicep"
+	report, err = client.DryRunCommand(context.Background(), cmdStr, false)
+	if err != nil {
+		t.Fatalf("DryRunCommand() error = %v", err)
+	}
+	if report.WhatIf == nil || report.WhatIf.Executed {
+		t.Errorf("what-if should be reported but not executed: %+v", report.WhatIf)
+	}
+	if len(executed) != 0 {
+		t.Errorf("dry run executed commands: %v", executed)
+	}
+
+	report, err = client.DryRunCommand(context.Background(), cmdStr, true)
+	if err != nil {
+		t.Fatalf("DryRunCommand() error = %v", err)
+	}
+	if report.WhatIf == nil || !report.WhatIf.Executed {
+		t.Fatalf("what-if should be executed: %+v", report.WhatIf)
+	}
+	if string(report.WhatIf.Output) != `{"changes":[]}` {
+		t.Errorf("what-if output = %s", report.WhatIf.Output)
+	}
+	if len(executed) != 1 || executed[0][3] != "what-if" {
+		t.Errorf("expected only the what-if command to run, got %v", executed)
+	}
+}
+
+func TestClient_DryRunCommand_ParseError(t *testing.T) {
+	client := &DefaultClient{validator: &mockValidator{}, executor: &mockExecutor{}}
+	if _, err := client.DryRunCommand(context.Background(), `az vm list --name "unclosed`, false); err == nil {
+		t.Error("DryRunCommand() should fail for unparsable commands")
+	}
+}
@@ -35,7 +35,7 @@ func TestLoadSecurityPolicyWithEmptyPath(t *testing.T) {
 	if policy == nil {
 		t.Fatal("LoadSecurityPolicy(\"\") should return default policy")
 	}
-	if len(policy.Policy.DenyList) == 0 {
+	if len(policy.Policy.Rules) == 0 {
 		t.Error("Default policy should not be empty")
 	}
 }
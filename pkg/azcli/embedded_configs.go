@@ -18,12 +18,30 @@ var DefaultReadOnlyPatterns = `patterns:
 
 var DefaultSecurityPolicy = `version: "1.0"
 policy:
-  denyList:
-    - "az account clear"
-    - "az login"
-    - "az logout"
-    - "az ad user delete"
-    - "az vm delete"
-    - "az group delete"
-    - "az storage blob delete"
+  defaultAction: allow
+  # Like the earlier denyList, each rule also denies sibling commands that
+  # start with the same name (e.g. storage blob delete-batch) and their
+  # subcommands.
+  rules:
+    - name: deny-account-clear
+      action: deny
+      command: "account clear* **"
+    - name: deny-login
+      action: deny
+      command: "login* **"
+    - name: deny-logout
+      action: deny
+      command: "logout* **"
+    - name: deny-ad-user-delete
+      action: deny
+      command: "ad user delete* **"
+    - name: deny-vm-delete
+      action: deny
+      command: "vm delete* **"
+    - name: deny-group-delete
+      action: deny
+      command: "group delete* **"
+    - name: deny-storage-blob-delete
+      action: deny
+      command: "storage blob delete* **"
 `
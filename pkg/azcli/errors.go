@@ -1,6 +1,7 @@
 package azcli
 
 import (
+	"errors"
 	"fmt"
 )
 
@@ -13,6 +14,52 @@ const (
 	ErrorTypeTimeout        ErrorType = "timeout"
 	ErrorTypeParseOutput    ErrorType = "parse_output"
 	ErrorTypeAuth           ErrorType = "auth_failed"
+	// ErrorTypeAuthCircuitOpen is returned for auth errors while
+	// re-authentication is suspended after repeated failures. The context
+	// holds retry_after in seconds.
+	ErrorTypeAuthCircuitOpen ErrorType = "auth_circuit_open"
+	// ErrorTypeQueueFull is returned when no execution slot became available,
+	// either because the wait queue is full or because the wait timed out.
+	ErrorTypeQueueFull ErrorType = "queue_full"
+	// ErrorTypeQuery is returned when a server-side jmespath expression or
+	// fields projection cannot be applied to the output.
+	ErrorTypeQuery ErrorType = "query_error"
+	// ErrorTypeApprovalDenied is reported when a command that requires
+	// approval was rejected or could not be approved.
+	ErrorTypeApprovalDenied ErrorType = "approval_denied"
+	// ErrorTypeRateLimited is returned when a command exceeds a rate limit of
+	// the server. The context holds retry_after in seconds.
+	ErrorTypeRateLimited ErrorType = "rate_limited"
+	// ErrorTypeShuttingDown is returned for calls rejected or cancelled
+	// because the server is shutting down.
+	ErrorTypeShuttingDown ErrorType = "shutting_down"
+	// ErrorTypeResourceNotFound is returned when the target resource, resource
+	// group or other object does not exist.
+	ErrorTypeResourceNotFound ErrorType = "resource_not_found"
+	// ErrorTypeAuthorizationFailed is returned when the identity lacks the RBAC
+	// permission for the operation. Retrying will not help.
+	ErrorTypeAuthorizationFailed ErrorType = "authorization_failed"
+	// ErrorTypeThrottled is returned when Azure rejected the request with 429
+	// Too Many Requests.
+	ErrorTypeThrottled ErrorType = "throttled"
+	// ErrorTypeQuotaExceeded is returned when the operation would exceed a
+	// subscription or regional quota.
+	ErrorTypeQuotaExceeded ErrorType = "quota_exceeded"
+	// ErrorTypeConflict is returned when the resource is in a state that
+	// conflicts with the operation, such as another operation in progress.
+	ErrorTypeConflict ErrorType = "conflict"
+	// ErrorTypeInvalidArgument is returned when az or Azure rejected an
+	// argument or parameter value.
+	ErrorTypeInvalidArgument ErrorType = "invalid_argument"
+	// ErrorTypeExtensionNotInstalled is returned when the command needs an az
+	// extension that is not installed.
+	ErrorTypeExtensionNotInstalled ErrorType = "extension_not_installed"
+	// ErrorTypeSubscriptionNotFound is returned when the subscription does not
+	// exist or is not accessible to the logged-in identity.
+	ErrorTypeSubscriptionNotFound ErrorType = "subscription_not_found"
+	// ErrorTypeTransient is returned for server-side (5xx) and network
+	// failures that may succeed when retried.
+	ErrorTypeTransient ErrorType = "transient"
 )
 
 type AzCliError struct {
@@ -42,3 +89,17 @@ func (e *AzCliError) WithContext(key string, value any) *AzCliError {
 	e.Context[key] = value
 	return e
 }
+
+// NewToolError converts err into its structured form. Errors that are not
+// an *AzCliError are reported with defaultType.
+func NewToolError(err error, defaultType ErrorType) *ToolError {
+	var azErr *AzCliError
+	if errors.As(err, &azErr) {
+		toolErr := &ToolError{Type: azErr.Type, Message: azErr.Message}
+		if len(azErr.Context) > 0 {
+			toolErr.Context = azErr.Context
+		}
+		return toolErr
+	}
+	return &ToolError{Type: defaultType, Message: err.Error()}
+}
@@ -4,20 +4,27 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
+	"os"
 	"os/exec"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
 )
 
+// waitDelay is how long a killed command may keep its output open, e.g.
+// through child processes, before Execute stops waiting for it.
+const waitDelay = 2 * time.Second
+
 type Executor interface {
-	Execute(ctx context.Context, cmdStr string) (*Result, error)
+	Execute(ctx context.Context, cmd *ParsedCommand) (*Result, error)
 }
 
 type DefaultExecutor struct {
-	config ExecutorConfig
+	config  ExecutorConfig
+	limiter *executionLimiter
 }
 
 func NewDefaultExecutor(config ExecutorConfig) *DefaultExecutor {
@@ -27,38 +34,72 @@ func NewDefaultExecutor(config ExecutorConfig) *DefaultExecutor {
 	if config.MaxOutputSize == 0 {
 		config.MaxOutputSize = 10 * 1024 * 1024
 	}
-	return &DefaultExecutor{
+	executor := &DefaultExecutor{
 		config: config,
 	}
+	if config.MaxConcurrent > 0 {
+		executor.limiter = newExecutionLimiter(config.MaxConcurrent, config.MaxQueued, config.QueueTimeout)
+	}
+	return executor
 }
 
-func (e *DefaultExecutor) Execute(ctx context.Context, cmdStr string) (*Result, error) {
+// Execute runs a command produced by ParseCommand. Anything else, including a
+// ParsedCommand whose arguments no longer match its raw string, is refused.
+func (e *DefaultExecutor) Execute(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
 	startTime := time.Now()
 
-	args, err := e.parseCommandString(cmdStr)
+	if err := cmd.verify(); err != nil {
+		return nil, NewAzCliError(ErrorTypeInvalidCommand, err.Error(), "")
+	}
+	cmdStr := cmd.Raw()
+	args := cmd.Args()
+
+	configDir, err := e.config.ConfigDirs.Dir(ctx)
 	if err != nil {
-		return nil, NewAzCliError(ErrorTypeInvalidCommand, err.Error(), cmdStr)
+		return nil, NewAzCliError(ErrorTypeExecution, err.Error(), cmdStr)
+	}
+
+	if e.limiter != nil {
+		release, err := e.limiter.acquire(ctx, SessionIDFromContext(ctx), cmdStr)
+		if err != nil {
+			return nil, err
+		}
+		defer release()
+		// Time spent in the queue does not count towards the command's
+		// duration.
+		startTime = time.Now()
 	}
 
+	metrics.InFlight.Inc()
+	defer metrics.InFlight.Dec()
+
 	ctxWithTimeout, cancel := context.WithTimeout(ctx, e.config.Timeout)
 	defer cancel()
 
 	// #nosec G204 - This is the intended behavior: execute validated Azure CLI commands
-	cmd := exec.CommandContext(ctxWithTimeout, args[0], args[1:]...)
+	execCmd := exec.CommandContext(ctxWithTimeout, args[0], args[1:]...)
+	execCmd.WaitDelay = waitDelay
 
 	if e.config.WorkingDir != "" {
-		cmd.Dir = e.config.WorkingDir
+		execCmd.Dir = e.config.WorkingDir
 	}
 
-	if len(e.config.AllowedEnvVars) > 0 {
-		cmd.Env = e.config.AllowedEnvVars
+	env := e.config.AllowedEnvVars
+	if configDir != "" {
+		if len(env) == 0 {
+			env = os.Environ()
+		}
+		env = append(slices.Clip(env), "AZURE_CONFIG_DIR="+configDir)
+	}
+	if len(env) > 0 {
+		execCmd.Env = env
 	}
 
 	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	execCmd.Stdout = &stdout
+	execCmd.Stderr = &stderr
 
-	err = cmd.Run()
+	err = execCmd.Run()
 	duration := time.Since(startTime)
 
 	exitCode := 0
@@ -95,6 +136,12 @@ func (e *DefaultExecutor) Execute(ctx context.Context, cmdStr string) (*Result,
 		}
 	}
 
+	if exitCode != 0 {
+		if azErr := classifyError(errorMsg, cmdStr); azErr != nil {
+			return nil, azErr.WithContext("exit_code", exitCode).WithContext("stderr", errorMsg)
+		}
+	}
+
 	result := &Result{
 		Output:   output,
 		ExitCode: exitCode,
@@ -105,63 +152,6 @@ func (e *DefaultExecutor) Execute(ctx context.Context, cmdStr string) (*Result,
 	return result, nil
 }
 
-func (e *DefaultExecutor) parseCommandString(cmdStr string) ([]string, error) {
-	cmdStr = strings.TrimSpace(cmdStr)
-	if cmdStr == "" {
-		return nil, fmt.Errorf("empty command string")
-	}
-
-	args := []string{}
-	var current strings.Builder
-	inQuote := false
-	quoteChar := rune(0)
-
-	for i := 0; i < len(cmdStr); i++ {
-		ch := rune(cmdStr[i])
-		switch {
-		case ch == '"' || ch == '\'':
-			if !inQuote {
-				inQuote = true
-				quoteChar = ch
-			} else if ch == quoteChar {
-				inQuote = false
-				quoteChar = 0
-			} else {
-				current.WriteRune(ch)
-			}
-		case ch == ' ' && !inQuote:
-			if current.Len() > 0 {
-				args = append(args, current.String())
-				current.Reset()
-			}
-		case ch == '\\' && i+1 < len(cmdStr):
-			next := rune(cmdStr[i+1])
-			if next == '"' || next == '\'' || next == '\\' {
-				current.WriteRune(next)
-				i++
-			} else {
-				current.WriteRune(ch)
-			}
-		default:
-			current.WriteRune(ch)
-		}
-	}
-
-	if inQuote {
-		return nil, fmt.Errorf("unclosed quote in command string")
-	}
-
-	if current.Len() > 0 {
-		args = append(args, current.String())
-	}
-
-	if len(args) == 0 {
-		return nil, fmt.Errorf("no command found")
-	}
-
-	return args, nil
-}
-
 // isAuthError detects authentication-related errors from Azure CLI stderr output.
 // This method checks for common authentication failure patterns based on actual Azure CLI error messages.
 //
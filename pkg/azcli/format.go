@@ -0,0 +1,353 @@
+package azcli
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// OutputFormat is a rendering of JSON command output produced by the server.
+type OutputFormat string
+
+const (
+	OutputFormatJSON          OutputFormat = "json"
+	OutputFormatCompactJSON   OutputFormat = "compact-json"
+	OutputFormatYAML          OutputFormat = "yaml"
+	OutputFormatMarkdownTable OutputFormat = "markdown-table"
+	OutputFormatCSV           OutputFormat = "csv"
+)
+
+// OutputFormats lists every supported OutputFormat.
+var OutputFormats = []OutputFormat{
+	OutputFormatJSON,
+	OutputFormatCompactJSON,
+	OutputFormatYAML,
+	OutputFormatMarkdownTable,
+	OutputFormatCSV,
+}
+
+// azOutputFormats are the values az accepts for --output.
+var azOutputFormats = []string{"json", "jsonc", "none", "table", "tsv", "yaml", "yamlc"}
+
+// jsonOutputFormats are --output values whose output the server can parse.
+var jsonOutputFormats = []string{"json", "none"}
+
+// normalizeOutputFormat makes cmd request JSON output by replacing any
+// --output/-o flag with "--output json", unless the requested format is in
+// allowed. It reports whether the command's output is expected to be JSON.
+// Help output is never JSON and is left alone.
+func normalizeOutputFormat(cmd *ParsedCommand, allowed []string) (*ParsedCommand, bool, error) {
+	if cmd.HasFlag("--help") || cmd.HasFlag("-h") {
+		return cmd, false, nil
+	}
+
+	values := append(cmd.FlagValues("--output"), cmd.FlagValues("-o")...)
+	if len(values) == 1 {
+		requested := strings.ToLower(values[0])
+		if slices.Contains(jsonOutputFormats, requested) {
+			return cmd, true, nil
+		}
+		if slices.Contains(allowed, requested) {
+			return cmd, false, nil
+		}
+	}
+
+	args := dropFlags(cmd.Args(), map[string]bool{"--output": true, "-o": true})
+	normalized, err := parsedFromArgs(append(args, "--output", "json"))
+	if err != nil {
+		return nil, false, err
+	}
+	return normalized, true, nil
+}
+
+// ValidateOutputFormats checks that every format is an az --output value.
+func ValidateOutputFormats(formats []string) error {
+	for _, format := range formats {
+		if !slices.Contains(azOutputFormats, strings.ToLower(format)) {
+			return fmt.Errorf("invalid output format %q (must be one of %s)", format, strings.Join(azOutputFormats, ", "))
+		}
+	}
+	return nil
+}
+
+// RenderOutput renders JSON output in format. An empty format returns the
+// output unchanged. Output that is not JSON, which is only possible for
+// --output values allowed to pass through, is returned as is for the json
+// format and rejected for every other format.
+func RenderOutput(output json.RawMessage, format OutputFormat) (string, error) {
+	if format == "" {
+		return string(output), nil
+	}
+	if !slices.Contains(OutputFormats, format) {
+		return "", NewAzCliError(ErrorTypeInvalidCommand, fmt.Sprintf("unsupported format %q", format), "")
+	}
+
+	if !json.Valid(output) {
+		if format == OutputFormatJSON {
+			return string(output), nil
+		}
+		return "", NewAzCliError(ErrorTypeParseOutput, fmt.Sprintf("command output is not JSON and cannot be rendered as %s", format), "")
+	}
+
+	switch format {
+	case OutputFormatCompactJSON:
+		var buf bytes.Buffer
+		if err := json.Compact(&buf, output); err != nil {
+			return "", parseOutputError(err)
+		}
+		return buf.String(), nil
+
+	case OutputFormatYAML:
+		return renderYAML(output)
+
+	case OutputFormatMarkdownTable, OutputFormatCSV:
+		value, err := decodeOrdered(output)
+		if err != nil {
+			return "", parseOutputError(err)
+		}
+		columns, rows := tableRows(value)
+		if format == OutputFormatCSV {
+			return renderCSV(columns, rows)
+		}
+		return renderMarkdownTable(columns, rows), nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, output, "", "  "); err != nil {
+		return "", parseOutputError(err)
+	}
+	return buf.String(), nil
+}
+
+func parseOutputError(err error) error {
+	return NewAzCliError(ErrorTypeParseOutput, fmt.Sprintf("failed to parse command output: %v", err), "")
+}
+
+// renderYAML converts JSON to YAML keeping the key order. JSON is valid
+// YAML, so it is parsed into a node tree whose flow and quoting styles are
+// then reset to block style.
+func renderYAML(output json.RawMessage) (string, error) {
+	var node yaml.Node
+	if err := yaml.Unmarshal(output, &node); err != nil {
+		return "", parseOutputError(err)
+	}
+	resetYAMLStyle(&node)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&node); err != nil {
+		return "", parseOutputError(err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", parseOutputError(err)
+	}
+	return buf.String(), nil
+}
+
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+// orderedObject is a decoded JSON object that remembers its key order.
+type orderedObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		encodedKey, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		encodedValue, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(encodedKey)
+		buf.WriteByte(':')
+		buf.Write(encodedValue)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// decodeOrdered decodes JSON into nested []any and *orderedObject values,
+// keeping numbers as json.Number.
+func decodeOrdered(data []byte) (any, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decodeOrderedValue(decoder)
+}
+
+func decodeOrderedValue(decoder *json.Decoder) (any, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	delim, ok := token.(json.Delim)
+	if !ok {
+		return token, nil
+	}
+
+	switch delim {
+	case '{':
+		object := &orderedObject{values: make(map[string]any)}
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return nil, err
+			}
+			key, _ := keyToken.(string)
+			value, err := decodeOrderedValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			if _, exists := object.values[key]; !exists {
+				object.keys = append(object.keys, key)
+			}
+			object.values[key] = value
+		}
+		_, err := decoder.Token()
+		return object, err
+
+	case '[':
+		array := []any{}
+		for decoder.More() {
+			value, err := decodeOrderedValue(decoder)
+			if err != nil {
+				return nil, err
+			}
+			array = append(array, value)
+		}
+		_, err := decoder.Token()
+		return array, err
+	}
+
+	return nil, fmt.Errorf("unexpected delimiter %v", delim)
+}
+
+// tableRows flattens a decoded value into table columns and rows. Objects in
+// an array become rows whose columns are the union of their keys in order of
+// first appearance; a single object becomes one row; scalars go into a
+// "value" column. Nested values are rendered as compact JSON.
+func tableRows(value any) ([]string, [][]string) {
+	items, ok := value.([]any)
+	if !ok {
+		items = []any{value}
+	}
+
+	var columns []string
+	seen := make(map[string]bool)
+	addColumn := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			columns = append(columns, name)
+		}
+	}
+	for _, item := range items {
+		if object, ok := item.(*orderedObject); ok {
+			for _, key := range object.keys {
+				addColumn(key)
+			}
+		} else {
+			addColumn("value")
+		}
+	}
+
+	rows := make([][]string, 0, len(items))
+	for _, item := range items {
+		row := make([]string, len(columns))
+		object, isObject := item.(*orderedObject)
+		for i, column := range columns {
+			switch {
+			case isObject:
+				if cell, ok := object.values[column]; ok {
+					row[i] = formatCell(cell)
+				}
+			case column == "value":
+				row[i] = formatCell(item)
+			}
+		}
+		rows = append(rows, row)
+	}
+	return columns, rows
+}
+
+func formatCell(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		return fmt.Sprint(v)
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func renderMarkdownTable(columns []string, rows [][]string) string {
+	if len(columns) == 0 {
+		return ""
+	}
+
+	escape := strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+	writeRow := func(buf *strings.Builder, cells []string) {
+		buf.WriteString("|")
+		for _, cell := range cells {
+			buf.WriteString(" ")
+			buf.WriteString(escape.Replace(cell))
+			buf.WriteString(" |")
+		}
+		buf.WriteString("\n")
+	}
+
+	var buf strings.Builder
+	writeRow(&buf, columns)
+	separator := make([]string, len(columns))
+	for i := range separator {
+		separator[i] = "---"
+	}
+	writeRow(&buf, separator)
+	for _, row := range rows {
+		writeRow(&buf, row)
+	}
+	return buf.String()
+}
+
+func renderCSV(columns []string, rows [][]string) (string, error) {
+	if len(columns) == 0 {
+		return "", nil
+	}
+
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if err := writer.Write(columns); err != nil {
+		return "", err
+	}
+	if err := writer.WriteAll(rows); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
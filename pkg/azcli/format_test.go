@@ -0,0 +1,97 @@
+package azcli
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestRenderOutput(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		format OutputFormat
+		want   string
+	}{
+		{
+			name:   "unchanged by default",
+			output: `[ {"name": "vm1"} ]`,
+			want:   `[ {"name": "vm1"} ]`,
+		},
+		{
+			name:   "json is indented",
+			output: `{"name":"vm1","tags":{"env":"prod"}}`,
+			format: OutputFormatJSON,
+			want:   "{\n  \"name\": \"vm1\",\n  \"tags\": {\n    \"env\": \"prod\"\n  }\n}",
+		},
+		{
+			name:   "compact json",
+			output: "{\n  \"name\": \"vm1\",\n  \"count\": 2\n}",
+			format: OutputFormatCompactJSON,
+			want:   `{"name":"vm1","count":2}`,
+		},
+		{
+			name:   "yaml keeps key order and quotes ambiguous strings",
+			output: `{"zone": "1", "name": "vm1", "enabled": "true", "tags": {"env": "prod"}, "ids": [1, 2]}`,
+			format: OutputFormatYAML,
+			want:   "zone: \"1\"\nname: vm1\nenabled: \"true\"\ntags:\n  env: prod\nids:\n  - 1\n  - 2\n",
+		},
+		{
+			name:   "markdown table",
+			output: testVMList,
+			format: OutputFormatMarkdownTable,
+			want: "| name | location | properties | tags |\n" +
+				"| --- | --- | --- | --- |\n" +
+				"| vm1 | eastus | {\"provisioningState\":\"Succeeded\"} | {\"env\":\"prod\"} |\n" +
+				"| vm2 | westus | {\"provisioningState\":\"Failed\"} |  |\n",
+		},
+		{
+			name:   "markdown table escapes pipes and newlines",
+			output: `{"description": "a|b\nc"}`,
+			format: OutputFormatMarkdownTable,
+			want:   "| description |\n| --- |\n| a\\|b<br>c |\n",
+		},
+		{
+			name:   "csv with union of keys",
+			output: `[{"name": "vm1", "size": 2}, {"name": "vm, 2", "zone": "1"}]`,
+			format: OutputFormatCSV,
+			want:   "name,size,zone\nvm1,2,\n\"vm, 2\",,1\n",
+		},
+		{
+			name:   "csv of scalars",
+			output: `["vm1", "vm2"]`,
+			format: OutputFormatCSV,
+			want:   "value\nvm1\nvm2\n",
+		},
+		{
+			name:   "non-JSON passes through as json",
+			output: "Name    Location",
+			format: OutputFormatJSON,
+			want:   "Name    Location",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RenderOutput(json.RawMessage(tt.output), tt.format)
+			if err != nil {
+				t.Fatalf("RenderOutput() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RenderOutput() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderOutput_Errors(t *testing.T) {
+	_, err := RenderOutput(json.RawMessage("Name    Location"), OutputFormatCSV)
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeParseOutput {
+		t.Errorf("RenderOutput() of non-JSON error = %v, want ErrorTypeParseOutput", err)
+	}
+
+	if _, err := RenderOutput(json.RawMessage(`[]`), "xml"); err == nil {
+		t.Error("RenderOutput() should reject unknown formats")
+	}
+}
@@ -0,0 +1,93 @@
+package azcli
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+var identityNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// IdentityProfiles are the named Azure identities commands can run as. Calls
+// select one with the identity argument of call_az; calls that do not get
+// DefaultIdentity, or the first identity when it is empty.
+type IdentityProfiles struct {
+	DefaultIdentity string       `yaml:"defaultIdentity"`
+	Identities      []AuthConfig `yaml:"identities"`
+}
+
+func LoadIdentityProfiles(filePath string) (*IdentityProfiles, error) {
+	// #nosec G304 - This is the intended behavior: load identity profiles from user-specified path
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identities file: %w", err)
+	}
+
+	var profiles IdentityProfiles
+	if err := yaml.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse identities: %w", err)
+	}
+	if err := profiles.validate(); err != nil {
+		return nil, fmt.Errorf("invalid identities: %w", err)
+	}
+	for i := range profiles.Identities {
+		profile := &profiles.Identities[i]
+		if profile.ClientSecretEnv == "" {
+			continue
+		}
+		if profile.ClientSecret = os.Getenv(profile.ClientSecretEnv); profile.ClientSecret == "" {
+			return nil, fmt.Errorf("identity %s: environment variable %s is not set", profile.Name, profile.ClientSecretEnv)
+		}
+	}
+	if profiles.DefaultIdentity == "" {
+		profiles.DefaultIdentity = profiles.Identities[0].Name
+	}
+	return &profiles, nil
+}
+
+func (p *IdentityProfiles) validate() error {
+	if len(p.Identities) == 0 {
+		return fmt.Errorf("at least one identity is required")
+	}
+	seen := make(map[string]bool)
+	for i, profile := range p.Identities {
+		if !identityNamePattern.MatchString(profile.Name) {
+			return fmt.Errorf("identity #%d: invalid name %q (letters, digits, '.', '_' and '-')", i+1, profile.Name)
+		}
+		if seen[profile.Name] {
+			return fmt.Errorf("identity %s is defined more than once", profile.Name)
+		}
+		seen[profile.Name] = true
+	}
+	if p.DefaultIdentity != "" && !seen[p.DefaultIdentity] {
+		return fmt.Errorf("default identity %q is not defined", p.DefaultIdentity)
+	}
+	return nil
+}
+
+// Default returns the profile of DefaultIdentity.
+func (p *IdentityProfiles) Default() AuthConfig {
+	if p == nil {
+		return AuthConfig{}
+	}
+	for _, profile := range p.Identities {
+		if profile.Name == p.DefaultIdentity {
+			return profile
+		}
+	}
+	return AuthConfig{}
+}
+
+// Names returns the names of the identities in the order they are defined.
+func (p *IdentityProfiles) Names() []string {
+	if p == nil {
+		return nil
+	}
+	names := make([]string, 0, len(p.Identities))
+	for _, profile := range p.Identities {
+		names = append(names, profile.Name)
+	}
+	return names
+}
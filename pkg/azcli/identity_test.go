@@ -0,0 +1,238 @@
+package azcli
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeIdentities(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "identities.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+const testIdentities = `
+defaultIdentity: reader
+identities:
+  - name: reader
+    description: Read-only access to production
+    authMethod: managed-identity
+    clientId: reader-client
+    defaultSubscription: prod-sub
+  - name: deployer
+    authMethod: service-principal
+    tenantId: tenant-1
+    clientId: deployer-client
+    clientSecretEnv: TEST_DEPLOYER_SECRET
+`
+
+func TestLoadIdentityProfiles(t *testing.T) {
+	t.Setenv("TEST_DEPLOYER_SECRET", "s3cret")
+	profiles, err := LoadIdentityProfiles(writeIdentities(t, testIdentities))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := profiles.Names(); len(got) != 2 || got[0] != "reader" || got[1] != "deployer" {
+		t.Errorf("Names() = %v", got)
+	}
+	if def := profiles.Default(); def.Name != "reader" || def.DefaultSubscription != "prod-sub" {
+		t.Errorf("Default() = %+v", def)
+	}
+	if secret := profiles.Identities[1].ClientSecret; secret != "s3cret" {
+		t.Errorf("ClientSecret = %q, want the value of clientSecretEnv", secret)
+	}
+
+	// The first identity is the default when none is named.
+	profiles, err = LoadIdentityProfiles(writeIdentities(t, "identities:\n  - name: a\n  - name: b\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if profiles.DefaultIdentity != "a" {
+		t.Errorf("DefaultIdentity = %q, want a", profiles.DefaultIdentity)
+	}
+}
+
+func TestLoadIdentityProfiles_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{name: "empty", content: "identities: []\n", wantErr: "at least one identity"},
+		{name: "missing name", content: "identities:\n  - authMethod: auto\n", wantErr: "identity #1: invalid name"},
+		{name: "path in name", content: "identities:\n  - name: ../x\n", wantErr: "invalid name"},
+		{name: "duplicate", content: "identities:\n  - name: a\n  - name: a\n", wantErr: "identity a is defined more than once"},
+		{name: "unknown default", content: "defaultIdentity: b\nidentities:\n  - name: a\n", wantErr: `default identity "b"`},
+		{name: "unset secret", content: "identities:\n  - name: a\n    clientSecretEnv: TEST_UNSET_IDENTITY_SECRET\n", wantErr: "TEST_UNSET_IDENTITY_SECRET is not set"},
+	}
+	for _, tt := range tests {
+		_, err := LoadIdentityProfiles(writeIdentities(t, tt.content))
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestClient_EvaluateCommand_Identities(t *testing.T) {
+	bindings := `
+policies:
+  readers:
+    readOnly: true
+  deployers:
+    identities: ["deploy-*"]
+bindings:
+  - policy: deployers
+    apiKey: ci
+defaultPolicy: readers
+`
+	client, err := NewClient(ClientConfig{
+		PolicyBindingsFile: writeBindings(t, bindings),
+		Identities: map[string]*CredentialManager{
+			"reader":      NewCredentialManager(CredentialConfig{}),
+			"deploy-prod": NewCredentialManager(CredentialConfig{}),
+		},
+		DefaultIdentity: "reader",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ci := WithCaller(context.Background(), Caller{Principal: "api-key:ci", APIKey: "ci"})
+	anonymous := context.Background()
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		identity string
+		wantErr  ErrorType
+	}{
+		{name: "default identity", ctx: anonymous},
+		{name: "default identity by name", ctx: anonymous, identity: "reader"},
+		{name: "identity not in policy", ctx: anonymous, identity: "deploy-prod", wantErr: ErrorTypeCommandDenied},
+		{name: "identity in policy", ctx: ci, identity: "deploy-prod"},
+		{name: "default identity not in policy", ctx: ci, identity: "reader", wantErr: ErrorTypeCommandDenied},
+		{name: "unknown identity", ctx: ci, identity: "deploy-test", wantErr: ErrorTypeInvalidCommand},
+	}
+	for _, tt := range tests {
+		ctx := tt.ctx
+		if tt.identity != "" {
+			ctx = WithIdentityName(ctx, tt.identity)
+		}
+		_, err := client.EvaluateCommand(ctx, "az group list")
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("%s: error = %v", tt.name, err)
+			}
+			continue
+		}
+		var azErr *AzCliError
+		if !errors.As(err, &azErr) || azErr.Type != tt.wantErr {
+			t.Errorf("%s: error = %v, want %s", tt.name, err, tt.wantErr)
+		}
+	}
+
+	report, err := client.DryRunCommand(WithIdentityName(anonymous, "deploy-prod"), "az group list", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Identity != "deploy-prod" || report.Allowed {
+		t.Errorf("dry run: Identity = %q, Allowed = %v", report.Identity, report.Allowed)
+	}
+}
+
+func TestClient_EvaluateCommand_ServerWideIdentities(t *testing.T) {
+	identities := map[string]*CredentialManager{
+		"reader":      NewCredentialManager(CredentialConfig{}),
+		"deploy-prod": NewCredentialManager(CredentialConfig{}),
+	}
+	tests := []struct {
+		name     string
+		allowed  []string
+		identity string
+		wantErr  bool
+	}{
+		{name: "default identity", identity: "reader"},
+		{name: "other identity not allowed", identity: "deploy-prod", wantErr: true},
+		{name: "other identity allowed", allowed: []string{"deploy-*"}, identity: "deploy-prod"},
+		{name: "default identity always allowed", allowed: []string{"deploy-*"}, identity: "reader"},
+	}
+	for _, tt := range tests {
+		client, err := NewClient(ClientConfig{Identities: identities, DefaultIdentity: "reader", AllowedIdentities: tt.allowed})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = client.EvaluateCommand(WithIdentityName(context.Background(), tt.identity), "az group list")
+		var azErr *AzCliError
+		if tt.wantErr && (!errors.As(err, &azErr) || azErr.Type != ErrorTypeCommandDenied) {
+			t.Errorf("%s: error = %v, want %s", tt.name, err, ErrorTypeCommandDenied)
+		}
+		if !tt.wantErr && err != nil {
+			t.Errorf("%s: error = %v", tt.name, err)
+		}
+	}
+}
+
+func TestClient_DryRunCommand_WhatIfDisallowedIdentity(t *testing.T) {
+	bindings := "policies:\n  deployers:\n    readOnly: false\nbindings:\n  - policy: deployers\n    apiKey: ci\n"
+	c, err := NewClient(ClientConfig{
+		PolicyBindingsFile: writeBindings(t, bindings),
+		Identities: map[string]*CredentialManager{
+			"reader":      NewCredentialManager(CredentialConfig{}),
+			"deploy-prod": NewCredentialManager(CredentialConfig{}),
+		},
+		DefaultIdentity: "reader",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mockExec := &mockExecutor{}
+	client := c.(*DefaultClient)
+	client.executor = mockExec
+
+	ctx := WithIdentityName(WithCaller(context.Background(), Caller{Principal: "api-key:ci", APIKey: "ci"}), "deploy-prod")
+	report, err := client.DryRunCommand(ctx, "az deployment group create -g rg --template-file main.bicep", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Allowed || report.WhatIf == nil || report.WhatIf.Executed || report.WhatIf.Reason == "" {
+		t.Errorf("what-if of a disallowed identity: Allowed = %v, WhatIf = %+v", report.Allowed, report.WhatIf)
+	}
+	if mockExec.callCount != 0 {
+		t.Errorf("what-if ran %d commands as a disallowed identity", mockExec.callCount)
+	}
+}
+
+func TestRegisterCallAzTool_Identities(t *testing.T) {
+	profiles := &IdentityProfiles{
+		DefaultIdentity: "reader",
+		Identities: []AuthConfig{
+			{Name: "reader", Description: "Read-only access", DefaultSubscription: "prod-sub"},
+			{Name: "deployer"},
+		},
+	}
+	tool := RegisterCallAzTool(false, "prod-sub", false, profiles)
+	if _, ok := tool.InputSchema.Properties["identity"]; !ok {
+		t.Error("call_az has no identity argument")
+	}
+	for _, want := range []string{"- reader (default): Read-only access [subscription: prod-sub]", "- deployer\n"} {
+		if !strings.Contains(tool.Description, want) {
+			t.Errorf("description does not contain %q:\n%s", want, tool.Description)
+		}
+	}
+
+	single := &IdentityProfiles{DefaultIdentity: DefaultIdentity, Identities: []AuthConfig{{Name: DefaultIdentity}}}
+	tool = RegisterCallAzTool(false, "", false, single)
+	if _, ok := tool.InputSchema.Properties["identity"]; ok {
+		t.Error("call_az has an identity argument with a single identity")
+	}
+	if strings.Contains(tool.Description, "Identities") {
+		t.Errorf("description lists a single identity:\n%s", tool.Description)
+	}
+}
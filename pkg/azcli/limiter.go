@@ -0,0 +1,153 @@
+package azcli
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+// executionLimiter bounds the number of concurrently running az processes.
+// Callers that find every slot taken wait in a bounded queue. Waiters are
+// grouped by session and freed slots are handed to sessions in round-robin
+// order, so one session submitting many commands cannot starve the others.
+type executionLimiter struct {
+	maxConcurrent int
+	maxQueued     int
+	queueTimeout  time.Duration
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	// queues holds the waiters of each session in arrival order; sessions
+	// lists the sessions with waiters in the order they are served.
+	queues   map[string][]*slotWaiter
+	sessions []string
+}
+
+type slotWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newExecutionLimiter(maxConcurrent, maxQueued int, queueTimeout time.Duration) *executionLimiter {
+	return &executionLimiter{
+		maxConcurrent: maxConcurrent,
+		maxQueued:     maxQueued,
+		queueTimeout:  queueTimeout,
+		queues:        make(map[string][]*slotWaiter),
+	}
+}
+
+// acquire waits for an execution slot. The returned release function must be
+// called once the command has finished.
+func (l *executionLimiter) acquire(ctx context.Context, sessionID string, cmdStr string) (func(), error) {
+	l.mu.Lock()
+	if l.running < l.maxConcurrent && l.queued == 0 {
+		l.running++
+		l.mu.Unlock()
+		return l.release, nil
+	}
+
+	if l.queued >= l.maxQueued {
+		l.mu.Unlock()
+		metrics.QueueRejections.Inc("full")
+		return nil, NewAzCliError(ErrorTypeQueueFull, "too many commands are queued for execution, try again later", cmdStr).
+			WithContext("maxConcurrent", l.maxConcurrent).
+			WithContext("maxQueued", l.maxQueued)
+	}
+
+	waiter := &slotWaiter{ready: make(chan struct{})}
+	if len(l.queues[sessionID]) == 0 {
+		l.sessions = append(l.sessions, sessionID)
+	}
+	l.queues[sessionID] = append(l.queues[sessionID], waiter)
+	l.queued++
+	metrics.QueueDepth.Set(float64(l.queued))
+	l.mu.Unlock()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if l.queueTimeout > 0 {
+		timer := time.NewTimer(l.queueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-waiter.ready:
+		metrics.QueueWait.Observe(time.Since(start).Seconds())
+		return l.release, nil
+	case <-timeout:
+		metrics.QueueRejections.Inc("timeout")
+		err = NewAzCliError(ErrorTypeQueueFull, "timed out waiting for an execution slot", cmdStr).
+			WithContext("queueTimeout", l.queueTimeout)
+	case <-ctx.Done():
+		metrics.QueueRejections.Inc("cancelled")
+		err = NewAzCliError(ErrorTypeTimeout, "command was cancelled while waiting for an execution slot", cmdStr)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if waiter.granted {
+		// The slot was handed over while we were giving up; pass it on.
+		l.running--
+		l.dispatch()
+		return nil, err
+	}
+	l.removeWaiter(sessionID, waiter)
+	return nil, err
+}
+
+func (l *executionLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.running--
+	l.dispatch()
+}
+
+// dispatch hands free slots to waiting sessions in round-robin order. The
+// caller must hold l.mu.
+func (l *executionLimiter) dispatch() {
+	for l.running < l.maxConcurrent && len(l.sessions) > 0 {
+		sessionID := l.sessions[0]
+		l.sessions = l.sessions[1:]
+
+		queue := l.queues[sessionID]
+		waiter := queue[0]
+		if len(queue) == 1 {
+			delete(l.queues, sessionID)
+		} else {
+			l.queues[sessionID] = queue[1:]
+			l.sessions = append(l.sessions, sessionID)
+		}
+
+		l.queued--
+		l.running++
+		waiter.granted = true
+		close(waiter.ready)
+	}
+	metrics.QueueDepth.Set(float64(l.queued))
+}
+
+// removeWaiter drops a waiter that gave up. The caller must hold l.mu.
+func (l *executionLimiter) removeWaiter(sessionID string, waiter *slotWaiter) {
+	queue := l.queues[sessionID]
+	index := slices.Index(queue, waiter)
+	if index < 0 {
+		return
+	}
+
+	queue = slices.Delete(queue, index, index+1)
+	if len(queue) == 0 {
+		delete(l.queues, sessionID)
+		l.sessions = slices.DeleteFunc(l.sessions, func(s string) bool { return s == sessionID })
+	} else {
+		l.queues[sessionID] = queue
+	}
+	l.queued--
+	metrics.QueueDepth.Set(float64(l.queued))
+}
@@ -0,0 +1,203 @@
+package azcli
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued blocks until the limiter has n queued waiters.
+func waitQueued(t *testing.T, l *executionLimiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		queued := l.queued
+		l.mu.Unlock()
+		if queued == n {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d queued commands", n)
+}
+
+func assertQueueFull(t *testing.T, err error) {
+	t.Helper()
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeQueueFull {
+		t.Errorf("error = %v, want ErrorTypeQueueFull", err)
+	}
+}
+
+func TestExecutionLimiter_BoundsConcurrency(t *testing.T) {
+	l := newExecutionLimiter(2, 10, 0)
+
+	var mu sync.Mutex
+	running, maxRunning := 0, 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background(), "s1", "az vm list")
+			if err != nil {
+				t.Errorf("acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+
+			time.Sleep(5 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			release()
+		}()
+	}
+	wg.Wait()
+
+	if maxRunning > 2 {
+		t.Errorf("%d commands ran at once, want at most 2", maxRunning)
+	}
+	if l.running != 0 || l.queued != 0 {
+		t.Errorf("limiter not drained: running=%d queued=%d", l.running, l.queued)
+	}
+}
+
+func TestExecutionLimiter_QueueFull(t *testing.T) {
+	l := newExecutionLimiter(1, 1, 0)
+
+	release, err := l.acquire(context.Background(), "s1", "az vm list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queuedDone := make(chan error, 1)
+	go func() {
+		queuedRelease, err := l.acquire(context.Background(), "s1", "az vm list")
+		if err == nil {
+			queuedRelease()
+		}
+		queuedDone <- err
+	}()
+	waitQueued(t, l, 1)
+
+	_, err = l.acquire(context.Background(), "s2", "az vm list")
+	assertQueueFull(t, err)
+
+	release()
+	if err := <-queuedDone; err != nil {
+		t.Errorf("queued acquire() error = %v", err)
+	}
+}
+
+func TestExecutionLimiter_QueueTimeout(t *testing.T) {
+	l := newExecutionLimiter(1, 5, 20*time.Millisecond)
+
+	release, err := l.acquire(context.Background(), "s1", "az vm list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	_, err = l.acquire(context.Background(), "s1", "az vm list")
+	assertQueueFull(t, err)
+	if l.queued != 0 {
+		t.Errorf("timed out waiter still queued: %d", l.queued)
+	}
+}
+
+func TestExecutionLimiter_ContextCancelled(t *testing.T) {
+	l := newExecutionLimiter(1, 5, 0)
+
+	release, err := l.acquire(context.Background(), "s1", "az vm list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := l.acquire(ctx, "s2", "az vm list")
+		done <- err
+	}()
+	waitQueued(t, l, 1)
+	cancel()
+
+	var azErr *AzCliError
+	if err := <-done; !errors.As(err, &azErr) || azErr.Type != ErrorTypeTimeout {
+		t.Errorf("error = %v, want ErrorTypeTimeout", err)
+	}
+
+	release()
+	if l.running != 0 || l.queued != 0 || len(l.sessions) != 0 {
+		t.Errorf("limiter not drained: running=%d queued=%d sessions=%v", l.running, l.queued, l.sessions)
+	}
+}
+
+func TestExecutionLimiter_SessionFairness(t *testing.T) {
+	l := newExecutionLimiter(1, 10, 0)
+
+	release, err := l.acquire(context.Background(), "busy", "az vm list")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var order []string
+	var wg sync.WaitGroup
+	enqueue := func(sessionID string, n int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.acquire(context.Background(), sessionID, "az vm list")
+			if err != nil {
+				t.Errorf("acquire() error = %v", err)
+				return
+			}
+			mu.Lock()
+			order = append(order, sessionID)
+			mu.Unlock()
+			release()
+		}()
+		waitQueued(t, l, n)
+	}
+
+	enqueue("busy", 1)
+	enqueue("busy", 2)
+	enqueue("busy", 3)
+	enqueue("other", 4)
+
+	release()
+	wg.Wait()
+
+	want := []string{"busy", "other", "busy", "busy"}
+	for i := range want {
+		if i >= len(order) || order[i] != want[i] {
+			t.Fatalf("execution order = %v, want %v", order, want)
+		}
+	}
+}
+
+func TestExecutor_ExecuteQueueFull(t *testing.T) {
+	executor := NewDefaultExecutor(ExecutorConfig{MaxConcurrent: 1, MaxQueued: 0})
+
+	release, err := executor.limiter.acquire(context.Background(), "", "az version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	cmd, err := ParseCommand("az version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = executor.Execute(WithSessionID(context.Background(), "s1"), cmd)
+	assertQueueFull(t, err)
+}
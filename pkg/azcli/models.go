@@ -10,16 +10,93 @@ type Result struct {
 	ExitCode int
 	Error    string
 	Duration time.Duration
+	// Retries is the number of times the command was retried after a
+	// throttled or transient failure.
+	Retries int
+	// Cached reports that the result was served from the result cache.
+	Cached bool
 }
 
+// CallAzOutput is the structured content of a call_az result. Exactly one of
+// Output, Error and DryRun describes the outcome.
+type CallAzOutput struct {
+	Command  string `json:"command" jsonschema:"description=The command as given"`
+	ExitCode *int   `json:"exitCode,omitempty" jsonschema:"description=Exit code of az; absent when the command was not executed"`
+	// Output is the JSON output after jmespath and fields, or a JSON string
+	// when it was rendered in another format, truncated or is not JSON.
+	Output     json.RawMessage   `json:"output,omitempty" jsonschema:"description=Command output: JSON as returned by az after jmespath and fields\\, or a string when rendered with format\\, truncated or not JSON"`
+	Format     string            `json:"format,omitempty" jsonschema:"description=Format the output was rendered in"`
+	Warnings   []string          `json:"warnings,omitempty" jsonschema:"description=Lines written to stderr by a successful command"`
+	Stderr     string            `json:"stderr,omitempty" jsonschema:"description=stderr of a failed command"`
+	Retries    int               `json:"retries,omitempty" jsonschema:"description=Number of retries after throttled or transient failures"`
+	Cached     bool              `json:"cached,omitempty" jsonschema:"description=The result was served from the server's cache of read-only results"`
+	DurationMs int64             `json:"durationMs" jsonschema:"description=Execution time of az in milliseconds\\, or of the whole call when az did not run"`
+	Error      *ToolError        `json:"error,omitempty" jsonschema:"description=Why the call failed"`
+	Truncation *OutputTruncation `json:"truncation,omitempty" jsonschema:"description=Set when the output exceeded the response size limit"`
+	DryRun     *DryRunReport     `json:"dryRun,omitempty" jsonschema:"description=Validation report of a dry run"`
+}
+
+// ToolError is the structured form of a failed call_az invocation.
+type ToolError struct {
+	Type    ErrorType      `json:"type" jsonschema:"description=Error type to branch on (e.g. command_denied\\, execution_failed\\, timeout)"`
+	Message string         `json:"message"`
+	Context map[string]any `json:"context,omitempty" jsonschema:"description=Details extracted from the error\\, such as the policy rule or validation layer"`
+}
+
+// OutputTruncation describes how output larger than the response size limit
+// was returned.
+type OutputTruncation struct {
+	TotalBytes    int    `json:"totalBytes" jsonschema:"description=Size of the complete output in bytes"`
+	ReturnedBytes int    `json:"returnedBytes" jsonschema:"description=Size of the output returned in this result in bytes"`
+	Mode          string `json:"mode" jsonschema:"description=How the rest of the output is available (truncate\\, page or spill)"`
+	Handle        string `json:"handle,omitempty" jsonschema:"description=Handle to read further pages with"`
+	Page          int    `json:"page,omitempty" jsonschema:"description=Number of the returned page"`
+	Pages         int    `json:"pages,omitempty" jsonschema:"description=Number of pages"`
+	ResourceURI   string `json:"resourceUri,omitempty" jsonschema:"description=Resource holding the complete output"`
+	MIMEType      string `json:"mimeType,omitempty" jsonschema:"description=MIME type of the resource"`
+}
+
+// AuthConfig describes how az logs in as an identity. In an identities
+// file, the client secret is read from the environment variable named by
+// ClientSecretEnv.
 type AuthConfig struct {
-	SkipSetup           bool
-	AuthMethod          string
-	TenantID            string
-	ClientID            string
-	FederatedTokenFile  string
-	ClientSecret        string
-	DefaultSubscription string
+	// Name selects the identity in the identity argument of call_az and in
+	// policies.
+	Name                string `yaml:"name"`
+	Description         string `yaml:"description"`
+	SkipSetup           bool   `yaml:"skipSetup"`
+	AuthMethod          string `yaml:"authMethod"`
+	TenantID            string `yaml:"tenantId"`
+	ClientID            string `yaml:"clientId"`
+	FederatedTokenFile  string `yaml:"federatedTokenFile"`
+	ClientSecret        string `yaml:"-"`
+	ClientSecretEnv     string `yaml:"clientSecretEnv"`
+	DefaultSubscription string `yaml:"defaultSubscription"`
+	// Cloud is the az cloud to log in to, e.g. AzureUSGovernment; "" keeps
+	// the cloud az is set to.
+	Cloud string `yaml:"cloud"`
+	// CustomCloud is registered with az before login when Cloud is a custom
+	// cloud.
+	CustomCloud *CloudDefinition `yaml:"-"`
+	// ConfigDir is the AZURE_CONFIG_DIR to log in to; "" uses the default
+	// directory of az.
+	ConfigDir string `yaml:"-"`
+}
+
+// AccountInfo identifies the Azure account az is logged in with.
+type AccountInfo struct {
+	SubscriptionID string
+	TenantID       string
+	UserName       string
+	UserType       string
+}
+
+// Identity returns a display form such as "servicePrincipal:<client-id>".
+func (a *AccountInfo) Identity() string {
+	if a.UserType == "" {
+		return a.UserName
+	}
+	return a.UserType + ":" + a.UserName
 }
 
 type ExecutorConfig struct {
@@ -27,6 +104,14 @@ type ExecutorConfig struct {
 	WorkingDir     string
 	MaxOutputSize  int64
 	AllowedEnvVars []string
+	// MaxConcurrent limits the number of az processes running at once; 0
+	// means unlimited. Further commands wait in a queue of at most MaxQueued
+	// entries for up to QueueTimeout (0 waits until the context is done).
+	MaxConcurrent int
+	MaxQueued     int
+	QueueTimeout  time.Duration
+	// ConfigDirs selects the AZURE_CONFIG_DIR of each command.
+	ConfigDirs *ConfigDirManager
 }
 
 type ClientConfig struct {
@@ -37,6 +122,35 @@ type ClientConfig struct {
 	SecurityPolicyFile   string
 	ReadOnlyPatternsFile string
 	AuthSetup            AuthSetup
+	// Credentials refreshes the credentials of az. When nil, a manager that
+	// runs AuthSetup after auth errors is used.
+	Credentials *CredentialManager
+	// Identities are the credentials of the identities commands select with
+	// WithIdentityName. Commands that select none run as DefaultIdentity,
+	// whose credentials are Credentials.
+	Identities      map[string]*CredentialManager
+	DefaultIdentity string
+	// AllowedIdentities are glob patterns of the identities that callers of
+	// the server-wide policy may run commands as, besides DefaultIdentity.
+	// Policy bindings set the identities of their own policies.
+	AllowedIdentities []string
+	// ConfigDirs selects the AZURE_CONFIG_DIR of commands; nil uses the
+	// default directory of az.
+	ConfigDirs    *ConfigDirManager
+	MaxConcurrent int
+	MaxQueued     int
+	QueueTimeout  time.Duration
+	// MaxOutputSize is the output size at which execution fails (default
+	// 10 MiB).
+	MaxOutputSize int64
+	// AllowedOutputFormats are az --output values other than json that
+	// commands may request. Any other --output is replaced with json.
+	AllowedOutputFormats []string
+	// PolicyBindingsFile maps callers to named policies that replace
+	// ReadOnlyMode and the security policy for their commands.
+	PolicyBindingsFile string
+	Retry              RetryConfig
+	Cache              CacheConfig
 }
 
 type SecurityPolicy struct {
@@ -44,8 +158,76 @@ type SecurityPolicy struct {
 	Policy  PolicyRules `yaml:"policy"`
 }
 
+// PolicyRules holds an ordered list of allow/deny rules evaluated against the
+// parsed command. The first matching rule decides; DefaultAction applies when
+// no rule matches. DenyList is the legacy prefix format and is converted into
+// deny rules evaluated ahead of Rules.
+//
+// ApprovalTimeout is the default time to wait for a decision on commands
+// matched by a require-approval rule (e.g. "5m").
 type PolicyRules struct {
-	DenyList []string `yaml:"denyList"`
+	DefaultAction   PolicyAction `yaml:"defaultAction"`
+	ApprovalTimeout string       `yaml:"approvalTimeout"`
+	Rules           []PolicyRule `yaml:"rules"`
+	DenyList        []string     `yaml:"denyList"`
+}
+
+type PolicyAction string
+
+const (
+	PolicyActionAllow PolicyAction = "allow"
+	PolicyActionDeny  PolicyAction = "deny"
+	// PolicyActionRequireApproval allows the command only after it has been
+	// explicitly approved through the configured approval workflow.
+	PolicyActionRequireApproval PolicyAction = "require-approval"
+)
+
+// PolicyRule matches a command by its command path and, optionally, by flag
+// conditions. Command is a space-separated path without the leading "az";
+// each segment may use the wildcards "*" and "?" and a "**" segment
+// matches any number of segments (e.g. "storage account keys *",
+// "network **").
+//
+// ApprovalTimeout overrides the policy-wide approval timeout for
+// require-approval rules. Retry opts write commands matched by the rule into
+// automatic retries of throttled and transient failures; read-only commands
+// are always retried.
+type PolicyRule struct {
+	Name            string          `yaml:"name"`
+	Action          PolicyAction    `yaml:"action"`
+	Command         string          `yaml:"command"`
+	Flags           []FlagCondition `yaml:"flags"`
+	ApprovalTimeout string          `yaml:"approvalTimeout"`
+	Retry           bool            `yaml:"retry"`
+}
+
+// FlagCondition restricts a rule to commands whose flags satisfy it. Present
+// requires the flag to be given (true) or absent (false); Values requires at
+// least one of the flag's values to match one of the glob patterns
+// (case-insensitive). Aliases lists alternative names such as "-g" for
+// "--resource-group".
+type FlagCondition struct {
+	Name    string   `yaml:"name"`
+	Aliases []string `yaml:"aliases"`
+	Present *bool    `yaml:"present"`
+	Values  []string `yaml:"values"`
+}
+
+// ValidationResult describes a command that passed validation. Policy is nil
+// when the security policy is not enabled.
+type ValidationResult struct {
+	Command *ParsedCommand
+	Policy  *PolicyDecision
+	// ReadOnly reports whether the command path matches a read-only pattern,
+	// regardless of whether read-only mode is enabled.
+	ReadOnly         bool
+	RequiresApproval bool
+	// PolicyName is the policy selected by a policy binding, or "" for the
+	// server-wide policy.
+	PolicyName string
+	// ApprovalTimeout is zero when neither the matching rule nor the policy
+	// sets one; callers then apply their own default.
+	ApprovalTimeout time.Duration
 }
 
 type ReadOnlyPatterns struct {
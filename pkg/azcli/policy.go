@@ -0,0 +1,297 @@
+package azcli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PolicyDecision is the outcome of evaluating a security policy against a
+// command. Rule is nil when no rule matched and the default action applied.
+type PolicyDecision struct {
+	Action PolicyAction
+	Rule   *PolicyRule
+}
+
+// Allowed reports whether the decision permits the command, possibly subject
+// to approval.
+func (d PolicyDecision) Allowed() bool {
+	return d.Action != PolicyActionDeny
+}
+
+// RequiresApproval reports whether the command must be approved before it
+// runs.
+func (d PolicyDecision) RequiresApproval() bool {
+	return d.Action == PolicyActionRequireApproval
+}
+
+// RuleName returns the name of the matching rule, or "" when the default
+// action applied.
+func (d PolicyDecision) RuleName() string {
+	if d.Rule == nil {
+		return ""
+	}
+	return d.Rule.displayName()
+}
+
+// Evaluate walks the effective rule list in order and returns the decision of
+// the first rule matching cmd. Legacy denyList entries are evaluated first so
+// they cannot be overridden by an allow rule.
+func (p *SecurityPolicy) Evaluate(cmd *ParsedCommand) PolicyDecision {
+	_, decision := p.trace(cmd)
+	return decision
+}
+
+// RuleEvaluation records whether a single rule matched a command.
+type RuleEvaluation struct {
+	Rule    string       `json:"rule"`
+	Action  PolicyAction `json:"action"`
+	Matched bool         `json:"matched"`
+}
+
+// trace evaluates the rules like Evaluate and also returns every rule that was
+// checked, in order, up to and including the first match.
+func (p *SecurityPolicy) trace(cmd *ParsedCommand) ([]RuleEvaluation, PolicyDecision) {
+	var evaluations []RuleEvaluation
+	for _, rule := range p.effectiveRules() {
+		matched := rule.matches(cmd)
+		evaluations = append(evaluations, RuleEvaluation{Rule: rule.displayName(), Action: rule.Action, Matched: matched})
+		if matched {
+			return evaluations, PolicyDecision{Action: rule.Action, Rule: &rule}
+		}
+	}
+
+	action := p.Policy.DefaultAction
+	if action == "" {
+		action = PolicyActionAllow
+	}
+	return evaluations, PolicyDecision{Action: action}
+}
+
+func (p *SecurityPolicy) effectiveRules() []PolicyRule {
+	rules := make([]PolicyRule, 0, len(p.Policy.DenyList)+len(p.Policy.Rules))
+	for _, entry := range p.Policy.DenyList {
+		rule, err := legacyDenyRule(entry)
+		if err != nil {
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return append(rules, p.Policy.Rules...)
+}
+
+// approvalTimeout returns the timeout for a require-approval decision: the
+// rule's own timeout, else the policy-wide one, else zero.
+func (p *SecurityPolicy) approvalTimeout(decision PolicyDecision) time.Duration {
+	if decision.Rule != nil && decision.Rule.ApprovalTimeout != "" {
+		if timeout, err := time.ParseDuration(decision.Rule.ApprovalTimeout); err == nil {
+			return timeout
+		}
+	}
+	if timeout, err := time.ParseDuration(p.Policy.ApprovalTimeout); err == nil {
+		return timeout
+	}
+	return 0
+}
+
+func (p *SecurityPolicy) validate() error {
+	switch p.Policy.DefaultAction {
+	case "", PolicyActionAllow, PolicyActionDeny, PolicyActionRequireApproval:
+	default:
+		return fmt.Errorf("invalid defaultAction %q (must be allow, deny or require-approval)", p.Policy.DefaultAction)
+	}
+
+	if err := validateApprovalTimeout(p.Policy.ApprovalTimeout); err != nil {
+		return err
+	}
+
+	for _, entry := range p.Policy.DenyList {
+		if _, err := legacyDenyRule(entry); err != nil {
+			return fmt.Errorf("invalid denyList entry %q: %w", entry, err)
+		}
+	}
+
+	for i, rule := range p.Policy.Rules {
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid rule %d (%s): %w", i, rule.displayName(), err)
+		}
+	}
+	return nil
+}
+
+// legacyDenyRule converts a denyList entry such as "az vm delete --yes" into a
+// deny rule matching that command path and everything below it, with every
+// flag in the entry required to be present (and to have the given value).
+// Like the prefix match of the denyList, the last segment of the entry also
+// matches longer siblings, e.g. "delete" matches "delete-batch".
+func legacyDenyRule(entry string) (PolicyRule, error) {
+	cmd, err := ParseCommand(entry)
+	if err != nil {
+		return PolicyRule{}, err
+	}
+	if len(cmd.commandPath) == 0 {
+		return PolicyRule{}, fmt.Errorf("entry has no command path")
+	}
+
+	present := true
+	rule := PolicyRule{
+		Name:    entry,
+		Action:  PolicyActionDeny,
+		Command: strings.Join(cmd.commandPath, " ") + "* **",
+	}
+	for name, values := range cmd.flags {
+		condition := FlagCondition{Name: name, Present: &present}
+		for _, value := range values {
+			condition.Values = append(condition.Values, escapeGlob(value))
+		}
+		rule.Flags = append(rule.Flags, condition)
+	}
+	return rule, nil
+}
+
+func (r *PolicyRule) validate() error {
+	switch r.Action {
+	case PolicyActionAllow, PolicyActionDeny, PolicyActionRequireApproval:
+	default:
+		return fmt.Errorf("invalid action %q (must be allow, deny or require-approval)", r.Action)
+	}
+
+	if err := validateApprovalTimeout(r.ApprovalTimeout); err != nil {
+		return err
+	}
+
+	if len(strings.Fields(r.Command)) == 0 {
+		return fmt.Errorf("command is required")
+	}
+
+	for _, flag := range r.Flags {
+		if flag.Name == "" {
+			return fmt.Errorf("flag condition requires a name")
+		}
+	}
+	return nil
+}
+
+func validateApprovalTimeout(value string) error {
+	if value == "" {
+		return nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return fmt.Errorf("invalid approvalTimeout %q: %w", value, err)
+	}
+	if timeout <= 0 {
+		return fmt.Errorf("approvalTimeout must be greater than 0")
+	}
+	return nil
+}
+
+func (r *PolicyRule) displayName() string {
+	if r.Name != "" {
+		return r.Name
+	}
+	return r.Command
+}
+
+func (r *PolicyRule) matches(cmd *ParsedCommand) bool {
+	pattern := strings.Fields(strings.ToLower(r.Command))
+	if !matchCommandPath(pattern, cmd.commandPath) {
+		return false
+	}
+	for _, flag := range r.Flags {
+		if !flag.matches(cmd) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchCommandPath(pattern []string, commandPath []string) bool {
+	if len(pattern) == 0 {
+		return len(commandPath) == 0
+	}
+
+	if pattern[0] == "**" {
+		for i := 0; i <= len(commandPath); i++ {
+			if matchCommandPath(pattern[1:], commandPath[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(commandPath) == 0 {
+		return false
+	}
+	if !globMatch(pattern[0], commandPath[0]) {
+		return false
+	}
+	return matchCommandPath(pattern[1:], commandPath[1:])
+}
+
+func (c *FlagCondition) matches(cmd *ParsedCommand) bool {
+	present := false
+	var values []string
+	for _, name := range append([]string{c.Name}, c.Aliases...) {
+		if flagValues, ok := cmd.flags[strings.ToLower(name)]; ok {
+			present = true
+			values = append(values, flagValues...)
+		}
+	}
+
+	if c.Present != nil && *c.Present != present {
+		return false
+	}
+
+	if len(c.Values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		for _, pattern := range c.Values {
+			if globMatch(strings.ToLower(pattern), strings.ToLower(value)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// globMatch reports whether s matches pattern, where "*" matches any run of
+// characters (including "/"), "?" matches a single character and a backslash
+// escapes the following character.
+func globMatch(pattern, s string) bool {
+	p := []rune(pattern)
+	str := []rune(s)
+	pi, si := 0, 0
+	starPi, starSi := -1, 0
+
+	for si < len(str) {
+		switch {
+		case pi < len(p) && p[pi] == '*':
+			starPi, starSi = pi, si
+			pi++
+		case pi < len(p) && p[pi] == '\\' && pi+1 < len(p) && p[pi+1] == str[si]:
+			pi += 2
+			si++
+		case pi < len(p) && p[pi] != '\\' && (p[pi] == '?' || p[pi] == str[si]):
+			pi++
+			si++
+		case starPi >= 0:
+			pi = starPi + 1
+			starSi++
+			si = starSi
+		default:
+			return false
+		}
+	}
+
+	for pi < len(p) && p[pi] == '*' {
+		pi++
+	}
+	return pi == len(p)
+}
+
+func escapeGlob(value string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`)
+	return replacer.Replace(value)
+}
@@ -0,0 +1,255 @@
+package azcli
+
+import (
+	"testing"
+)
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+func TestSecurityPolicy_Evaluate(t *testing.T) {
+	policy := &SecurityPolicy{
+		Version: "1.0",
+		Policy: PolicyRules{
+			Rules: []PolicyRule{
+				{
+					Name:    "deny-storage-keys",
+					Action:  PolicyActionDeny,
+					Command: "storage account keys *",
+				},
+				{
+					Name:    "deny-forced-group-delete",
+					Action:  PolicyActionDeny,
+					Command: "group delete",
+					Flags: []FlagCondition{
+						{Name: "--yes", Aliases: []string{"-y"}, Present: boolPtr(true)},
+					},
+				},
+				{
+					Name:    "deny-prod-writes",
+					Action:  PolicyActionDeny,
+					Command: "** delete",
+					Flags: []FlagCondition{
+						{Name: "--resource-group", Aliases: []string{"-g"}, Values: []string{"prod-*"}},
+					},
+				},
+				{
+					Name:    "deny-prod-ids",
+					Action:  PolicyActionDeny,
+					Command: "** delete",
+					Flags: []FlagCondition{
+						{Name: "--ids", Values: []string{"*/resourceGroups/prod-*"}},
+					},
+				},
+				{
+					Name:    "allow-network",
+					Action:  PolicyActionAllow,
+					Command: "network **",
+				},
+				{
+					Name:    "deny-network-fallthrough",
+					Action:  PolicyActionDeny,
+					Command: "network vnet delete",
+				},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		wantRule string
+		allowed  bool
+	}{
+		{
+			name:     "storage account keys list denied",
+			input:    "az storage account keys list --account-name sa",
+			wantRule: "deny-storage-keys",
+			allowed:  false,
+		},
+		{
+			name:    "storage account list allowed",
+			input:   "az storage account list",
+			allowed: true,
+		},
+		{
+			name:     "group delete with --yes denied",
+			input:    "az group delete --name dev --yes",
+			wantRule: "deny-forced-group-delete",
+			allowed:  false,
+		},
+		{
+			name:     "group delete with -y alias denied",
+			input:    "az group delete --name dev -y",
+			wantRule: "deny-forced-group-delete",
+			allowed:  false,
+		},
+		{
+			name:    "group delete without --yes allowed",
+			input:   "az group delete --name dev",
+			allowed: true,
+		},
+		{
+			name:     "delete in prod resource group denied",
+			input:    "az vm delete -g PROD-eastus --name vm1",
+			wantRule: "deny-prod-writes",
+			allowed:  false,
+		},
+		{
+			name:     "delete by resource id in prod denied",
+			input:    "az vm delete --ids /subscriptions/000/resourceGroups/prod-eastus/providers/Microsoft.Compute/virtualMachines/vm1",
+			wantRule: "deny-prod-ids",
+			allowed:  false,
+		},
+		{
+			name:    "delete in dev resource group allowed",
+			input:   "az vm delete -g dev-eastus --name vm1",
+			allowed: true,
+		},
+		{
+			name:     "first matching rule wins",
+			input:    "az network vnet delete --name v1",
+			wantRule: "allow-network",
+			allowed:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCommand() error = %v", err)
+			}
+			decision := policy.Evaluate(cmd)
+			if decision.Allowed() != tt.allowed {
+				t.Errorf("Evaluate() allowed = %v, want %v", decision.Allowed(), tt.allowed)
+			}
+			gotRule := ""
+			if decision.Rule != nil {
+				gotRule = decision.Rule.Name
+			}
+			if gotRule != tt.wantRule {
+				t.Errorf("Evaluate() rule = %q, want %q", gotRule, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestSecurityPolicy_DefaultAction(t *testing.T) {
+	policy := &SecurityPolicy{
+		Policy: PolicyRules{
+			DefaultAction: PolicyActionDeny,
+			Rules: []PolicyRule{
+				{Action: PolicyActionAllow, Command: "* list"},
+			},
+		},
+	}
+
+	listCmd, _ := ParseCommand("az vm list")
+	if !policy.Evaluate(listCmd).Allowed() {
+		t.Error("az vm list should be allowed by rule")
+	}
+
+	createCmd, _ := ParseCommand("az vm create --name vm1")
+	decision := policy.Evaluate(createCmd)
+	if decision.Allowed() || decision.Rule != nil {
+		t.Errorf("az vm create should be denied by default action, got %+v", decision)
+	}
+}
+
+func TestDefaultSecurityPolicy_DeniesByPrefix(t *testing.T) {
+	policy, err := LoadSecurityPolicy("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		input   string
+		allowed bool
+	}{
+		{input: "az storage blob delete --name b1 --container-name c1", allowed: false},
+		{input: "az storage blob delete-batch --source c1", allowed: false},
+		{input: "az group delete --name rg1", allowed: false},
+		{input: "az vm delete --name vm1 -g rg1", allowed: false},
+		{input: "az login --identity", allowed: false},
+		{input: "az storage blob list --container-name c1", allowed: true},
+		{input: "az group list", allowed: true},
+	}
+	for _, tt := range tests {
+		cmd, err := ParseCommand(tt.input)
+		if err != nil {
+			t.Fatalf("ParseCommand(%q) error = %v", tt.input, err)
+		}
+		if got := policy.Evaluate(cmd).Allowed(); got != tt.allowed {
+			t.Errorf("%s: allowed = %v, want %v", tt.input, got, tt.allowed)
+		}
+	}
+}
+
+func TestSecurityPolicy_LegacyDenyListPrecedesRules(t *testing.T) {
+	policy := &SecurityPolicy{
+		Policy: PolicyRules{
+			DenyList: []string{"az vm delete --yes"},
+			Rules: []PolicyRule{
+				{Action: PolicyActionAllow, Command: "vm **"},
+			},
+		},
+	}
+
+	denied, _ := ParseCommand("az vm  delete --name vm1 --yes")
+	if policy.Evaluate(denied).Allowed() {
+		t.Error("legacy denyList entry should take precedence over allow rules")
+	}
+
+	allowed, _ := ParseCommand("az vm delete --name vm1")
+	if !policy.Evaluate(allowed).Allowed() {
+		t.Error("legacy entry with --yes should only match when --yes is present")
+	}
+}
+
+func TestSecurityPolicy_LegacyDenyListMatchesByPrefix(t *testing.T) {
+	policy := &SecurityPolicy{
+		Policy: PolicyRules{
+			DenyList: []string{"az storage blob delete"},
+		},
+	}
+
+	for _, input := range []string{
+		"az storage blob delete --name b1",
+		"az storage blob delete-batch --source c1",
+	} {
+		cmd, _ := ParseCommand(input)
+		if policy.Evaluate(cmd).Allowed() {
+			t.Errorf("%s: allowed by denyList entry az storage blob delete", input)
+		}
+	}
+
+	cmd, _ := ParseCommand("az storage blob list --container-name c1")
+	if !policy.Evaluate(cmd).Allowed() {
+		t.Error("denyList entry az storage blob delete denied az storage blob list")
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		pattern string
+		value   string
+		want    bool
+	}{
+		{"*", "", true},
+		{"prod-*", "prod-eastus", true},
+		{"prod-*", "dev-eastus", false},
+		{"*/resourcegroups/prod-*", "/subscriptions/1/resourcegroups/prod-a/providers/x", true},
+		{"vm?", "vm1", true},
+		{"vm?", "vm", false},
+		{`literal\*`, "literal*", true},
+		{`literal\*`, "literalx", false},
+	}
+
+	for _, tt := range tests {
+		if got := globMatch(tt.pattern, tt.value); got != tt.want {
+			t.Errorf("globMatch(%q, %q) = %v, want %v", tt.pattern, tt.value, got, tt.want)
+		}
+	}
+}
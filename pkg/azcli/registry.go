@@ -4,11 +4,14 @@ import (
 	"github.com/mark3labs/mcp-go/mcp"
 )
 
-func RegisterCallAzTool(readOnlyMode bool, defaultSubscription string) mcp.Tool {
-	description := generateToolDescription(readOnlyMode, defaultSubscription)
+// RegisterCallAzTool returns the call_az tool. When identities holds more
+// than one identity, the tool takes an identity argument and its description
+// lists them. The description names the cloud of the default identity.
+func RegisterCallAzTool(readOnlyMode bool, defaultSubscription string, dryRun bool, identities *IdentityProfiles) mcp.Tool {
+	description := generateToolDescription(readOnlyMode, defaultSubscription, dryRun, identities.Default().Cloud)
 
-	return mcp.NewTool("call_az",
-		mcp.WithDescription(description),
+	options := []mcp.ToolOption{
+		mcp.WithDescription(description + identitiesDescription(identities)),
 		mcp.WithString("cli_command",
 			mcp.Required(),
 			mcp.Description("The Azure CLI command to execute (e.g., 'az vm list --resource-group myRG'). Must be a single command without pipes, redirects, or shell substitutions."),
@@ -16,10 +19,65 @@ func RegisterCallAzTool(readOnlyMode bool, defaultSubscription string) mcp.Tool
 		mcp.WithNumber("timeout",
 			mcp.Description("Optional timeout in seconds (default: 120)"),
 		),
-	)
+		mcp.WithString("jmespath",
+			mcp.Description("Optional JMESPath expression the server applies to the JSON output before returning it (e.g. '[].{name:name, state:powerState}'). Applied after any --query in the command."),
+		),
+		mcp.WithArray("fields",
+			mcp.Description("Optional list of fields to keep from each object in the JSON output (e.g. [\"name\", \"location\", \"properties.provisioningState\"]). Applied after jmespath."),
+			mcp.WithStringItems(),
+		),
+		mcp.WithString("format",
+			mcp.Description("Optional format the server renders the JSON output in (default: the JSON as returned by az). Tables use one row per array element and render nested values as JSON. Applied after jmespath and fields."),
+			mcp.Enum("json", "compact-json", "yaml", "markdown-table", "csv"),
+		),
+		mcp.WithBoolean("no_cache",
+			mcp.Description("Run the command even if the server has a cached result for it (only read-only commands are cached)"),
+		),
+		mcp.WithBoolean("dry_run",
+			mcp.Description("Validate the command and return a report (parsed command, policy rules evaluated, whether it would be allowed, read/write classification) without executing it"),
+		),
+		mcp.WithBoolean("what_if",
+			mcp.Description("With dry_run, also run the command's native preview variant when it has one (e.g. 'az deployment group what-if' for 'az deployment group create', '--dryrun' for 'az webapp up')"),
+		),
+		mcp.WithOutputSchema[CallAzOutput](),
+	}
+	if names := identities.Names(); len(names) > 1 {
+		options = append(options, mcp.WithString("identity",
+			mcp.Description("Optional Azure identity to run the command as (default: "+identities.DefaultIdentity+")"),
+			mcp.Enum(names...),
+		))
+	}
+	return mcp.NewTool("call_az", options...)
+}
+
+// identitiesDescription lists the identities call_az can run commands as,
+// or returns "" when there is only one.
+func identitiesDescription(identities *IdentityProfiles) string {
+	if len(identities.Names()) <= 1 {
+		return ""
+	}
+	desc := "\nIdentities (select one with the identity argument; the server's policy decides which you may use):\n"
+	defaultCloud := identities.Default().Cloud
+	for _, profile := range identities.Identities {
+		desc += "- " + profile.Name
+		if profile.Name == identities.DefaultIdentity {
+			desc += " (default)"
+		}
+		if profile.Description != "" {
+			desc += ": " + profile.Description
+		}
+		if profile.DefaultSubscription != "" {
+			desc += " [subscription: " + profile.DefaultSubscription + "]"
+		}
+		if profile.Cloud != "" && profile.Cloud != defaultCloud {
+			desc += " [cloud: " + profile.Cloud + "]"
+		}
+		desc += "\n"
+	}
+	return desc
 }
 
-func generateToolDescription(readOnlyMode bool, defaultSubscription string) string {
+func generateToolDescription(readOnlyMode bool, defaultSubscription string, dryRun bool, cloud string) string {
 	baseDesc := "Execute Azure CLI commands with security validation and policy enforcement.\n\n"
 
 	if readOnlyMode {
@@ -28,13 +86,28 @@ func generateToolDescription(readOnlyMode bool, defaultSubscription string) stri
 		baseDesc += "Mode: READ-WRITE - Both read and write operations are allowed (subject to policy).\n\n"
 	}
 
+	if dryRun {
+		baseDesc += "DRY-RUN: Commands are validated and reported on but never executed.\n\n"
+	}
+
 	if defaultSubscription != "" {
 		baseDesc += "Default Subscription: " + defaultSubscription + "\n\n"
 	}
 
+	if cloud != "" {
+		baseDesc += "Cloud: " + cloud
+		if cloud != DefaultCloud {
+			baseDesc += " - Use the locations, resource IDs and endpoints of this cloud, not those of the public Azure cloud."
+		}
+		baseDesc += "\n\n"
+	}
+
 	baseDesc += "IMPORTANT: Commands must be simple Azure CLI invocations without shell features.\n"
 	baseDesc += "NOT allowed: pipes (|), redirects (>, <), command substitution ($(...) or ``), semicolons (;), && or ||.\n"
-	baseDesc += "If you need values from another command, call this tool multiple times sequentially.\n\n"
+	baseDesc += "If you need values from another command, call this tool multiple times sequentially.\n"
+	baseDesc += "Set dry_run=true to check whether a command would be allowed before running it.\n"
+	baseDesc += "Use jmespath or fields to return only the parts of a large JSON result you need.\n"
+	baseDesc += "Commands return JSON (--output is normalized to json unless the server allows other formats); use format to have the server render it as yaml, a markdown table or csv.\n\n"
 
 	baseDesc += "Examples:\n"
 	baseDesc += "- List VMs: cli_command=\"az vm list --resource-group myRG\"\n"
@@ -49,3 +122,20 @@ func generateToolDescription(readOnlyMode bool, defaultSubscription string) stri
 
 	return baseDesc
 }
+
+// RegisterFetchPageTool returns the tool that reads further pages of a call_az
+// output that was too large for a single response.
+func RegisterFetchPageTool() mcp.Tool {
+	return mcp.NewTool("call_az_fetch_page",
+		mcp.WithDescription("Fetch a further page of a call_az output that was too large for a single response. call_az returns the first page together with a handle and the number of pages."),
+		mcp.WithString("handle",
+			mcp.Required(),
+			mcp.Description("The output handle returned by call_az"),
+		),
+		mcp.WithNumber("page",
+			mcp.Required(),
+			mcp.Description("The page to fetch, starting at 1 (page 1 is the one call_az returned)"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+}
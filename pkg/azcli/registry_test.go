@@ -1,6 +1,7 @@
 package azcli
 
 import (
+	"slices"
 	"strings"
 	"testing"
 )
@@ -77,7 +78,7 @@ func TestGenerateToolDescription(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			desc := generateToolDescription(tt.readOnlyMode, tt.defaultSubscription)
+			desc := generateToolDescription(tt.readOnlyMode, tt.defaultSubscription, false, "")
 
 			for _, want := range tt.wantContains {
 				if !strings.Contains(desc, want) {
@@ -96,7 +97,7 @@ func TestGenerateToolDescription(t *testing.T) {
 
 func TestGenerateToolDescriptionExamples(t *testing.T) {
 	t.Run("contains required examples", func(t *testing.T) {
-		desc := generateToolDescription(false, "")
+		desc := generateToolDescription(false, "", false, "")
 
 		requiredExamples := []string{
 			"List VMs:",
@@ -113,8 +114,8 @@ func TestGenerateToolDescriptionExamples(t *testing.T) {
 	})
 
 	t.Run("read-write examples only in non-readonly mode", func(t *testing.T) {
-		readOnlyDesc := generateToolDescription(true, "")
-		readWriteDesc := generateToolDescription(false, "")
+		readOnlyDesc := generateToolDescription(true, "", false, "")
+		readWriteDesc := generateToolDescription(false, "", false, "")
 
 		writeExamples := []string{
 			"Create resource group:",
@@ -131,3 +132,28 @@ func TestGenerateToolDescriptionExamples(t *testing.T) {
 		}
 	})
 }
+
+func TestGenerateToolDescriptionDryRun(t *testing.T) {
+	if desc := generateToolDescription(false, "", true, ""); !strings.Contains(desc, "DRY-RUN") {
+		t.Errorf("generateToolDescription() in dry-run mode should mention DRY-RUN:\n%s", desc)
+	}
+	if desc := generateToolDescription(false, "", false, ""); strings.Contains(desc, "DRY-RUN") {
+		t.Errorf("generateToolDescription() should not mention DRY-RUN when dry-run is off:\n%s", desc)
+	}
+}
+
+func TestRegisterCallAzToolOutputSchema(t *testing.T) {
+	tool := RegisterCallAzTool(false, "", false, nil)
+
+	if tool.OutputSchema.Type != "object" {
+		t.Fatalf("OutputSchema.Type = %q, want object", tool.OutputSchema.Type)
+	}
+	for _, property := range []string{"command", "exitCode", "output", "warnings", "stderr", "durationMs", "error", "truncation", "dryRun"} {
+		if _, ok := tool.OutputSchema.Properties[property]; !ok {
+			t.Errorf("OutputSchema is missing property %q", property)
+		}
+	}
+	if !slices.Contains(tool.OutputSchema.Required, "command") || !slices.Contains(tool.OutputSchema.Required, "durationMs") {
+		t.Errorf("OutputSchema.Required = %v, want command and durationMs", tool.OutputSchema.Required)
+	}
+}
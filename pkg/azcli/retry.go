@@ -0,0 +1,139 @@
+package azcli
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/Azure/azure-api-mcp/internal/logger"
+	"github.com/Azure/azure-api-mcp/internal/metrics"
+)
+
+const (
+	defaultRetryBaseDelay = time.Second
+	defaultRetryMaxDelay  = 30 * time.Second
+)
+
+// RetryConfig controls automatic retries of throttled and transient
+// failures. Only read-only commands, and write commands whose policy rule
+// sets retry, are retried.
+type RetryConfig struct {
+	// MaxRetries is the number of retries after the first attempt; 0
+	// disables retries.
+	MaxRetries int
+	// BaseDelay is the delay before the first retry (default 1s). It doubles
+	// with every retry up to MaxDelay (default 30s), with random jitter.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// retryableErrorTypes are the failures worth retrying.
+var retryableErrorTypes = map[ErrorType]bool{
+	ErrorTypeThrottled: true,
+	ErrorTypeTransient: true,
+}
+
+// retryPolicy decides whether and when to retry a failed execution.
+type retryPolicy struct {
+	config RetryConfig
+}
+
+func newRetryPolicy(config RetryConfig) *retryPolicy {
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = defaultRetryBaseDelay
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = defaultRetryMaxDelay
+	}
+	return &retryPolicy{config: config}
+}
+
+// allows reports whether the validated command may be retried at all.
+func (p *retryPolicy) allows(validation *ValidationResult) bool {
+	if p == nil || p.config.MaxRetries <= 0 || validation == nil {
+		return false
+	}
+	if validation.ReadOnly {
+		return true
+	}
+	return validation.Policy != nil && validation.Policy.Rule != nil && validation.Policy.Rule.Retry
+}
+
+// delay returns how long to wait before retry number retry (starting at 1)
+// of a command that failed with err. It returns false when err is not
+// retryable or the retries are used up.
+func (p *retryPolicy) delay(retry int, err error) (time.Duration, bool) {
+	if retry > p.config.MaxRetries {
+		return 0, false
+	}
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || !retryableErrorTypes[azErr.Type] {
+		return 0, false
+	}
+
+	backoff := p.config.BaseDelay << (retry - 1)
+	if backoff <= 0 || backoff > p.config.MaxDelay {
+		backoff = p.config.MaxDelay
+	}
+	// Equal jitter: half the backoff, plus a random share of the other half.
+	wait := backoff/2 + rand.N(backoff/2+1)
+
+	if retryAfter, ok := azErr.Context["retry_after"].(int); ok {
+		wait = max(wait, time.Duration(retryAfter)*time.Second)
+	}
+	return wait, true
+}
+
+// executeWithRetry runs cmd and retries throttled and transient failures
+// when retry is set. A retry is only attempted if its delay ends before the
+// context deadline. The number of retries is recorded in the result, or in
+// the "retries" context of the final error.
+func (c *DefaultClient) executeWithRetry(ctx context.Context, cmd *ParsedCommand, retry bool) (*Result, error) {
+	for retries := 0; ; retries++ {
+		result, err := c.execute(ctx, cmd)
+		if err == nil {
+			result.Retries = retries
+			if retries > 0 {
+				logger.Infof("Command succeeded after %d retries: %s", retries, cmd.Raw())
+			}
+			return result, nil
+		}
+		if !retry {
+			return nil, err
+		}
+
+		wait, ok := c.retry.delay(retries+1, err)
+		if !ok {
+			return nil, withRetries(err, retries)
+		}
+		if deadline, hasDeadline := ctx.Deadline(); hasDeadline && time.Until(deadline) < wait {
+			logger.Warnf("Not retrying %s: retry delay %v exceeds the remaining time", cmd.Raw(), wait)
+			return nil, withRetries(err, retries)
+		}
+
+		errorType := string(ErrorTypeExecution)
+		var azErr *AzCliError
+		if errors.As(err, &azErr) {
+			errorType = string(azErr.Type)
+		}
+		metrics.Retries.Inc(cmd.Group(), errorType)
+		logger.Warnf("Command failed with %s, retry %d of %d in %v: %s", errorType, retries+1, c.retry.config.MaxRetries, wait, cmd.Raw())
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, withRetries(err, retries)
+		case <-timer.C:
+		}
+	}
+}
+
+func withRetries(err error, retries int) error {
+	var azErr *AzCliError
+	if retries > 0 && errors.As(err, &azErr) {
+		azErr.WithContext("retries", retries)
+	}
+	return err
+}
@@ -0,0 +1,141 @@
+package azcli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func throttledError() error {
+	return NewAzCliError(ErrorTypeThrottled, "(TooManyRequests) throttled", "az vm list")
+}
+
+// failingExecutor fails the first failures executions with errFunc and then
+// succeeds.
+func failingExecutor(failures int, errFunc func() error) *mockExecutor {
+	executor := &mockExecutor{}
+	executor.executeFunc = func(ctx context.Context, cmd *ParsedCommand) (*Result, error) {
+		if executor.callCount <= failures {
+			return nil, errFunc()
+		}
+		return &Result{Output: json.RawMessage(`[]`)}, nil
+	}
+	return executor
+}
+
+func newRetryTestClient(validator *mockValidator, executor *mockExecutor, maxRetries int) *DefaultClient {
+	return &DefaultClient{
+		validator: validator,
+		executor:  executor,
+		retry:     newRetryPolicy(RetryConfig{MaxRetries: maxRetries, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}),
+	}
+}
+
+func TestClient_ExecuteCommand_RetriesReadOnly(t *testing.T) {
+	executor := failingExecutor(2, throttledError)
+	client := newRetryTestClient(&mockValidator{readOnly: true}, executor, 3)
+
+	result, err := client.ExecuteCommand(context.Background(), "az vm list")
+	if err != nil {
+		t.Fatalf("ExecuteCommand() error = %v", err)
+	}
+	if result.Retries != 2 || executor.callCount != 3 {
+		t.Errorf("Retries = %d, executions = %d, want 2 and 3", result.Retries, executor.callCount)
+	}
+}
+
+func TestClient_ExecuteCommand_RetriesExhausted(t *testing.T) {
+	executor := failingExecutor(10, throttledError)
+	client := newRetryTestClient(&mockValidator{readOnly: true}, executor, 2)
+
+	_, err := client.ExecuteCommand(context.Background(), "az vm list")
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeThrottled {
+		t.Fatalf("ExecuteCommand() error = %v, want ErrorTypeThrottled", err)
+	}
+	if azErr.Context["retries"] != 2 || executor.callCount != 3 {
+		t.Errorf("retries = %v, executions = %d, want 2 and 3", azErr.Context["retries"], executor.callCount)
+	}
+}
+
+func TestClient_ExecuteCommand_DoesNotRetryWrites(t *testing.T) {
+	executor := failingExecutor(1, throttledError)
+	client := newRetryTestClient(&mockValidator{}, executor, 3)
+
+	if _, err := client.ExecuteCommand(context.Background(), "az vm start --name vm1"); err == nil {
+		t.Fatal("ExecuteCommand() should fail without retrying a write command")
+	}
+	if executor.callCount != 1 {
+		t.Errorf("executions = %d, want 1", executor.callCount)
+	}
+
+	// A policy rule can opt write commands in.
+	executor = failingExecutor(1, throttledError)
+	policy := &PolicyDecision{Action: PolicyActionAllow, Rule: &PolicyRule{Name: "retry-starts", Retry: true}}
+	client = newRetryTestClient(&mockValidator{policy: policy}, executor, 3)
+	result, err := client.ExecuteCommand(context.Background(), "az vm start --name vm1")
+	if err != nil {
+		t.Fatalf("ExecuteCommand() with retry rule error = %v", err)
+	}
+	if result.Retries != 1 {
+		t.Errorf("Retries = %d, want 1", result.Retries)
+	}
+}
+
+func TestClient_ExecuteCommand_DoesNotRetryPermanentErrors(t *testing.T) {
+	executor := failingExecutor(1, func() error {
+		return NewAzCliError(ErrorTypeAuthorizationFailed, "(AuthorizationFailed) denied", "az vm list")
+	})
+	client := newRetryTestClient(&mockValidator{readOnly: true}, executor, 3)
+
+	if _, err := client.ExecuteCommand(context.Background(), "az vm list"); err == nil {
+		t.Fatal("ExecuteCommand() should fail")
+	}
+	if executor.callCount != 1 {
+		t.Errorf("executions = %d, want 1", executor.callCount)
+	}
+}
+
+func TestClient_ExecuteCommand_RetryBoundedByDeadline(t *testing.T) {
+	executor := failingExecutor(1, func() error {
+		return NewAzCliError(ErrorTypeThrottled, "throttled", "az vm list").WithContext("retry_after", 60)
+	})
+	client := newRetryTestClient(&mockValidator{readOnly: true}, executor, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := client.ExecuteCommand(ctx, "az vm list"); err == nil {
+		t.Fatal("ExecuteCommand() should fail when Retry-After exceeds the deadline")
+	}
+	if executor.callCount != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("executions = %d after %v, want 1 without waiting", executor.callCount, time.Since(start))
+	}
+}
+
+func TestRetryPolicy_Delay(t *testing.T) {
+	policy := newRetryPolicy(RetryConfig{MaxRetries: 3, BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond})
+
+	for retry, maxWait := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 300 * time.Millisecond} {
+		wait, ok := policy.delay(retry, throttledError())
+		if !ok || wait < maxWait/2 || wait > maxWait {
+			t.Errorf("delay(%d) = %v, %v, want between %v and %v", retry, wait, ok, maxWait/2, maxWait)
+		}
+	}
+
+	if _, ok := policy.delay(4, throttledError()); ok {
+		t.Error("delay() should stop after MaxRetries")
+	}
+
+	withRetryAfter := NewAzCliError(ErrorTypeThrottled, "throttled", "").WithContext("retry_after", 5)
+	if wait, ok := policy.delay(1, withRetryAfter); !ok || wait != 5*time.Second {
+		t.Errorf("delay() with retry_after = %v, %v, want 5s", wait, ok)
+	}
+
+	if _, ok := policy.delay(1, errors.New("exit status 1")); ok {
+		t.Error("delay() should not retry unclassified errors")
+	}
+}
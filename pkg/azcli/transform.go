@@ -0,0 +1,90 @@
+package azcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+)
+
+// ApplyJMESPath evaluates a JMESPath expression against JSON output and
+// returns the result as compact JSON. It is applied by the server after
+// execution, on top of any --query the command itself used.
+func ApplyJMESPath(output json.RawMessage, expression string) (json.RawMessage, error) {
+	compiled, err := jmespath.Compile(expression)
+	if err != nil {
+		return nil, NewAzCliError(ErrorTypeQuery, fmt.Sprintf("invalid JMESPath expression: %v", err), "").
+			WithContext("expression", expression)
+	}
+
+	data, err := decodeOutput(output)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := compiled.Search(data)
+	if err != nil {
+		return nil, NewAzCliError(ErrorTypeQuery, fmt.Sprintf("JMESPath evaluation failed: %v", err), "").
+			WithContext("expression", expression)
+	}
+
+	encoded, err := json.Marshal(result)
+	if err != nil {
+		return nil, NewAzCliError(ErrorTypeQuery, fmt.Sprintf("failed to encode JMESPath result: %v", err), "")
+	}
+	return encoded, nil
+}
+
+// ProjectFields keeps only the given fields of a JSON object, or of every
+// object in a JSON array. A field may be a dotted path such as
+// "properties.provisioningState"; the path is used as the key in the result.
+func ProjectFields(output json.RawMessage, fields []string) (json.RawMessage, error) {
+	expression, err := fieldsExpression(output, fields)
+	if err != nil {
+		return nil, err
+	}
+	return ApplyJMESPath(output, expression)
+}
+
+// fieldsExpression builds the JMESPath multi-select hash for fields, quoting
+// every identifier so field names cannot inject expression syntax.
+func fieldsExpression(output json.RawMessage, fields []string) (string, error) {
+	var pairs []string
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		var segments []string
+		for _, segment := range strings.Split(field, ".") {
+			if segment == "" {
+				return "", NewAzCliError(ErrorTypeQuery, fmt.Sprintf("invalid field %q", field), "")
+			}
+			segments = append(segments, quoteIdentifier(segment))
+		}
+		pairs = append(pairs, quoteIdentifier(field)+": "+strings.Join(segments, "."))
+	}
+	if len(pairs) == 0 {
+		return "", NewAzCliError(ErrorTypeQuery, "fields must name at least one field", "")
+	}
+
+	selection := "{" + strings.Join(pairs, ", ") + "}"
+	if strings.HasPrefix(strings.TrimSpace(string(output)), "[") {
+		return "[]." + selection, nil
+	}
+	return selection, nil
+}
+
+func quoteIdentifier(name string) string {
+	encoded, _ := json.Marshal(name)
+	return string(encoded)
+}
+
+func decodeOutput(output json.RawMessage) (any, error) {
+	var data any
+	if err := json.Unmarshal(output, &data); err != nil {
+		return nil, NewAzCliError(ErrorTypeQuery, "command output is not JSON, so jmespath and fields cannot be applied", "")
+	}
+	return data, nil
+}
@@ -0,0 +1,121 @@
+package azcli
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+const testVMList = `[
+  {"name": "vm1", "location": "eastus", "properties": {"provisioningState": "Succeeded"}, "tags": {"env": "prod"}},
+  {"name": "vm2", "location": "westus", "properties": {"provisioningState": "Failed"}, "tags": null}
+]`
+
+func assertJSONEqual(t *testing.T, got json.RawMessage, want string) {
+	t.Helper()
+	var gotValue, wantValue any
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("result is not JSON: %s", got)
+	}
+	if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+		t.Fatal(err)
+	}
+	gotJSON, _ := json.Marshal(gotValue)
+	wantJSON, _ := json.Marshal(wantValue)
+	if string(gotJSON) != string(wantJSON) {
+		t.Errorf("got %s, want %s", gotJSON, wantJSON)
+	}
+}
+
+func assertQueryError(t *testing.T, err error) {
+	t.Helper()
+	var azErr *AzCliError
+	if !errors.As(err, &azErr) || azErr.Type != ErrorTypeQuery {
+		t.Errorf("error = %v, want ErrorTypeQuery", err)
+	}
+}
+
+func TestApplyJMESPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		output     string
+		expression string
+		want       string
+	}{
+		{
+			name:       "projection",
+			output:     testVMList,
+			expression: "[].name",
+			want:       `["vm1", "vm2"]`,
+		},
+		{
+			name:       "filter",
+			output:     testVMList,
+			expression: "[?properties.provisioningState=='Failed'].{name: name, location: location}",
+			want:       `[{"name": "vm2", "location": "westus"}]`,
+		},
+		{
+			name:       "output already reduced by --query",
+			output:     `["vm1", "vm2"]`,
+			expression: "length(@)",
+			want:       `2`,
+		},
+		{
+			name:       "no match",
+			output:     testVMList,
+			expression: "[0].missing",
+			want:       `null`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyJMESPath(json.RawMessage(tt.output), tt.expression)
+			if err != nil {
+				t.Fatalf("ApplyJMESPath() error = %v", err)
+			}
+			assertJSONEqual(t, got, tt.want)
+		})
+	}
+}
+
+func TestApplyJMESPath_Errors(t *testing.T) {
+	_, err := ApplyJMESPath(json.RawMessage(testVMList), "[?name==")
+	assertQueryError(t, err)
+
+	_, err = ApplyJMESPath(json.RawMessage(testVMList), "length(`1`)")
+	assertQueryError(t, err)
+
+	_, err = ApplyJMESPath(json.RawMessage("Name    Location\nvm1     eastus"), "[].name")
+	assertQueryError(t, err)
+}
+
+func TestProjectFields(t *testing.T) {
+	got, err := ProjectFields(json.RawMessage(testVMList), []string{"name", "properties.provisioningState"})
+	if err != nil {
+		t.Fatalf("ProjectFields() error = %v", err)
+	}
+	assertJSONEqual(t, got, `[
+		{"name": "vm1", "properties.provisioningState": "Succeeded"},
+		{"name": "vm2", "properties.provisioningState": "Failed"}
+	]`)
+
+	got, err = ProjectFields(json.RawMessage(`{"name": "vm1", "location": "eastus", "id": "/x"}`), []string{"name", " location "})
+	if err != nil {
+		t.Fatalf("ProjectFields() error = %v", err)
+	}
+	assertJSONEqual(t, got, `{"name": "vm1", "location": "eastus"}`)
+
+	// Field names are quoted, so expression syntax is treated as a literal key.
+	got, err = ProjectFields(json.RawMessage(`{"a": 1}`), []string{`a}, b: @`})
+	if err != nil {
+		t.Fatalf("ProjectFields() error = %v", err)
+	}
+	assertJSONEqual(t, got, `{"a}, b: @": null}`)
+
+	_, err = ProjectFields(json.RawMessage(testVMList), []string{"properties..state"})
+	assertQueryError(t, err)
+
+	_, err = ProjectFields(json.RawMessage(testVMList), []string{" "})
+	assertQueryError(t, err)
+}
@@ -1,6 +1,7 @@
 package azcli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"regexp"
@@ -10,7 +11,10 @@ import (
 )
 
 type Validator interface {
-	Validate(cmdStr string) error
+	Validate(cmd *ParsedCommand) (*ValidationResult, error)
+	// Explain reports the outcome of every validation layer without
+	// stopping at the first failure.
+	Explain(cmd *ParsedCommand) *DryRunReport
 }
 
 type DefaultValidator struct {
@@ -34,39 +38,62 @@ func NewDefaultValidator(cfg ClientConfig) (*DefaultValidator, error) {
 		validator.policy = policy
 	}
 
-	if cfg.ReadOnlyMode {
-		patterns, err := LoadReadOnlyPatterns(cfg.ReadOnlyPatternsFile)
-		if err != nil {
-			return nil, err
-		}
-		validator.readOnlyPatterns = patterns
+	// Read-only patterns are always loaded so that every command can be
+	// classified as a read or a write, even when read-only mode is off.
+	patterns, err := LoadReadOnlyPatterns(cfg.ReadOnlyPatternsFile)
+	if err != nil {
+		return nil, err
 	}
+	validator.readOnlyPatterns = patterns
 
 	return validator, nil
 }
 
-func (v *DefaultValidator) Validate(cmdStr string) error {
-	if err := v.validateBasicSecurity(cmdStr); err != nil {
-		return err
+func (v *DefaultValidator) Validate(cmd *ParsedCommand) (*ValidationResult, error) {
+	if err := cmd.verify(); err != nil {
+		return nil, NewAzCliError(ErrorTypeInvalidCommand, err.Error(), "")
 	}
 
-	if v.enableSecurityPolicy {
-		if err := v.checkDenyList(cmdStr); err != nil {
-			return err
+	if err := v.validateBasicSecurity(cmd); err != nil {
+		return nil, withLayer(err, LayerBasicSecurity)
+	}
+
+	result := &ValidationResult{Command: cmd, ReadOnly: v.isReadOnly(cmd)}
+
+	if v.enableSecurityPolicy && v.policy != nil {
+		decision, err := v.checkSecurityPolicy(cmd)
+		if err != nil {
+			return nil, withLayer(err, LayerSecurityPolicy)
+		}
+		result.Policy = &decision
+		if decision.RequiresApproval() {
+			result.RequiresApproval = true
+			result.ApprovalTimeout = v.policy.approvalTimeout(decision)
 		}
 	}
 
 	if v.readOnlyMode {
-		if err := v.checkReadOnly(cmdStr); err != nil {
-			return err
+		if err := v.checkReadOnly(cmd); err != nil {
+			return nil, withLayer(err, LayerReadOnly)
 		}
 	}
 
-	return nil
+	return result, nil
 }
 
-func (v *DefaultValidator) validateBasicSecurity(cmdStr string) error {
-	if !strings.HasPrefix(cmdStr, "az ") {
+// withLayer records the validation layer that rejected a command in the
+// error's "layer" context.
+func withLayer(err error, layer string) error {
+	var azErr *AzCliError
+	if errors.As(err, &azErr) {
+		azErr.WithContext("layer", layer)
+	}
+	return err
+}
+
+func (v *DefaultValidator) validateBasicSecurity(cmd *ParsedCommand) error {
+	cmdStr := cmd.Raw()
+	if len(cmd.args) < 2 || cmd.args[0] != "az" {
 		return NewAzCliError(ErrorTypeInvalidCommand, "command must start with 'az '", cmdStr)
 	}
 
@@ -84,34 +111,54 @@ func (v *DefaultValidator) validateBasicSecurity(cmdStr string) error {
 	return nil
 }
 
-func (v *DefaultValidator) checkDenyList(cmdStr string) error {
-	if v.policy == nil {
+func (v *DefaultValidator) checkSecurityPolicy(cmd *ParsedCommand) (PolicyDecision, error) {
+	decision := v.policy.Evaluate(cmd)
+	return decision, policyError(cmd, decision)
+}
+
+func policyError(cmd *ParsedCommand, decision PolicyDecision) error {
+	if decision.Allowed() {
 		return nil
 	}
 
-	for _, denied := range v.policy.Policy.DenyList {
-		if strings.HasPrefix(cmdStr, denied) {
-			return NewAzCliError(ErrorTypeCommandDenied, fmt.Sprintf("command denied by security policy: %s", denied), cmdStr)
-		}
+	if decision.Rule == nil {
+		return NewAzCliError(ErrorTypeCommandDenied, "command denied by security policy: no rule allows this command", cmd.Raw())
 	}
-	return nil
+	return NewAzCliError(ErrorTypeCommandDenied, fmt.Sprintf("command denied by security policy: %s", decision.RuleName()), cmd.Raw()).
+		WithContext("rule", decision.RuleName())
 }
 
-func (v *DefaultValidator) checkReadOnly(cmdStr string) error {
+// checkReadOnly rejects commands that do not match a read-only pattern.
+func (v *DefaultValidator) checkReadOnly(cmd *ParsedCommand) error {
+	cmdStr := cmd.Raw()
 	if v.readOnlyPatterns == nil {
 		return NewAzCliError(ErrorTypeCommandDenied, "read-only patterns not loaded", cmdStr)
 	}
 
+	if v.isReadOnly(cmd) {
+		return nil
+	}
+	return NewAzCliError(ErrorTypeCommandDenied, "command not allowed in read-only mode", cmdStr)
+}
+
+// isReadOnly matches the read-only patterns against the normalized command
+// path (e.g. "az vm list") rather than the raw string, so flag names and
+// values cannot make a write command look like a read.
+func (v *DefaultValidator) isReadOnly(cmd *ParsedCommand) bool {
+	if v.readOnlyPatterns == nil {
+		return false
+	}
+
 	for _, pattern := range v.readOnlyPatterns.Patterns {
-		matched, err := regexp.MatchString(pattern, cmdStr)
+		matched, err := regexp.MatchString(pattern, cmd.CommandString())
 		if err != nil {
 			continue
 		}
 		if matched {
-			return nil
+			return true
 		}
 	}
-	return NewAzCliError(ErrorTypeCommandDenied, "command not allowed in read-only mode", cmdStr)
+	return false
 }
 
 func LoadSecurityPolicy(filePath string) (*SecurityPolicy, error) {
@@ -133,6 +180,10 @@ func LoadSecurityPolicy(filePath string) (*SecurityPolicy, error) {
 		return nil, fmt.Errorf("failed to parse policy: %w", err)
 	}
 
+	if err := policy.validate(); err != nil {
+		return nil, fmt.Errorf("invalid policy: %w", err)
+	}
+
 	return &policy, nil
 }
 
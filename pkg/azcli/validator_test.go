@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 )
 
 func TestValidator_ValidateBasicSecurity(t *testing.T) {
@@ -66,7 +67,10 @@ func TestValidator_ValidateBasicSecurity(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validator.validateBasicSecurity(tt.input)
+			cmd, err := ParseCommand(tt.input)
+			if err == nil {
+				err = validator.validateBasicSecurity(cmd)
+			}
 			if (err != nil) != tt.wantErr {
 				t.Errorf("validateBasicSecurity() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -74,6 +78,32 @@ func TestValidator_ValidateBasicSecurity(t *testing.T) {
 	}
 }
 
+func TestValidator_ValidateRejectsUnparsedCommand(t *testing.T) {
+	validator := &DefaultValidator{}
+
+	_, err := validator.Validate(&ParsedCommand{raw: "az vm list", args: []string{"az", "vm", "list"}})
+	azErr, ok := err.(*AzCliError)
+	if !ok || azErr.Type != ErrorTypeInvalidCommand {
+		t.Errorf("Validate() error = %v, want ErrorTypeInvalidCommand", err)
+	}
+}
+
+func TestValidator_ValidateRejectsEmptyCommandPath(t *testing.T) {
+	validator := &DefaultValidator{}
+
+	for _, input := range []string{"az --version", "az -o json", "az --debug --query id"} {
+		cmd, err := ParseCommand(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = validator.Validate(cmd)
+		azErr, ok := err.(*AzCliError)
+		if !ok || azErr.Type != ErrorTypeInvalidCommand {
+			t.Errorf("Validate(%q) error = %v, want ErrorTypeInvalidCommand", input, err)
+		}
+	}
+}
+
 func TestValidator_CheckReadOnly(t *testing.T) {
 	tmpDir := t.TempDir()
 	patternsFile := filepath.Join(tmpDir, "readonly-patterns.yaml")
@@ -198,11 +228,30 @@ func TestValidator_CheckReadOnly(t *testing.T) {
 			input:   "az network vnet subnet create --resource-group myRG --vnet-name myVnet --name mySubnet",
 			wantErr: true,
 		},
+		{
+			name:    "write command - flag value looks like read subcommand",
+			input:   "az vm delete --name list",
+			wantErr: true,
+		},
+		{
+			name:    "write command - quoted argument looks like read subcommand",
+			input:   `az vm delete --name myVM --tags "x list"`,
+			wantErr: true,
+		},
+		{
+			name:    "read-only command - global flag before command path",
+			input:   "az --only-show-errors vm list",
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validator.checkReadOnly(tt.input)
+			cmd, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCommand() error = %v", err)
+			}
+			err = validator.checkReadOnly(cmd)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("checkReadOnly() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -210,7 +259,7 @@ func TestValidator_CheckReadOnly(t *testing.T) {
 	}
 }
 
-func TestValidator_CheckDenyList(t *testing.T) {
+func TestValidator_CheckSecurityPolicy(t *testing.T) {
 	policy := &SecurityPolicy{
 		Version: "1.0",
 		Policy: PolicyRules{
@@ -259,13 +308,103 @@ func TestValidator_CheckDenyList(t *testing.T) {
 			input:   "az group delete --name myRG",
 			wantErr: true,
 		},
+		{
+			name:    "denied - double space between groups",
+			input:   "az  vm delete --name myVM",
+			wantErr: true,
+		},
+		{
+			name:    "denied - double space before flags",
+			input:   "az vm  delete --yes",
+			wantErr: true,
+		},
+		{
+			name:    "denied - global flag before command path",
+			input:   "az --debug vm delete --name myVM",
+			wantErr: true,
+		},
+		{
+			name:    "denied - global flags with values before command path",
+			input:   "az -o json --subscription sub1 --query=id vm delete --name myVM --yes",
+			wantErr: true,
+		},
+		{
+			name:    "allowed - similar group name",
+			input:   "az vmss list",
+			wantErr: false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := validator.checkDenyList(tt.input)
+			cmd, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatalf("ParseCommand() error = %v", err)
+			}
+			_, err = validator.checkSecurityPolicy(cmd)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("checkDenyList() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("checkSecurityPolicy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidator_Validate_RequireApproval(t *testing.T) {
+	policy := &SecurityPolicy{
+		Policy: PolicyRules{
+			ApprovalTimeout: "10m",
+			Rules: []PolicyRule{
+				{Name: "approve-aks-delete", Action: PolicyActionRequireApproval, Command: "aks delete", ApprovalTimeout: "2m"},
+				{Name: "approve-writes", Action: PolicyActionRequireApproval, Command: "** create"},
+			},
+		},
+	}
+
+	validator := &DefaultValidator{
+		enableSecurityPolicy: true,
+		policy:               policy,
+	}
+
+	tests := []struct {
+		name             string
+		input            string
+		requiresApproval bool
+		timeout          time.Duration
+	}{
+		{
+			name:             "rule-specific timeout",
+			input:            "az aks delete --name c1 --resource-group rg",
+			requiresApproval: true,
+			timeout:          2 * time.Minute,
+		},
+		{
+			name:             "policy-wide timeout",
+			input:            "az group create --name rg --location eastus",
+			requiresApproval: true,
+			timeout:          10 * time.Minute,
+		},
+		{
+			name:             "no approval needed",
+			input:            "az aks list",
+			requiresApproval: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := ParseCommand(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := validator.Validate(cmd)
+			if err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if result.RequiresApproval != tt.requiresApproval {
+				t.Errorf("RequiresApproval = %v, want %v", result.RequiresApproval, tt.requiresApproval)
+			}
+			if result.ApprovalTimeout != tt.timeout {
+				t.Errorf("ApprovalTimeout = %v, want %v", result.ApprovalTimeout, tt.timeout)
 			}
 		})
 	}
@@ -320,3 +459,95 @@ policy:
 		t.Errorf("expected 2 denied commands, got %d", len(policy.Policy.DenyList))
 	}
 }
+
+func TestLoadSecurityPolicy_Rules(t *testing.T) {
+	tmpDir := t.TempDir()
+	policyFile := filepath.Join(tmpDir, "policy.yaml")
+
+	content := `version: "1.0"
+policy:
+  defaultAction: deny
+  rules:
+    - name: deny-keys
+      action: deny
+      command: "storage account keys *"
+    - name: allow-storage
+      action: allow
+      command: "storage **"
+`
+	if err := os.WriteFile(policyFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	policy, err := LoadSecurityPolicy(policyFile)
+	if err != nil {
+		t.Fatalf("LoadSecurityPolicy() error = %v", err)
+	}
+
+	if policy.Policy.DefaultAction != PolicyActionDeny {
+		t.Errorf("expected defaultAction deny, got %s", policy.Policy.DefaultAction)
+	}
+	if len(policy.Policy.Rules) != 2 {
+		t.Errorf("expected 2 rules, got %d", len(policy.Policy.Rules))
+	}
+}
+
+func TestLoadSecurityPolicy_InvalidRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{
+			name: "unknown action",
+			content: `policy:
+  rules:
+    - action: block
+      command: "vm delete"
+`,
+		},
+		{
+			name: "missing command",
+			content: `policy:
+  rules:
+    - action: deny
+`,
+		},
+		{
+			name: "unknown default action",
+			content: `policy:
+  defaultAction: maybe
+`,
+		},
+		{
+			name: "invalid approval timeout",
+			content: `policy:
+  rules:
+    - action: require-approval
+      command: "vm delete"
+      approvalTimeout: soon
+`,
+		},
+		{
+			name: "flag condition without name",
+			content: `policy:
+  rules:
+    - action: deny
+      command: "vm delete"
+      flags:
+        - present: true
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policyFile := filepath.Join(t.TempDir(), "policy.yaml")
+			if err := os.WriteFile(policyFile, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadSecurityPolicy(policyFile); err == nil {
+				t.Error("LoadSecurityPolicy() should reject invalid policy")
+			}
+		})
+	}
+}